@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/reef-pi/reef-pi/controller/modules/leak"
 	"github.com/reef-pi/reef-pi/controller/settings"
 	"github.com/reef-pi/reef-pi/controller/utils"
 	"log"
@@ -41,6 +42,9 @@ func (r *ReefPi) API() error {
 func (r *ReefPi) UnAuthenticatedAPI(router *mux.Router) {
 	router.HandleFunc("/auth/signin", r.a.SignIn).Methods("POST")
 	router.HandleFunc("/auth/signout", r.a.SignOut).Methods("GET")
+	if lk, ok := r.subsystems[leak.Bucket].(*leak.Controller); ok {
+		lk.LoadSensorAPI(router)
+	}
 }
 
 // Authenticated API using the BasicAuth middleware
@@ -88,6 +92,7 @@ func startAPIServer(address string, creds utils.Credentials, https bool) (error,
 	images := http.FileServer(http.Dir("images"))
 	http.Handle("/images/", http.StripPrefix("/images/", images))
 	http.Handle("/auth/", router)
+	http.Handle("/sensors/", router)
 	if https {
 		if err := utils.GenerateCerts(); err != nil {
 			return err, nil
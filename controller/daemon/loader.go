@@ -10,6 +10,7 @@ import (
 	"github.com/reef-pi/reef-pi/controller/modules/doser"
 	"github.com/reef-pi/reef-pi/controller/modules/equipment"
 	"github.com/reef-pi/reef-pi/controller/modules/flow"
+	"github.com/reef-pi/reef-pi/controller/modules/journal"
 	"github.com/reef-pi/reef-pi/controller/modules/leak"
 	"github.com/reef-pi/reef-pi/controller/modules/lighting"
 	"github.com/reef-pi/reef-pi/controller/modules/macro"
@@ -17,6 +18,8 @@ import (
 	"github.com/reef-pi/reef-pi/controller/modules/system"
 	"github.com/reef-pi/reef-pi/controller/modules/temperature"
 	"github.com/reef-pi/reef-pi/controller/modules/timer"
+	"github.com/reef-pi/reef-pi/controller/modules/water"
+	"github.com/reef-pi/reef-pi/controller/modules/workflow"
 )
 
 func (r *ReefPi) loadPhSubsystem() error {
@@ -28,6 +31,33 @@ func (r *ReefPi) loadPhSubsystem() error {
 	return nil
 }
 
+func (r *ReefPi) loadWaterSubsystem() error {
+	if !r.settings.Capabilities.Water {
+		return nil
+	}
+	w := water.New(r)
+	r.subsystems[water.Bucket] = w
+	return nil
+}
+
+func (r *ReefPi) loadJournalSubsystem() error {
+	if !r.settings.Capabilities.Journal {
+		return nil
+	}
+	j := journal.New(r)
+	r.subsystems[journal.Bucket] = j
+	return nil
+}
+
+func (r *ReefPi) loadWorkflowSubsystem() error {
+	if !r.settings.Capabilities.Workflow {
+		return nil
+	}
+	w := workflow.New(r)
+	r.subsystems[workflow.Bucket] = w
+	return nil
+}
+
 func (r *ReefPi) loadMacroSubsystem() error {
 	if !r.settings.Capabilities.Macro {
 		return nil
@@ -202,6 +232,18 @@ func (r *ReefPi) loadSubsystems() error {
 		log.Println("ERROR: Failed to load ph subsystem. Error:", err)
 		r.LogError("subsystem-ph", "Failed to load ph subsystem. Error:"+err.Error())
 	}
+	if err := r.loadWaterSubsystem(); err != nil {
+		log.Println("ERROR: Failed to load water subsystem. Error:", err)
+		r.LogError("subsystem-water", "Failed to load water subsystem. Error:"+err.Error())
+	}
+	if err := r.loadJournalSubsystem(); err != nil {
+		log.Println("ERROR: Failed to load journal subsystem. Error:", err)
+		r.LogError("subsystem-journal", "Failed to load journal subsystem. Error:"+err.Error())
+	}
+	if err := r.loadWorkflowSubsystem(); err != nil {
+		log.Println("ERROR: Failed to load workflow subsystem. Error:", err)
+		r.LogError("subsystem-workflow", "Failed to load workflow subsystem. Error:"+err.Error())
+	}
 	if err := r.loadMacroSubsystem(); err != nil {
 		log.Println("ERROR: Failed to load macro subsystem. Error:", err)
 	}
@@ -16,6 +16,8 @@ func (c *Controller) LoadAPI(r *mux.Router) {
 	r.HandleFunc("/api/atos/leak/{id}", c.leak).Methods("POST")
 	r.HandleFunc("/api/atos/{id}", c.delete).Methods("DELETE")
 	r.HandleFunc("/api/atos/{id}/usage", c.getUsage).Methods("GET")
+	r.HandleFunc("/api/atos/{id}/reservoir", c.getReservoir).Methods("GET")
+	r.HandleFunc("/api/atos/{id}/refill", c.refill).Methods("POST")
 }
 
 func (c *Controller) get(w http.ResponseWriter, r *http.Request) {
@@ -71,3 +73,16 @@ func (c *Controller) getUsage(w http.ResponseWriter, req *http.Request) {
 	fn := func(id string) (interface{}, error) { return c.statsMgr.Get(id) }
 	utils.JSONGetResponse(fn, w, req)
 }
+
+func (c *Controller) getReservoir(w http.ResponseWriter, req *http.Request) {
+	fn := func(id string) (interface{}, error) { return c.ReservoirStatus(id) }
+	utils.JSONGetResponse(fn, w, req)
+}
+
+func (c *Controller) refill(w http.ResponseWriter, r *http.Request) {
+	var l RefillRequest
+	fn := func(id string) error {
+		return c.Refill(id, l.Level)
+	}
+	utils.JSONUpdateResponse(&l, fn, w, r)
+}
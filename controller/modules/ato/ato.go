@@ -18,6 +18,8 @@ type ATO struct {
 	ID             string        `json:"id"`
 	IsMacro        bool          `json:"is_macro"`
 	Inlet          string        `json:"inlet"`
+	HighInlet      string        `json:"high_inlet"`
+	MaxRun         int           `json:"max_run"`
 	Pump           string        `json:"pump"`
 	Period         time.Duration `json:"period"`
 	Control        bool          `json:"control"`
@@ -25,6 +27,17 @@ type ATO struct {
 	Notify         Notify        `json:"notify"`
 	Name           string        `json:"name"`
 	DisableOnAlert bool          `json:"disable_on_alert"`
+	Reservoir      Reservoir     `json:"reservoir"`
+}
+
+func (a ATO) validate() error {
+	if a.HighInlet != "" && a.HighInlet == a.Inlet {
+		return fmt.Errorf("High level sensor should differ from the primary sensor")
+	}
+	if a.MaxRun < 0 {
+		return fmt.Errorf("Maximum pump run can not be negative. Supplied:%d", a.MaxRun)
+	}
+	return a.Reservoir.Validate()
 }
 
 func (c *Controller) On(id string, b bool) error {
@@ -59,6 +72,9 @@ func (c *Controller) Create(a ATO) error {
 	if a.Period <= 0 {
 		return fmt.Errorf("Check period for ato controller must be greater than zero")
 	}
+	if err := a.validate(); err != nil {
+		return err
+	}
 	fn := func(id string) interface{} {
 		a.ID = id
 		return &a
@@ -67,6 +83,9 @@ func (c *Controller) Create(a ATO) error {
 		return err
 	}
 	c.statsMgr.Initialize(a.ID)
+	if err := c.initReservoir(a); err != nil {
+		return err
+	}
 	if a.Enable {
 		quit := make(chan struct{})
 		c.quitters[a.ID] = quit
@@ -82,9 +101,16 @@ func (c *Controller) Update(id string, a ATO) error {
 	if a.Period <= 0 {
 		return fmt.Errorf("Period should be positive. Supplied:%d", a.Period)
 	}
+	if err := a.validate(); err != nil {
+		return err
+	}
 	if err := c.c.Store().Update(Bucket, id, a); err != nil {
 		return err
 	}
+	if err := c.initReservoir(a); err != nil {
+		return err
+	}
+	delete(c.fills, a.ID)
 	quit, ok := c.quitters[a.ID]
 	if ok {
 		close(quit)
@@ -105,6 +131,12 @@ func (c *Controller) Delete(id string) error {
 	if err := c.c.Store().Delete(UsageBucket, id); err != nil {
 		log.Println("ERROR:  ato-subsystem: Failed to deleted usage details for ato:", id)
 	}
+	if err := c.c.Store().Delete(ReservoirBucket, id); err != nil {
+		log.Println("ERROR:  ato-subsystem: Failed to deleted reservoir level for ato:", id)
+	}
+	c.mu.Lock()
+	delete(c.fills, id)
+	c.mu.Unlock()
 	quit, ok := c.quitters[id]
 	if ok {
 		close(quit)
@@ -124,11 +156,18 @@ func (c *Controller) Check(a ATO) {
 	if err != nil {
 		log.Println("ERROR: ato-subsystem. Failed to read ato sensor. Error:", err)
 		c.c.LogError("ato-"+a.ID, "Failed to read ato sensor. Name:"+a.Name+". Error:"+err.Error())
+		if a.Control {
+			c.stop(a)
+		}
 		return
 	}
 	c.c.Telemetry().EmitMetric("ato", a.Name+"-state", float64(reading))
 	log.Println("ato-subsystem: sensor:", a.Name, "state:", reading)
 	if a.Control {
+		pump := c.safe(a, reading) && !c.reservoirEmpty(a)
+		if !pump {
+			reading = 1
+		}
 		if err := c.Control(a, reading); err != nil {
 			log.Println("ERROR: Failed to execute ato control logic. Error:", err)
 		}
@@ -136,6 +175,11 @@ func (c *Controller) Check(a ATO) {
 		if reading == 1 {
 			usage.Pump = 0
 		}
+		c.ran(a, usage.Pump)
+		if a.Reservoir.Enable {
+			usage.Volume = a.Reservoir.volume(usage.Pump)
+			c.drain(a, usage.Volume)
+		}
 	}
 	c.statsMgr.Update(a.ID, usage)
 	c.NotifyIfNeeded(a)
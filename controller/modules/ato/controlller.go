@@ -7,20 +7,21 @@ import (
 	"sync"
 
 	"github.com/reef-pi/reef-pi/controller"
-	"github.com/reef-pi/reef-pi/controller/connectors"
 	"github.com/reef-pi/reef-pi/controller/storage"
 	"github.com/reef-pi/reef-pi/controller/telemetry"
 )
 
 const Bucket = storage.ATOBucket
 const UsageBucket = storage.ATOUsageBucket
+const ReservoirBucket = storage.ATOReservoirBucket
 
 type Controller struct {
 	statsMgr telemetry.StatsManager
 	devMode  bool
 	quitters map[string]chan struct{}
 	mu       *sync.Mutex
-	inlets   *connectors.Inlets
+	inlets   InletReader
+	fills    map[string]*fill
 	c        controller.Controller
 }
 
@@ -30,6 +31,7 @@ func New(devMode bool, c controller.Controller) (*Controller, error) {
 		mu:       &sync.Mutex{},
 		inlets:   c.DM().Inlets(),
 		quitters: make(map[string]chan struct{}),
+		fills:    make(map[string]*fill),
 		statsMgr: c.Telemetry().NewStatsManager(UsageBucket),
 		c:        c,
 	}
@@ -46,7 +48,10 @@ func (c *Controller) Setup() error {
 	if err := c.c.Store().CreateBucket(Bucket); err != nil {
 		return err
 	}
-	return c.c.Store().CreateBucket(UsageBucket)
+	if err := c.c.Store().CreateBucket(UsageBucket); err != nil {
+		return err
+	}
+	return c.c.Store().CreateBucket(ReservoirBucket)
 }
 
 func (c *Controller) Start() {
@@ -127,7 +132,7 @@ func (c *Controller) InUse(depType, id string) ([]string, error) {
 			return deps, err
 		}
 		for _, a := range atos {
-			if a.Inlet == id {
+			if a.Inlet == id || a.HighInlet == id || (a.Reservoir.Enable && a.Reservoir.EmptyInlet == id) {
 				deps = append(deps, a.Name)
 			}
 		}
@@ -0,0 +1,209 @@
+package ato
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+)
+
+// Reservoir tracks the top off water left, estimating pumped volume from the
+// run time and flow rate (litres per minute) of the pump. Capacity and Low are
+// in litres. EmptyInlet optionally reads 1 when the reservoir is empty.
+type Reservoir struct {
+	Enable     bool    `json:"enable"`
+	FlowRate   float64 `json:"flow_rate"`
+	Capacity   float64 `json:"capacity"`
+	Low        float64 `json:"low"`
+	EmptyInlet string  `json:"empty_inlet"`
+}
+
+func (r Reservoir) Validate() error {
+	if !r.Enable {
+		return nil
+	}
+	if r.FlowRate <= 0 {
+		return fmt.Errorf("Pump flow rate should be positive. Supplied: %f", r.FlowRate)
+	}
+	if r.Capacity <= 0 {
+		return fmt.Errorf("Reservoir capacity should be positive. Supplied: %f", r.Capacity)
+	}
+	if r.Low < 0 || r.Low >= r.Capacity {
+		return fmt.Errorf("Low reservoir level should be between zero and capacity. Supplied: %f", r.Low)
+	}
+	return nil
+}
+
+// volume returns the litres pumped in the given seconds
+func (r Reservoir) volume(seconds int) float64 {
+	return r.FlowRate * float64(seconds) / 60
+}
+
+// ReservoirLevel is the estimated reservoir state, persisted across restarts
+type ReservoirLevel struct {
+	Level    float64   `json:"level"`
+	Empty    bool      `json:"empty"`
+	Refilled time.Time `json:"refilled"`
+}
+
+type ReservoirStatus struct {
+	ReservoirLevel
+	Capacity    float64 `json:"capacity"`
+	Percent     float64 `json:"percent"`
+	Evaporation float64 `json:"evaporation"`
+}
+
+func (c *Controller) level(id string) (ReservoirLevel, error) {
+	var l ReservoirLevel
+	return l, c.c.Store().Get(ReservoirBucket, id, &l)
+}
+
+// RefillRequest sets the reservoir level in litres, a missing level refills
+// the reservoir to capacity
+type RefillRequest struct {
+	Level *float64 `json:"level"`
+}
+
+// Refill sets the reservoir level in litres, nil means a full reservoir
+func (c *Controller) Refill(id string, level *float64) error {
+	a, err := c.Get(id)
+	if err != nil {
+		return err
+	}
+	if !a.Reservoir.Enable {
+		return fmt.Errorf("Reservoir tracking is not enabled for ato: '%s'", a.Name)
+	}
+	full := a.Reservoir.Capacity
+	if level == nil {
+		level = &full
+	}
+	if *level < 0 || *level > a.Reservoir.Capacity {
+		return fmt.Errorf("Reservoir level should be between zero and capacity. Supplied: %f", *level)
+	}
+	l := ReservoirLevel{Level: *level, Refilled: time.Now()}
+	log.Println("ato-subsystem: reservoir of", a.Name, "refilled to", *level, "litres")
+	return c.c.Store().Update(ReservoirBucket, id, l)
+}
+
+// Evaporation returns the litres pumped in the 24 hours before t
+func (c *Controller) Evaporation(id string, t time.Time) (float64, error) {
+	resp, err := c.statsMgr.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	var v float64
+	start := t.Add(-24 * time.Hour).Truncate(time.Hour)
+	for _, m := range resp.Historical {
+		u, ok := m.(Usage)
+		if !ok || time.Time(u.Time).Before(start) || time.Time(u.Time).After(t) {
+			continue
+		}
+		v += u.Volume
+	}
+	return telemetry.TwoDecimal(v), nil
+}
+
+func (c *Controller) ReservoirStatus(id string) (ReservoirStatus, error) {
+	var s ReservoirStatus
+	a, err := c.Get(id)
+	if err != nil {
+		return s, err
+	}
+	if !a.Reservoir.Enable {
+		return s, fmt.Errorf("Reservoir tracking is not enabled for ato: '%s'", a.Name)
+	}
+	l, err := c.level(id)
+	if err != nil {
+		return s, err
+	}
+	s.ReservoirLevel = l
+	s.Capacity = a.Reservoir.Capacity
+	s.Percent = telemetry.TwoDecimal(100 * l.Level / a.Reservoir.Capacity)
+	if e, err := c.Evaporation(id, time.Now()); err == nil {
+		s.Evaporation = e
+	}
+	return s, nil
+}
+
+// reservoirEmpty returns true when the pump should not run, either as the
+// estimated level is zero or the reservoir-empty inlet is active. An alert is
+// sent when the reservoir turns empty.
+func (c *Controller) reservoirEmpty(a ATO) bool {
+	if !a.Reservoir.Enable {
+		return false
+	}
+	l, err := c.level(a.ID)
+	if err != nil {
+		log.Println("ERROR: ato-subsystem: Failed to get reservoir level of:", a.Name, "Error:", err)
+		return false
+	}
+	empty := l.Level <= 0
+	if a.Reservoir.EmptyInlet != "" {
+		v, err := c.inlets.Read(a.Reservoir.EmptyInlet)
+		if err != nil {
+			log.Println("ERROR: ato-subsystem: Failed to read reservoir sensor of:", a.Name, "Error:", err)
+			c.c.LogError("ato-"+a.ID, "Failed to read reservoir sensor. Name:"+a.Name+". Error:"+err.Error())
+		} else if v == 1 {
+			empty = true
+		}
+	}
+	if empty == l.Empty {
+		return empty
+	}
+	l.Empty = empty
+	if err := c.c.Store().Update(ReservoirBucket, a.ID, l); err != nil {
+		log.Println("ERROR: ato-subsystem: Failed to update reservoir level of:", a.Name, "Error:", err)
+	}
+	if empty {
+		log.Println("WARNING: ato-subsystem: reservoir of", a.Name, "is empty. Pump will not run")
+		subject := fmt.Sprintf("[Reef-Pi ALERT] ATO reservoir for '%s' is empty", a.Name)
+		c.c.Telemetry().Alert(subject, "ATO pump is stopped until the reservoir is refilled.")
+	}
+	return empty
+}
+
+// drain lowers the reservoir level by the pumped volume, alerting when it drops
+// below the low level
+func (c *Controller) drain(a ATO, volume float64) {
+	if !a.Reservoir.Enable || volume <= 0 {
+		return
+	}
+	l, err := c.level(a.ID)
+	if err != nil {
+		log.Println("ERROR: ato-subsystem: Failed to get reservoir level of:", a.Name, "Error:", err)
+		return
+	}
+	before := l.Level
+	// millilitre precision avoids a reservoir that never quite empties
+	l.Level = math.Round((l.Level-volume)*1000) / 1000
+	if l.Level < 0 {
+		l.Level = 0
+	}
+	if err := c.c.Store().Update(ReservoirBucket, a.ID, l); err != nil {
+		log.Println("ERROR: ato-subsystem: Failed to update reservoir level of:", a.Name, "Error:", err)
+		return
+	}
+	c.c.Telemetry().EmitMetric("ato", a.Name+"-reservoir", l.Level)
+	if before >= a.Reservoir.Low && l.Level < a.Reservoir.Low {
+		log.Println("WARNING: ato-subsystem: reservoir of", a.Name, "is low. Sending alert")
+		subject := fmt.Sprintf("[Reef-Pi ALERT] ATO reservoir for '%s' is low", a.Name)
+		format := "Estimated reservoir level (%.2f litres) for sensor '%s' is below acceptable value (%.2f litres)"
+		c.c.Telemetry().Alert(subject, fmt.Sprintf(format, l.Level, a.Name, a.Reservoir.Low))
+	}
+}
+
+// initReservoir starts tracking a full reservoir, keeping the level of an
+// already tracked one
+func (c *Controller) initReservoir(a ATO) error {
+	if !a.Reservoir.Enable {
+		return nil
+	}
+	if l, err := c.level(a.ID); err == nil {
+		if l.Level <= a.Reservoir.Capacity {
+			return nil
+		}
+	}
+	return c.c.Store().Update(ReservoirBucket, a.ID, ReservoirLevel{Level: a.Reservoir.Capacity, Refilled: time.Now()})
+}
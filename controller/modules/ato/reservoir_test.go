@@ -0,0 +1,234 @@
+package ato
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/modules/equipment"
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+type telemetryStub struct {
+	telemetry.Telemetry
+	alerts []string
+}
+
+func (t *telemetryStub) Alert(subject, _ string) (bool, error) {
+	t.alerts = append(t.alerts, subject)
+	return true, nil
+}
+
+type testController struct {
+	controller.Controller
+	t   *telemetryStub
+	sub controller.Subsystem
+}
+
+func (c *testController) Telemetry() telemetry.Telemetry {
+	return c.t
+}
+
+func (c *testController) Subsystem(_ string) (controller.Subsystem, error) {
+	return c.sub, nil
+}
+
+// newTestATO sets up a pump on equipment 1 and inlets with the given reverse
+// settings, dev mode inlets read 0 unless reversed
+func newTestATO(t *testing.T, reverse ...bool) (*Controller, *telemetryStub, *utils.TestRouter) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { con.Store().Close() })
+	stub := &telemetryStub{Telemetry: con.Telemetry()}
+	tc := &testController{Controller: con, t: stub, sub: controller.NoopSubsystem()}
+	drvrs := drivers.TestDrivers(con.Store())
+	outlets := connectors.NewOutlets(drvrs, con.Store())
+	outlets.DevMode = true
+	if err := outlets.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	inlets := connectors.NewInlets(drvrs, con.Store())
+	if err := inlets.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	eqs := equipment.New(equipment.Config{DevMode: true}, con)
+	if err := eqs.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := outlets.Create(connectors.Outlet{Name: "ato-outlet", Pin: 21, Driver: "rpi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := eqs.Create(equipment.Equipment{Name: "ato-pump", Outlet: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range reverse {
+		if err := inlets.Create(connectors.Inlet{Name: "inlet", Pin: 16 + i, Driver: "rpi", Reverse: r}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := New(true, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	return c, stub, tr
+}
+
+func TestReservoir(t *testing.T) {
+	// inlet 1: ato sensor reads 0 (top off needed), inlet 2: reservoir sensor reads 0 (not empty)
+	c, stub, tr := newTestATO(t, false, false)
+	a := ATO{
+		Name:    "ato",
+		Inlet:   "1",
+		Pump:    "1",
+		Period:  2,
+		Control: true,
+		Reservoir: Reservoir{
+			Enable:   true,
+			FlowRate: 6,
+			Capacity: 1,
+			Low:      0.5,
+		},
+	}
+	if err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	a.ID = "1"
+	a.Enable = true
+	var s ReservoirStatus
+	if err := tr.Do("GET", "/api/atos/1/reservoir", new(bytes.Buffer), &s); err != nil {
+		t.Fatal("Failed to get reservoir status using api. Error:", err)
+	}
+	if s.Level != 1 || s.Percent != 100 {
+		t.Error("New reservoir should be full, found:", s)
+	}
+
+	// every check pumps 0.2 litres
+	for i := 0; i < 3; i++ {
+		c.Check(a)
+	}
+	s, err := c.ReservoirStatus("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Level < 0.39 || s.Level > 0.41 || s.Evaporation != 0.6 {
+		t.Error("Expected 0.4 litres left and 0.6 litres evaporated, found:", s)
+	}
+	if len(stub.alerts) != 1 || !strings.Contains(stub.alerts[0], "is low") {
+		t.Error("Expected a single low reservoir alert, found:", stub.alerts)
+	}
+	for i := 0; i < 3; i++ {
+		c.Check(a)
+	}
+	s, _ = c.ReservoirStatus("1")
+	if s.Level != 0 || !s.Empty {
+		t.Error("Reservoir should be empty, found:", s)
+	}
+	if len(stub.alerts) != 2 || !strings.Contains(stub.alerts[1], "is empty") {
+		t.Error("Expected an empty reservoir alert, found:", stub.alerts)
+	}
+	u, err := c.statsMgr.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := u.Current[len(u.Current)-1].(Usage); last.Pump != 0 || last.Volume != 0 {
+		t.Error("Pump should not run with an empty reservoir, found usage:", last)
+	}
+	if e, _ := c.Evaporation("1", time.Now()); e != 1 {
+		t.Error("Expected 1 litre evaporated, found:", e)
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(ReservoirLevel{Level: 0.8})
+	if err := tr.Do("POST", "/api/atos/1/refill", body, nil); err != nil {
+		t.Fatal("Failed to refill reservoir using api. Error:", err)
+	}
+	s, _ = c.ReservoirStatus("1")
+	if s.Level != 0.8 || s.Empty {
+		t.Error("Reservoir should be refilled, found:", s)
+	}
+	above := 2.0
+	if err := c.Refill("1", &above); err == nil {
+		t.Error("Refill above capacity should fail")
+	}
+	body.Reset()
+	body.WriteString("{}")
+	if err := tr.Do("POST", "/api/atos/1/refill", body, nil); err != nil {
+		t.Fatal("Failed to refill reservoir using api. Error:", err)
+	}
+	if s, _ = c.ReservoirStatus("1"); s.Level != s.Capacity {
+		t.Error("Refill without level should fill the reservoir to capacity, found:", s)
+	}
+	empty := 0.0
+	if err := c.Refill("1", &empty); err != nil {
+		t.Error(err)
+	}
+	if s, _ = c.ReservoirStatus("1"); s.Level != 0 {
+		t.Error("Refill to zero should leave the reservoir empty, found:", s)
+	}
+	level := 0.8
+	if err := c.Refill("1", &level); err != nil {
+		t.Error(err)
+	}
+
+	a.Reservoir.EmptyInlet = "2"
+	if deps, _ := c.InUse("inlets", "2"); len(deps) != 0 {
+		t.Error("Reservoir sensor should not be used yet, found:", deps)
+	}
+	if err := c.Update("1", a); err != nil {
+		t.Fatal(err)
+	}
+	if deps, _ := c.InUse("inlets", "2"); len(deps) != 1 {
+		t.Error("Reservoir sensor should be in use, found:", deps)
+	}
+	if s, _ = c.ReservoirStatus("1"); s.Level != 0.8 {
+		t.Error("Updating the ato should keep the reservoir level, found:", s.Level)
+	}
+	a.Reservoir.Capacity = 0
+	if err := c.Update("1", a); err == nil {
+		t.Error("Reservoir without capacity should fail validation")
+	}
+	c.Stop()
+}
+
+func TestReservoirEmptyInlet(t *testing.T) {
+	// reversed reservoir sensor reads 1, i.e. empty
+	c, stub, _ := newTestATO(t, false, true)
+	a := ATO{
+		Name:      "ato",
+		Inlet:     "1",
+		Pump:      "1",
+		Period:    2,
+		Control:   true,
+		Reservoir: Reservoir{Enable: true, FlowRate: 1, Capacity: 10, EmptyInlet: "2"},
+	}
+	if err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	a.ID = "1"
+	a.Enable = true
+	c.Check(a)
+	c.Check(a)
+	s, err := c.ReservoirStatus("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Level != 10 || !s.Empty {
+		t.Error("Pump should not run while the reservoir sensor reports empty, found:", s)
+	}
+	if len(stub.alerts) != 1 {
+		t.Error("Expected a single empty reservoir alert, found:", stub.alerts)
+	}
+}
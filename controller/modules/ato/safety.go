@@ -0,0 +1,106 @@
+package ato
+
+import (
+	"fmt"
+	"log"
+)
+
+// InletReader reads digital inputs, satisfied by connectors.Inlets
+type InletReader interface {
+	Read(string) (int, error)
+}
+
+// fill tracks the pump run of an ATO since its primary sensor last reported
+// full
+type fill struct {
+	run      int
+	tripped  bool
+	conflict bool
+}
+
+func (c *Controller) fill(id string) *fill {
+	f, ok := c.fills[id]
+	if !ok {
+		f = new(fill)
+		c.fills[id] = f
+	}
+	return f
+}
+
+// safe decides if the pump may run given the primary sensor reading. The
+// high-level inlet forces the pump off regardless of the primary sensor, and
+// once the pump ran for MaxRun seconds in a fill it stays off until the primary
+// sensor reports full. Alerts are sent when the sensors start disagreeing and
+// when the maximum run is reached.
+func (c *Controller) safe(a ATO, reading int) bool {
+	high := 0
+	if a.HighInlet != "" {
+		v, err := c.inlets.Read(a.HighInlet)
+		if err != nil {
+			log.Println("ERROR: ato-subsystem. Failed to read high level sensor. Error:", err)
+			c.c.LogError("ato-"+a.ID, "Failed to read high level sensor. Name:"+a.Name+". Error:"+err.Error())
+			// assume high water, the pump must not run unguarded
+			v = 1
+		}
+		high = v
+	}
+	c.mu.Lock()
+	f := c.fill(a.ID)
+	conflict := high == 1 && reading != 1
+	raise := conflict && !f.conflict
+	f.conflict = conflict
+	if reading == 1 {
+		f.run = 0
+		f.tripped = false
+	}
+	pump := reading != 1 && high != 1
+	trip := false
+	if pump && a.MaxRun > 0 {
+		if !f.tripped && f.run+int(a.Period) > a.MaxRun {
+			f.tripped = true
+			trip = true
+		}
+		pump = !f.tripped
+	}
+	run := f.run
+	c.mu.Unlock()
+
+	if raise {
+		log.Println("WARNING: ato-subsystem: high level sensor of", a.Name, "is active while the primary sensor reports low water")
+		c.c.LogError("ato-"+a.ID, "High level sensor active while primary sensor reports low water. Name:"+a.Name)
+		subject := fmt.Sprintf("[Reef-Pi ALERT] ATO sensors for '%s' disagree", a.Name)
+		c.c.Telemetry().Alert(subject, "High level sensor is active while the primary sensor reports low water. Pump is stopped, check the primary sensor.")
+	}
+	if trip {
+		log.Println("WARNING: ato-subsystem: pump of", a.Name, "reached maximum run without the sensor reporting full")
+		subject := fmt.Sprintf("[Reef-Pi ALERT] ATO pump for '%s' ran too long", a.Name)
+		format := "Pump ran for %d seconds without sensor '%s' reporting full, maximum is %d. Pump is stopped until the sensor reports full."
+		c.c.Telemetry().Alert(subject, fmt.Sprintf(format, run, a.Name, a.MaxRun))
+	}
+	return pump
+}
+
+// ran records pump run time of the current fill
+func (c *Controller) ran(a ATO, seconds int) {
+	c.mu.Lock()
+	c.fill(a.ID).run += seconds
+	c.mu.Unlock()
+}
+
+// stop forces the pump off while the primary sensor can not be read, the water
+// level is unknown and only the high-level inlet is left to report on it
+func (c *Controller) stop(a ATO) {
+	if a.HighInlet != "" {
+		v, err := c.inlets.Read(a.HighInlet)
+		switch {
+		case err != nil:
+			log.Println("ERROR: ato-subsystem. Failed to read high level sensor. Error:", err)
+			c.c.LogError("ato-"+a.ID, "Failed to read high level sensor. Name:"+a.Name+". Error:"+err.Error())
+		case v == 1:
+			log.Println("WARNING: ato-subsystem: high level sensor of", a.Name, "is active")
+		}
+	}
+	if err := c.Control(a, 1); err != nil {
+		log.Println("ERROR: ato-subsystem. Failed to stop pump. Error:", err)
+	}
+}
@@ -0,0 +1,156 @@
+package ato
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+type mockInlets map[string]int
+
+func (m mockInlets) Read(id string) (int, error) {
+	v, ok := m[id]
+	if !ok {
+		return 0, fmt.Errorf("inlet '%s' does not exist", id)
+	}
+	return v, nil
+}
+
+func pumped(t *testing.T, c *Controller, id string) int {
+	t.Helper()
+	u, err := c.statsMgr.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Current[len(u.Current)-1].(Usage).Pump
+}
+
+func TestHighLevelCutoff(t *testing.T) {
+	c, stub, _ := newTestATO(t)
+	inlets := mockInlets{"primary": 0, "high": 0}
+	c.inlets = inlets
+	a := ATO{Name: "ato", Inlet: "primary", HighInlet: "high", Pump: "1", Period: 5, Control: true}
+	if err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	a.ID = "1"
+	a.Enable = true
+
+	c.Check(a)
+	if pumped(t, c, "1") != 5 {
+		t.Error("Pump should run when both sensors report low water")
+	}
+	// primary sensor stuck on low water
+	inlets["high"] = 1
+	c.Check(a)
+	c.Check(a)
+	if pumped(t, c, "1") != 0 {
+		t.Error("High level sensor should force the pump off")
+	}
+	if len(stub.alerts) != 1 || !strings.Contains(stub.alerts[0], "disagree") {
+		t.Error("Expected a single sensor disagreement alert, found:", stub.alerts)
+	}
+	inlets["primary"] = 1
+	c.Check(a)
+	inlets["high"] = 0
+	inlets["primary"] = 0
+	c.Check(a)
+	if pumped(t, c, "1") != 5 {
+		t.Error("Pump should run again once sensors agree")
+	}
+	inlets["high"] = 1
+	c.Check(a)
+	if len(stub.alerts) != 2 {
+		t.Error("Sensors disagreeing again should raise another alert, found:", stub.alerts)
+	}
+
+	delete(inlets, "high")
+	inlets["primary"] = 0
+	c.Check(a)
+	if pumped(t, c, "1") != 0 {
+		t.Error("Pump should stay off when the high level sensor can not be read")
+	}
+	if deps, _ := c.InUse("inlets", "high"); len(deps) != 1 {
+		t.Error("High level sensor should be in use, found:", deps)
+	}
+	a.HighInlet = a.Inlet
+	if err := c.Update("1", a); err == nil {
+		t.Error("High level sensor same as the primary one should fail validation")
+	}
+}
+
+func TestMaxRun(t *testing.T) {
+	c, stub, _ := newTestATO(t)
+	inlets := mockInlets{"primary": 0}
+	c.inlets = inlets
+	a := ATO{Name: "ato", Inlet: "primary", Pump: "1", Period: 5, MaxRun: 12, Control: true}
+	if err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	a.ID = "1"
+	a.Enable = true
+
+	for i, expected := range []int{5, 5, 0, 0} {
+		c.Check(a)
+		if p := pumped(t, c, "1"); p != expected {
+			t.Error("Check", i, "expected pump run", expected, "found:", p)
+		}
+	}
+	if len(stub.alerts) != 1 || !strings.Contains(stub.alerts[0], "ran too long") {
+		t.Error("Expected a single maximum run alert, found:", stub.alerts)
+	}
+	// fill completes, next fill starts over
+	inlets["primary"] = 1
+	c.Check(a)
+	inlets["primary"] = 0
+	c.Check(a)
+	if pumped(t, c, "1") != 5 {
+		t.Error("Pump should run in a new fill")
+	}
+	c.Check(a)
+	c.Check(a)
+	if pumped(t, c, "1") != 0 || len(stub.alerts) != 2 {
+		t.Error("Maximum run should apply to every fill. Alerts:", stub.alerts)
+	}
+	if err := c.Update("1", a); err != nil {
+		t.Fatal(err)
+	}
+	c.Check(a)
+	if pumped(t, c, "1") != 5 {
+		t.Error("Updating the ato should reset the fill")
+	}
+	a.MaxRun = -1
+	if err := c.Update("1", a); err == nil {
+		t.Error("Negative maximum run should fail validation")
+	}
+	c.Stop()
+}
+
+func TestUnreadablePrimarySensor(t *testing.T) {
+	c, _, _ := newTestATO(t)
+	inlets := mockInlets{"high": 0}
+	c.inlets = inlets
+	a := ATO{Name: "ato", Inlet: "primary", HighInlet: "high", Pump: "1", Period: 5, Control: true}
+	if err := c.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	a.ID = "1"
+	a.Enable = true
+	sub, err := c.c.Subsystem(storage.EquipmentBucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.On("1", true); err != nil {
+		t.Fatal(err)
+	}
+	c.Check(a)
+	on, err := sub.(interface{ Get(string) (bool, error) }).Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on {
+		t.Error("Pump should be switched off when the primary sensor can not be read")
+	}
+}
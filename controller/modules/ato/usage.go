@@ -3,20 +3,25 @@ package ato
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/reef-pi/reef-pi/controller/telemetry"
 )
 
+// Usage is the pump run time in seconds and, with reservoir tracking, the
+// estimated volume pumped in litres
 type Usage struct {
-	Pump int                `json:"pump"`
-	Time telemetry.TeleTime `json:"time"`
+	Pump   int                `json:"pump"`
+	Volume float64            `json:"volume"`
+	Time   telemetry.TeleTime `json:"time"`
 }
 
 func (u1 Usage) Rollup(ux telemetry.Metric) (telemetry.Metric, bool) {
 	u2 := ux.(Usage)
-	u := Usage{Time: u1.Time, Pump: u1.Pump}
+	u := Usage{Time: u1.Time, Pump: u1.Pump, Volume: u1.Volume}
 	if u1.Time.Hour() == u2.Time.Hour() {
 		u.Pump += u2.Pump
+		u.Volume += u2.Volume
 		return u, false
 	}
 	return u2, true
@@ -44,6 +49,11 @@ func (c *Controller) NotifyIfNeeded(a ATO) {
 	}
 	c.c.Telemetry().EmitMetric("ato", a.Name+"-usage", float64(u.Pump))
 	log.Println("ato-subsystem: sensor:", a.Name, " usage:", float64(u.Pump))
+	if a.Reservoir.Enable {
+		if e, err := c.Evaporation(a.ID, time.Now()); err == nil {
+			c.c.Telemetry().EmitMetric("ato", a.Name+"-evaporation", e)
+		}
+	}
 	if !a.Notify.Enable {
 		return
 	}
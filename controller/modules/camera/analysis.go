@@ -0,0 +1,253 @@
+package camera
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	BrightnessMetric = "brightness"
+	GreenRatioMetric = "green_ratio"
+	RedMetric        = "red"
+	GreenMetric      = "green"
+	BlueMetric       = "blue"
+
+	HistogramBins  = 16
+	_analysisWidth = 320
+)
+
+// Region of interest, as fractions of the image width and height. A region
+// without width or height covers the whole image.
+type Region struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (r Region) Validate() error {
+	if r.X < 0 || r.Y < 0 || r.Width < 0 || r.Height < 0 {
+		return fmt.Errorf("Region of interest can not be negative")
+	}
+	if r.X+r.Width > 1 || r.Y+r.Height > 1 {
+		return fmt.Errorf("Region of interest should be within the image")
+	}
+	return nil
+}
+
+func (r Region) rect(b image.Rectangle) image.Rectangle {
+	if r.Width == 0 || r.Height == 0 {
+		return b
+	}
+	x := b.Min.X + int(r.X*float64(b.Dx()))
+	y := b.Min.Y + int(r.Y*float64(b.Dy()))
+	roi := image.Rect(x, y, x+int(r.Width*float64(b.Dx())), y+int(r.Height*float64(b.Dy())))
+	if roi.Empty() {
+		return image.Rect(x, y, x+1, y+1).Intersect(b)
+	}
+	return roi
+}
+
+// Threshold raises an alert when a metric of an image is below Min or above
+// Max. A zero Max disables the upper bound. Camera limits the threshold to
+// images of one camera, Start and End (HH:MM) to a time window of the day,
+// e.g. when the lights should be on.
+type Threshold struct {
+	Metric string  `json:"metric"`
+	Camera string  `json:"camera"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Start  string  `json:"start"`
+	End    string  `json:"end"`
+}
+
+func (t Threshold) Validate() error {
+	if _, err := (Metrics{}).value(t.Metric); err != nil {
+		return err
+	}
+	if t.Max != 0 && t.Max < t.Min {
+		return fmt.Errorf("Threshold maximum is below its minimum")
+	}
+	if (t.Start == "") != (t.End == "") {
+		return fmt.Errorf("Threshold time window needs both start and end")
+	}
+	for _, s := range []string{t.Start, t.End} {
+		if s == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", s); err != nil {
+			return fmt.Errorf("Invalid threshold time '%s'. Expected HH:MM", s)
+		}
+	}
+	return nil
+}
+
+// active returns true when t is within the time window of the threshold,
+// windows can wrap around midnight
+func (t Threshold) active(now time.Time) bool {
+	if t.Start == "" {
+		return true
+	}
+	start, err1 := time.Parse("15:04", t.Start)
+	end, err2 := time.Parse("15:04", t.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	s := start.Hour()*60 + start.Minute()
+	e := end.Hour()*60 + end.Minute()
+	if s <= e {
+		return m >= s && m < e
+	}
+	return m >= s || m < e
+}
+
+// Analysis computes metrics of every processed image
+type Analysis struct {
+	Enable     bool        `json:"enable"`
+	Region     Region      `json:"region"`
+	Thresholds []Threshold `json:"thresholds"`
+}
+
+func (a Analysis) Validate() error {
+	if err := a.Region.Validate(); err != nil {
+		return err
+	}
+	for _, t := range a.Thresholds {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Histogram struct {
+	Red   []int `json:"red"`
+	Green []int `json:"green"`
+	Blue  []int `json:"blue"`
+}
+
+// Metrics of an image. Brightness is the mean luma (0-255), Red, Green and Blue
+// the channel means (0-255), all over the whole image. GreenRatio is the share of
+// green in the region of interest, 1/3 for neutral colors.
+type Metrics struct {
+	Brightness float64   `json:"brightness"`
+	Red        float64   `json:"red"`
+	Green      float64   `json:"green"`
+	Blue       float64   `json:"blue"`
+	GreenRatio float64   `json:"green_ratio"`
+	Histogram  Histogram `json:"histogram"`
+}
+
+func (m Metrics) value(metric string) (float64, error) {
+	switch metric {
+	case BrightnessMetric:
+		return m.Brightness, nil
+	case GreenRatioMetric:
+		return m.GreenRatio, nil
+	case RedMetric:
+		return m.Red, nil
+	case GreenMetric:
+		return m.Green, nil
+	case BlueMetric:
+		return m.Blue, nil
+	}
+	return 0, fmt.Errorf("Unknown image metric: '%s'", metric)
+}
+
+func rgb(img image.Image, x, y int) (float64, float64, float64) {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return float64(r >> 8), float64(g >> 8), float64(b >> 8)
+}
+
+// analyze computes the metrics of an image, large images are scaled down first
+func analyze(img image.Image, region Region) Metrics {
+	if img.Bounds().Dx() > _analysisWidth {
+		img = resize.Resize(_analysisWidth, 0, img, resize.Bilinear)
+	}
+	m := Metrics{
+		Histogram: Histogram{
+			Red:   make([]int, HistogramBins),
+			Green: make([]int, HistogramBins),
+			Blue:  make([]int, HistogramBins),
+		},
+	}
+	b := img.Bounds()
+	n := float64(b.Dx() * b.Dy())
+	if n == 0 {
+		return m
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl := rgb(img, x, y)
+			m.Red += r
+			m.Green += g
+			m.Blue += bl
+			m.Histogram.Red[int(r)*HistogramBins/256]++
+			m.Histogram.Green[int(g)*HistogramBins/256]++
+			m.Histogram.Blue[int(bl)*HistogramBins/256]++
+		}
+	}
+	m.Red /= n
+	m.Green /= n
+	m.Blue /= n
+	// ITU-R BT.601 luma
+	m.Brightness = 0.299*m.Red + 0.587*m.Green + 0.114*m.Blue
+
+	var sum, green float64
+	roi := region.rect(b)
+	for y := roi.Min.Y; y < roi.Max.Y; y++ {
+		for x := roi.Min.X; x < roi.Max.X; x++ {
+			r, g, bl := rgb(img, x, y)
+			sum += r + g + bl
+			green += g
+		}
+	}
+	if sum > 0 {
+		m.GreenRatio = green / sum
+	}
+	return m
+}
+
+func (c *Controller) emitMetrics(camera string, m Metrics) {
+	prefix := ""
+	if camera != "" {
+		prefix = camera + "_"
+	}
+	for _, metric := range []string{BrightnessMetric, GreenRatioMetric, RedMetric, GreenMetric, BlueMetric} {
+		v, _ := m.value(metric)
+		c.c.Telemetry().EmitMetric("camera", prefix+metric, v)
+	}
+}
+
+// checkThresholds alerts on every active threshold the metrics violate and
+// returns the violated thresholds
+func (c *Controller) checkThresholds(camera string, m Metrics, thresholds []Threshold, now time.Time) []Threshold {
+	var violated []Threshold
+	for _, t := range thresholds {
+		if (t.Camera != "" && t.Camera != camera) || !t.active(now) {
+			continue
+		}
+		v, err := m.value(t.Metric)
+		if err != nil {
+			continue
+		}
+		if v >= t.Min && (t.Max == 0 || v <= t.Max) {
+			continue
+		}
+		violated = append(violated, t)
+		name := camera
+		if name == "" {
+			name = "default"
+		}
+		subject := fmt.Sprintf("[Reef-Pi ALERT] camera '%s' %s out of range", name, t.Metric)
+		body := fmt.Sprintf("Image %s of camera '%s' (%f) is out of acceptable range ( %f - %f )", t.Metric, name, v, t.Min, t.Max)
+		log.Println("camera subsystem:", body)
+		c.c.Telemetry().Alert(subject, body)
+	}
+	return violated
+}
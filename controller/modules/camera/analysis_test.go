@@ -0,0 +1,146 @@
+package camera
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+)
+
+type telemetryStub struct {
+	telemetry.Telemetry
+	metrics map[string]float64
+	alerts  []string
+}
+
+func (t *telemetryStub) EmitMetric(module, name string, v float64) {
+	t.metrics[module+"-"+name] = v
+}
+
+func (t *telemetryStub) Alert(subject, _ string) (bool, error) {
+	t.alerts = append(t.alerts, subject)
+	return true, nil
+}
+
+type telemetryController struct {
+	controller.Controller
+	t *telemetryStub
+}
+
+func (c *telemetryController) Telemetry() telemetry.Telemetry {
+	return c.t
+}
+
+func TestAnalyze(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 100, G: 100, B: 100, A: 255}), image.Point{}, draw.Src)
+	// algae covers the right half
+	draw.Draw(img, image.Rect(200, 0, 400, 200), image.NewUniform(color.RGBA{G: 200, A: 255}), image.Point{}, draw.Src)
+
+	m := analyze(img, Region{})
+	if math.Abs(m.Green-150) > 1 || math.Abs(m.Red-50) > 1 {
+		t.Error("Unexpected channel means. Red:", m.Red, "Green:", m.Green)
+	}
+	if math.Abs(m.Brightness-(0.299*50+0.587*150+0.114*50)) > 1 {
+		t.Error("Unexpected brightness:", m.Brightness)
+	}
+	if math.Abs(m.GreenRatio-0.6) > 0.01 {
+		t.Error("Unexpected green ratio of the whole image:", m.GreenRatio)
+	}
+	total := 0
+	for _, n := range m.Histogram.Green {
+		total += n
+	}
+	// scaled to 320x160 before analysis
+	if len(m.Histogram.Green) != HistogramBins || total != 320*160 || m.Histogram.Blue[0] == 0 {
+		t.Error("Unexpected histogram:", m.Histogram.Green)
+	}
+
+	m = analyze(img, Region{X: 0.5, Width: 0.5, Height: 1})
+	if math.Abs(m.GreenRatio-1) > 0.01 {
+		t.Error("Expected green ratio of the region of interest to be 1, found:", m.GreenRatio)
+	}
+	m = analyze(img, Region{Width: 0.25, Height: 0.5})
+	if math.Abs(m.GreenRatio-1.0/3) > 0.01 {
+		t.Error("Expected neutral green ratio of the region of interest, found:", m.GreenRatio)
+	}
+	if err := (Region{X: 0.5, Width: 0.6}).Validate(); err == nil {
+		t.Error("Region outside the image should fail validation")
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	c, _ := newTestCamera(t)
+	stub := &telemetryStub{metrics: make(map[string]float64)}
+	c.c = &telemetryController{Controller: c.c, t: stub}
+	c.config.Analysis = Analysis{
+		Enable: true,
+		Thresholds: []Threshold{
+			{Metric: BrightnessMetric, Min: 40, Start: "10:00", End: "20:00"},
+			{Metric: GreenRatioMetric, Max: 0.5, Camera: "top"},
+		},
+	}
+	name := "dark.png"
+	out, err := os.Create(filepath.Join(c.config.ImageDirectory, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(out, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	if err := c.process("top", name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stub.metrics["camera-top_brightness"]; !ok {
+		t.Error("Image metrics should be emitted, found:", stub.metrics)
+	}
+	items, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Metrics == nil || items[0].Metrics.Brightness != 0 {
+		t.Error("Image metrics should be stored with the image, found:", items)
+	}
+
+	stub.alerts = nil
+	noon := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	dark := Metrics{Brightness: 10, GreenRatio: 0.3}
+	if v := c.checkThresholds("top", dark, c.config.Analysis.Thresholds, noon); len(v) != 1 || v[0].Metric != BrightnessMetric {
+		t.Error("Dark image should violate the brightness threshold while lights are on, found:", v)
+	}
+	if v := c.checkThresholds("top", dark, c.config.Analysis.Thresholds, noon.Add(10*time.Hour)); len(v) != 0 {
+		t.Error("Dark image should be fine at night, found:", v)
+	}
+	algae := Metrics{Brightness: 120, GreenRatio: 0.6}
+	if v := c.checkThresholds("", algae, c.config.Analysis.Thresholds, noon); len(v) != 0 {
+		t.Error("Green ratio threshold should only apply to camera top, found:", v)
+	}
+	if v := c.checkThresholds("top", algae, c.config.Analysis.Thresholds, noon); len(v) != 1 || v[0].Metric != GreenRatioMetric {
+		t.Error("Green image should violate the green ratio threshold, found:", v)
+	}
+	if len(stub.alerts) != 2 {
+		t.Error("Expected 2 alerts, found:", stub.alerts)
+	}
+	if !(Threshold{Start: "22:00", End: "02:00"}).active(noon.Add(13 * time.Hour)) {
+		t.Error("Threshold windows should wrap around midnight")
+	}
+
+	conf := c.config
+	conf.Analysis.Thresholds = []Threshold{{Metric: "contrast"}}
+	if err := saveConfig(c.c.Store(), conf); err == nil {
+		t.Error("Unknown metric should fail validation")
+	}
+	conf.Analysis.Thresholds = []Threshold{{Metric: BrightnessMetric, Start: "25:00", End: "02:00"}}
+	if err := saveConfig(c.c.Store(), conf); err == nil {
+		t.Error("Invalid threshold window should fail validation")
+	}
+}
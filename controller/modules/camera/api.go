@@ -1,7 +1,10 @@
 package camera
 
 import (
+	"bytes"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
@@ -14,12 +17,18 @@ func (c *Controller) LoadAPI(r *mux.Router) {
 	r.HandleFunc("/api/camera/shoot", c.shoot).Methods("POST")
 	r.HandleFunc("/api/camera/latest", c.latest).Methods("GET")
 	r.HandleFunc("/api/camera/list", c.list).Methods("GET")
+	r.HandleFunc("/api/camera/timelapse", c.timelapse).Methods("GET")
+	r.HandleFunc("/api/camera/uploads", c.listUploads).Methods("GET")
+	r.HandleFunc("/api/camera/uploads/retry", c.retry).Methods("POST")
 
 }
 
 func (c *Controller) get(w http.ResponseWriter, r *http.Request) {
 	fn := func(_ string) (interface{}, error) {
-		return c.config, nil
+		c.mu.Lock()
+		conf := c.config
+		c.mu.Unlock()
+		return conf.redacted(), nil
 	}
 	utils.JSONGetResponse(fn, w, r)
 }
@@ -31,10 +40,23 @@ func (c *Controller) list(w http.ResponseWriter, r *http.Request) {
 	utils.JSONListResponse(fn, w, r)
 }
 
+func (c *Controller) listUploads(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.Uploads()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Controller) retry(w http.ResponseWriter, r *http.Request) {
+	if err := c.flushUploads(); err != nil {
+		utils.ErrorResponse(http.StatusInternalServerError, "Failed to upload queued images. Error: "+err.Error(), w)
+	}
+}
+
 func (c *Controller) shoot(w http.ResponseWriter, r *http.Request) {
 	fn := func(_ string) (interface{}, error) {
 		data := make(map[string]string)
-		f, err := c.Capture()
+		f, err := c.CaptureWith(r.URL.Query().Get("camera"))
 		data["image"] = f
 		return &data, err
 	}
@@ -44,7 +66,7 @@ func (c *Controller) shoot(w http.ResponseWriter, r *http.Request) {
 func (c *Controller) latest(w http.ResponseWriter, r *http.Request) {
 	var data map[string]string
 	fn := func(_ string) (interface{}, error) {
-		return &data, c.c.Store().Get(Bucket, "latest", &data)
+		return &data, c.c.Store().Get(Bucket, latestKey(r.URL.Query().Get("camera")), &data)
 	}
 	utils.JSONGetResponse(fn, w, r)
 }
@@ -52,6 +74,9 @@ func (c *Controller) latest(w http.ResponseWriter, r *http.Request) {
 func (c *Controller) update(w http.ResponseWriter, r *http.Request) {
 	var conf Config
 	fn := func(id string) error {
+		c.mu.Lock()
+		conf = conf.withSecrets(c.config)
+		c.mu.Unlock()
 		if err := saveConfig(c.c.Store(), conf); err != nil {
 			return err
 		}
@@ -64,3 +89,57 @@ func (c *Controller) update(w http.ResponseWriter, r *http.Request) {
 	}
 	utils.JSONUpdateResponse(&conf, fn, w, r)
 }
+
+// timelapse assembles the images captured between the from and to dates
+// (inclusive, 2006-01-02) into an animation. Optional parameters are camera,
+// format (gif or mjpeg), skip (frames dropped between two used ones), width
+// (pixels) and delay (milliseconds between gif frames).
+func (c *Controller) timelapse(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	t := Timelapse{
+		Camera: q.Get("camera"),
+		Format: q.Get("format"),
+	}
+	from, err := time.ParseInLocation("2006-01-02", q.Get("from"), time.Local)
+	if err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, "Failed to parse from date. Error: "+err.Error(), w)
+		return
+	}
+	to := from
+	if q.Get("to") != "" {
+		to, err = time.ParseInLocation("2006-01-02", q.Get("to"), time.Local)
+		if err != nil {
+			utils.ErrorResponse(http.StatusBadRequest, "Failed to parse to date. Error: "+err.Error(), w)
+			return
+		}
+	}
+	t.From = from
+	t.To = to.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	for param, v := range map[string]*int{"skip": &t.Skip, "delay": &t.Delay} {
+		if s := q.Get(param); s != "" {
+			if *v, err = strconv.Atoi(s); err != nil {
+				utils.ErrorResponse(http.StatusBadRequest, "Invalid "+param+". Error: "+err.Error(), w)
+				return
+			}
+		}
+	}
+	if s := q.Get("width"); s != "" {
+		width, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			utils.ErrorResponse(http.StatusBadRequest, "Invalid width. Error: "+err.Error(), w)
+			return
+		}
+		t.Width = uint(width)
+	}
+	if err := t.Validate(); err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := c.Timelapse(buf, t); err != nil {
+		utils.ErrorResponse(http.StatusInternalServerError, "Failed to assemble timelapse. Error: "+err.Error(), w)
+		return
+	}
+	w.Header().Set("Content-Type", t.ContentType())
+	buf.WriteTo(w)
+}
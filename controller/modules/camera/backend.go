@@ -0,0 +1,210 @@
+package camera
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+const (
+	RaspistillBackend = "raspistill"
+	LibcameraBackend  = "libcamera"
+	HTTPBackend       = "http"
+	DirectoryBackend  = "directory"
+
+	DefaultHTTPTimeout = 10 // seconds
+)
+
+// Backend captures a single image and stores it as png at the given path
+type Backend interface {
+	Capture(path string) error
+}
+
+// CommandConfig holds the extra flags passed to raspistill or libcamera-still
+type CommandConfig struct {
+	Flags string `json:"flags"`
+}
+
+// HTTPConfig fetches a snapshot from an IP camera or a webcam server. Jpeg and
+// png responses are supported, Timeout is in seconds.
+type HTTPConfig struct {
+	URL         string        `json:"url"`
+	Username    string        `json:"username"`
+	Password    string        `json:"password,omitempty"`
+	HasPassword bool          `json:"has_password"`
+	Timeout     time.Duration `json:"timeout"`
+}
+
+// DirectoryConfig picks up the newest image another program dropped in Path.
+// Files matching Pattern (a glob, *.jpg by default) are removed once captured.
+type DirectoryConfig struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
+}
+
+type BackendConfig struct {
+	Type      string          `json:"type"`
+	Command   CommandConfig   `json:"command"`
+	HTTP      HTTPConfig      `json:"http"`
+	Directory DirectoryConfig `json:"directory"`
+}
+
+func (b BackendConfig) Validate() error {
+	switch b.Type {
+	case "", RaspistillBackend, LibcameraBackend:
+	case HTTPBackend:
+		if !strings.HasPrefix(b.HTTP.URL, "http://") && !strings.HasPrefix(b.HTTP.URL, "https://") {
+			return fmt.Errorf("Snapshot URL should be an http(s) URL. Supplied: '%s'", b.HTTP.URL)
+		}
+		if b.HTTP.Timeout < 0 {
+			return fmt.Errorf("Snapshot timeout can not be negative. Supplied: %d", b.HTTP.Timeout)
+		}
+	case DirectoryBackend:
+		if b.Directory.Path == "" {
+			return fmt.Errorf("Drop directory can not be empty")
+		}
+		if _, err := filepath.Match(b.Directory.Pattern, ""); err != nil {
+			return fmt.Errorf("Invalid file pattern '%s'. Error: %w", b.Directory.Pattern, err)
+		}
+	default:
+		return fmt.Errorf("Unknown capture backend: '%s'", b.Type)
+	}
+	return nil
+}
+
+func NewBackend(conf BackendConfig, devMode bool) (Backend, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	switch conf.Type {
+	case LibcameraBackend:
+		return &commandBackend{binary: "libcamera-still", flags: conf.Command.Flags, devMode: devMode}, nil
+	case HTTPBackend:
+		return newHTTPBackend(conf.HTTP), nil
+	case DirectoryBackend:
+		return &directoryBackend{conf: conf.Directory}, nil
+	default:
+		return &commandBackend{binary: "raspistill", flags: conf.Command.Flags, devMode: devMode}, nil
+	}
+}
+
+type commandBackend struct {
+	binary  string
+	flags   string
+	devMode bool
+}
+
+func (b *commandBackend) Capture(path string) error {
+	command := b.binary + " -e png " + b.flags + " -o " + path
+	parts := strings.Fields(command)
+	if err := utils.Command(parts[0], parts[1:]...).WithDevMode(b.devMode).Run(); err != nil {
+		return fmt.Errorf("Failed to execute image capture command: %s. Error: %w", command, err)
+	}
+	return nil
+}
+
+type httpBackend struct {
+	conf   HTTPConfig
+	client *http.Client
+}
+
+func newHTTPBackend(conf HTTPConfig) *httpBackend {
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	return &httpBackend{
+		conf:   conf,
+		client: &http.Client{Timeout: timeout * time.Second},
+	}
+}
+
+func (b *httpBackend) Capture(path string) error {
+	req, err := http.NewRequest("GET", b.conf.URL, nil)
+	if err != nil {
+		return err
+	}
+	if b.conf.Username != "" {
+		req.SetBasicAuth(b.conf.Username, b.conf.Password)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Snapshot request failed with status: %s", resp.Status)
+	}
+	return savePNG(resp.Body, path)
+}
+
+type directoryBackend struct {
+	conf DirectoryConfig
+}
+
+func (b *directoryBackend) Capture(path string) error {
+	pattern := b.conf.Pattern
+	if pattern == "" {
+		pattern = "*.jpg"
+	}
+	files, err := filepath.Glob(filepath.Join(b.conf.Path, pattern))
+	if err != nil {
+		return err
+	}
+	var newest string
+	var newestTime time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest = f
+			newestTime = info.ModTime()
+		}
+	}
+	if newest == "" {
+		return fmt.Errorf("No new image in drop directory: %s", b.conf.Path)
+	}
+	fi, err := os.Open(newest)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	if err := savePNG(fi, path); err != nil {
+		return fmt.Errorf("Failed to convert dropped image %s. Error: %w", newest, err)
+	}
+	// older drops are stale, all of them are consumed with the newest one
+	for _, f := range files {
+		if info, err := os.Stat(f); err != nil || info.IsDir() {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// savePNG decodes a jpeg or png image and stores it as png
+func savePNG(r io.Reader, path string) error {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return png.Encode(out, img)
+}
@@ -0,0 +1,183 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func testJPEG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.Set(x, y, color.RGBA{R: 20, G: 120, B: 200, A: 255})
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func checkPNG(t *testing.T, path string) {
+	t.Helper()
+	fi, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	img, err := png.Decode(fi)
+	if err != nil {
+		t.Fatal("Captured image should be a png. Error:", err)
+	}
+	if img.Bounds().Dx() != 64 {
+		t.Error("Unexpected image width:", img.Bounds().Dx())
+	}
+}
+
+func TestHTTPBackend(t *testing.T) {
+	snapshot := testJPEG(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "reef" || p != "pi" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(snapshot)
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	conf := BackendConfig{Type: HTTPBackend, HTTP: HTTPConfig{URL: ts.URL, Username: "reef", Password: "pi"}}
+	b, err := NewBackend(conf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "snapshot.png")
+	if err := b.Capture(path); err != nil {
+		t.Fatal(err)
+	}
+	checkPNG(t, path)
+	conf.HTTP.Password = "wrong"
+	b, _ = NewBackend(conf, false)
+	if err := b.Capture(path); err == nil {
+		t.Error("Unauthorized snapshot request should fail")
+	}
+	if _, err := NewBackend(BackendConfig{Type: HTTPBackend, HTTP: HTTPConfig{URL: "ftp://foo"}}, false); err == nil {
+		t.Error("Non http URL should fail validation")
+	}
+	if _, err := NewBackend(BackendConfig{Type: "foo"}, false); err == nil {
+		t.Error("Unknown backend should fail validation")
+	}
+}
+
+func TestDirectoryBackend(t *testing.T) {
+	drop := t.TempDir()
+	b, err := NewBackend(BackendConfig{Type: DirectoryBackend, Directory: DirectoryConfig{Path: drop}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "drop.png")
+	if err := b.Capture(path); err == nil {
+		t.Error("Capture should fail when no image was dropped")
+	}
+	old := filepath.Join(drop, "old.jpg")
+	if err := os.WriteFile(old, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(drop, "new.jpg"), testJPEG(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Capture(path); err != nil {
+		t.Fatal(err)
+	}
+	checkPNG(t, path)
+	if files, _ := filepath.Glob(filepath.Join(drop, "*.jpg")); len(files) != 0 {
+		t.Error("Dropped images should be consumed, found:", files)
+	}
+}
+
+func TestMultipleCameras(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	snapshot := testJPEG(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(snapshot)
+	}))
+	defer ts.Close()
+	c, err := New(true, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	drop := t.TempDir()
+	conf := Default
+	conf.Enable = true
+	conf.ImageDirectory = t.TempDir()
+	conf.Cameras = []CameraConfig{
+		{Name: "top", Enable: true, TickInterval: 5, Backend: BackendConfig{Type: HTTPBackend, HTTP: HTTPConfig{URL: ts.URL}}},
+		{Name: "side", Enable: true, TickInterval: 60, Backend: BackendConfig{Type: DirectoryBackend, Directory: DirectoryConfig{Path: drop}}},
+		{Name: "off", TickInterval: 60},
+	}
+	if err := saveConfig(con.Store(), conf); err != nil {
+		t.Fatal(err)
+	}
+	c.config = conf
+	if err := os.WriteFile(filepath.Join(drop, "a.jpg"), testJPEG(t), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.run()
+	items, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Camera != "top" || items[1].Camera != "side" {
+		t.Fatal("Expected one image per enabled camera, found:", items)
+	}
+	checkPNG(t, filepath.Join(conf.ImageDirectory, items[1].Name))
+	var latest map[string]string
+	if err := tr.Do("GET", "/api/camera/latest?camera=top", new(bytes.Buffer), &latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest["image"] != items[0].Name {
+		t.Error("Expected latest image of camera top, found:", latest)
+	}
+	if err := tr.Do("POST", "/api/camera/shoot?camera=top", new(bytes.Buffer), nil); err != nil {
+		t.Error("Failed to shoot with camera using api. Error:", err)
+	}
+	if err := tr.Do("POST", "/api/camera/shoot?camera=foo", new(bytes.Buffer), nil); err == nil {
+		t.Error("Shooting with a non existent camera should fail")
+	}
+	c.Start()
+	c.Stop()
+
+	conf.Cameras = append(conf.Cameras, CameraConfig{Name: "top", TickInterval: 5})
+	if err := saveConfig(con.Store(), conf); err == nil {
+		t.Error("Duplicate camera names should fail validation")
+	}
+	conf.Cameras = []CameraConfig{{Name: "../etc", TickInterval: 5}}
+	if err := saveConfig(con.Store(), conf); err == nil {
+		t.Error("Camera names should be safe to use in file names")
+	}
+}
@@ -4,24 +4,24 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/reef-pi/reef-pi/controller"
 	"github.com/reef-pi/reef-pi/controller/storage"
-	"github.com/reef-pi/reef-pi/controller/utils"
 )
 
 const Bucket = storage.CameraBucket
 const ItemBucket = storage.CameraItemBucket
+const UploadBucket = storage.CameraUploadBucket
 
 type Controller struct {
-	config  Config
-	stopCh  chan struct{}
-	mu      sync.Mutex
-	DevMode bool
-	c       controller.Controller
+	config   Config
+	quit     chan struct{}
+	mu       sync.Mutex
+	uploadMu sync.Mutex
+	DevMode  bool
+	c        controller.Controller
 }
 
 func New(devMode bool, c controller.Controller) (*Controller, error) {
@@ -29,7 +29,6 @@ func New(devMode bool, c controller.Controller) (*Controller, error) {
 		config:  Default,
 		mu:      sync.Mutex{},
 		DevMode: devMode,
-		stopCh:  make(chan struct{}),
 		c:       c,
 	}, nil
 }
@@ -39,37 +38,63 @@ func (c *Controller) On(id string, b bool) error {
 }
 
 func (c *Controller) Start() {
-	go c.runPeriodically()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quit != nil {
+		return
+	}
+	c.quit = make(chan struct{})
+	for _, cam := range c.config.cameras() {
+		go c.runPeriodically(cam, c.quit)
+	}
+	go c.retryUploads(c.quit)
 }
 
+// run captures an image with every camera once
 func (c *Controller) run() {
-	if !c.config.Enable {
+	c.mu.Lock()
+	cams := c.config.cameras()
+	c.mu.Unlock()
+	for _, cam := range cams {
+		c.runCamera(cam)
+	}
+}
+
+func (c *Controller) runCamera(cam CameraConfig) {
+	c.mu.Lock()
+	conf := c.config
+	c.mu.Unlock()
+	if !conf.Enable || !cam.Enable {
 		return
 	}
-	img, err := c.Capture()
+	img, err := c.capture(cam)
 	if err != nil {
-		log.Println("ERROR: camera subsystem: failed to capture image. Error:", err)
+		log.Println("ERROR: camera subsystem: failed to capture image. Camera:", cam.Name, "Error:", err)
 		c.c.LogError("camera-capture", "Failed to capture image. Error:"+err.Error())
 		return
 	}
-	if err := c.Process(img); err != nil {
+	if err := c.process(cam.Name, img); err != nil {
 		log.Println("ERROR: camera sub-system : Failed to process image. Error:", err)
 		c.c.LogError("camera-process", "Failed to process image. Error:"+err.Error())
 	}
-	if c.config.Upload {
+	if conf.Upload {
 		c.uploadImage(img)
 	}
+	if _, err := c.applyRetention(time.Now()); err != nil {
+		log.Println("ERROR: camera sub-system : Failed to apply retention policy. Error:", err)
+		c.c.LogError("camera-retention", "Failed to apply retention policy. Error:"+err.Error())
+	}
 }
 
-func (c *Controller) runPeriodically() {
-	log.Println("Starting camera controller")
-	ticker := time.NewTicker(c.config.TickInterval * time.Minute)
+func (c *Controller) runPeriodically(cam CameraConfig, quit chan struct{}) {
+	log.Println("Starting camera controller. Camera:", cam.Name)
+	ticker := time.NewTicker(cam.TickInterval * time.Minute)
 	for {
 		select {
 		case <-ticker.C:
-			c.run()
-		case <-c.stopCh:
-			log.Println("Stopping camera controller")
+			c.runCamera(cam)
+		case <-quit:
+			log.Println("Stopping camera controller. Camera:", cam.Name)
 			ticker.Stop()
 			return
 		}
@@ -77,7 +102,12 @@ func (c *Controller) runPeriodically() {
 }
 
 func (c *Controller) Stop() {
-	c.stopCh <- struct{}{}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quit != nil {
+		close(c.quit)
+		c.quit = nil
+	}
 }
 
 func (c *Controller) Setup() error {
@@ -99,44 +129,69 @@ func (c *Controller) Setup() error {
 	if err := c.c.Store().CreateBucket(ItemBucket); err != nil {
 		return err
 	}
+	if err := c.c.Store().CreateBucket(UploadBucket); err != nil {
+		return err
+	}
 	return nil
 }
 
+// Capture takes an image with the first camera
 func (c *Controller) Capture() (string, error) {
+	return c.CaptureWith("")
+}
+
+// CaptureWith takes an image with the named camera, or the first one when name is empty
+func (c *Controller) CaptureWith(name string) (string, error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	imgDir, pathErr := filepath.Abs(c.config.ImageDirectory)
+	cam, err := c.config.camera(name)
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return c.capture(cam)
+}
+
+func (c *Controller) capture(cam CameraConfig) (string, error) {
+	c.mu.Lock()
+	dir := c.config.ImageDirectory
+	c.mu.Unlock()
+	imgDir, pathErr := filepath.Abs(dir)
 	if pathErr != nil {
 		return "", pathErr
 	}
+	backend, err := NewBackend(cam.Backend, c.DevMode)
+	if err != nil {
+		return "", err
+	}
 	imgName := time.Now().Format("15-04-05-Mon-Jan-2-2006.png")
+	if cam.Name != "" {
+		imgName = cam.Name + "-" + imgName
+	}
 	imgPath := filepath.Join(imgDir, imgName)
-	command := "raspistill -e png " + c.config.CaptureFlags + " -o " + imgPath
-	parts := strings.Fields(command)
-	err := utils.Command(parts[0], parts[1:]...).WithDevMode(c.DevMode).Run()
-	if err != nil {
-		log.Println("ERROR: Failed to execute image capture command:", command, "Error:", err)
+	if err := backend.Capture(imgPath); err != nil {
+		log.Println("ERROR: Failed to capture image. Camera:", cam.Name, "Error:", err)
 		return "", err
 	}
 	data := make(map[string]string)
 	data["image"] = imgName
+	data["camera"] = cam.Name
 	log.Println("Camera subsystem: Image captured:", imgPath)
-	return imgName, c.c.Store().Update(Bucket, "latest", data)
+	if err := c.c.Store().Update(Bucket, latestKey(cam.Name), data); err != nil {
+		return imgName, err
+	}
+	if cam.Name == "" {
+		return imgName, nil
+	}
+	return imgName, c.c.Store().Update(Bucket, latestKey(""), data)
 }
 
-func (c *Controller) uploadImage(imgName string) {
-	imgDir, pathErr := filepath.Abs(c.config.ImageDirectory)
-	if pathErr != nil {
-		log.Println("ERROR: Failed to compute absolute image path. Error:", pathErr)
-		return
-	}
-	imgPath := filepath.Join(imgDir, imgName)
-	command := "drive push -quiet -destination reef-pi-images -files " + imgPath
-	parts := strings.Fields(command)
-	err := utils.Command(parts[0], parts[1:]...).WithDevMode(c.DevMode).Run()
-	if err != nil {
-		log.Println("ERROR: Failed to upload image. Command:", command, "Error:", err)
+// latestKey is where the latest image of a camera is stored, the latest image
+// of any camera is stored under "latest"
+func latestKey(camera string) string {
+	if camera == "" {
+		return "latest"
 	}
+	return "latest-" + camera
 }
 
 func (c *Controller) InUse(_, _ string) ([]string, error) {
@@ -87,3 +87,61 @@ func TestCamera(t *testing.T) {
 		t.Error("Camera should return error to On API")
 	}
 }
+
+func TestConfigSecrets(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	tr := utils.NewTestRouter()
+	c, err := New(true, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	c.LoadAPI(tr.Router)
+	conf := Default
+	conf.Backend = BackendConfig{Type: HTTPBackend, HTTP: HTTPConfig{URL: "http://cam", Password: "cam-pass"}}
+	conf.Cameras = []CameraConfig{{Name: "sump", TickInterval: 10, Backend: conf.Backend}}
+	conf.UploadTarget = UploadConfig{
+		Type:   S3Target,
+		WebDAV: WebDAVConfig{Password: "dav-pass"},
+		S3:     S3Config{SecretKey: "s3-key"},
+	}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(&conf)
+	if err := tr.Do("POST", "/api/camera/config", body, nil); err != nil {
+		t.Fatal("Failed to update camera config using api. Error:", err)
+	}
+	c.Stop()
+
+	var got Config
+	if err := tr.Do("GET", "/api/camera/config", new(bytes.Buffer), &got); err != nil {
+		t.Fatal("Failed to get camera config using api. Error:", err)
+	}
+	if got.Backend.HTTP.Password != "" || got.Cameras[0].Backend.HTTP.Password != "" ||
+		got.UploadTarget.WebDAV.Password != "" || got.UploadTarget.S3.SecretKey != "" {
+		t.Error("Secrets should be hidden from api responses, found:", got)
+	}
+	if !got.Backend.HTTP.HasPassword || !got.Cameras[0].Backend.HTTP.HasPassword ||
+		!got.UploadTarget.WebDAV.HasPassword || !got.UploadTarget.S3.HasSecretKey {
+		t.Error("Api responses should report configured secrets, found:", got)
+	}
+	body.Reset()
+	json.NewEncoder(body).Encode(&got)
+	if err := tr.Do("POST", "/api/camera/config", body, nil); err != nil {
+		t.Fatal("Failed to update camera config using api. Error:", err)
+	}
+	c.Stop()
+	stored, err := loadConfig(con.Store())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Backend.HTTP.Password != "cam-pass" || stored.Cameras[0].Backend.HTTP.Password != "cam-pass" ||
+		stored.UploadTarget.WebDAV.Password != "dav-pass" || stored.UploadTarget.S3.SecretKey != "s3-key" {
+		t.Error("Update without secrets should keep the stored ones, found:", stored)
+	}
+}
@@ -2,6 +2,7 @@ package camera
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/reef-pi/reef-pi/controller/storage"
@@ -16,13 +17,103 @@ type MotionConfig struct {
 	Height int    `json:"height"`
 }
 
+// CameraConfig describes one of several cameras, each captured on its own
+// schedule. TickInterval is in minutes.
+type CameraConfig struct {
+	Name         string        `json:"name"`
+	Enable       bool          `json:"enable"`
+	TickInterval time.Duration `json:"tick_interval"`
+	Backend      BackendConfig `json:"backend"`
+}
+
+// Config of the camera subsystem. Without Cameras, the top level Enable,
+// TickInterval, CaptureFlags and Backend settings define a single camera.
 type Config struct {
-	Enable         bool          `json:"enable"`
-	ImageDirectory string        `json:"image_directory"`
-	CaptureFlags   string        `json:"capture_flags"`
-	TickInterval   time.Duration `json:"tick_interval"`
-	Upload         bool          `json:"upload"`
-	Motion         MotionConfig  `json:"motion"`
+	Enable         bool           `json:"enable"`
+	ImageDirectory string         `json:"image_directory"`
+	CaptureFlags   string         `json:"capture_flags"`
+	TickInterval   time.Duration  `json:"tick_interval"`
+	Upload         bool           `json:"upload"`
+	Motion         MotionConfig   `json:"motion"`
+	Backend        BackendConfig  `json:"backend"`
+	Cameras        []CameraConfig `json:"cameras"`
+	Retention      Retention      `json:"retention"`
+	UploadTarget   UploadConfig   `json:"upload_target"`
+	Analysis       Analysis       `json:"analysis"`
+}
+
+var validCameraName = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// cameras returns the configured cameras, or the default camera described by
+// the top level settings
+func (c Config) cameras() []CameraConfig {
+	if len(c.Cameras) > 0 {
+		return c.Cameras
+	}
+	b := c.Backend
+	if b.Command.Flags == "" {
+		b.Command.Flags = c.CaptureFlags
+	}
+	return []CameraConfig{{Enable: c.Enable, TickInterval: c.TickInterval, Backend: b}}
+}
+
+func (c Config) camera(name string) (CameraConfig, error) {
+	cams := c.cameras()
+	if name == "" {
+		return cams[0], nil
+	}
+	for _, cam := range cams {
+		if cam.Name == name {
+			return cam, nil
+		}
+	}
+	return CameraConfig{}, fmt.Errorf("Camera '%s' does not exist", name)
+}
+
+// redacted hides the passwords and keys of the configuration from api
+// responses, reporting only whether they are set
+func (c Config) redacted() Config {
+	c.Backend.HTTP.HasPassword = c.Backend.HTTP.Password != ""
+	c.Backend.HTTP.Password = ""
+	cams := make([]CameraConfig, len(c.Cameras))
+	for i, cam := range c.Cameras {
+		cam.Backend.HTTP.HasPassword = cam.Backend.HTTP.Password != ""
+		cam.Backend.HTTP.Password = ""
+		cams[i] = cam
+	}
+	c.Cameras = cams
+	c.UploadTarget.WebDAV.HasPassword = c.UploadTarget.WebDAV.Password != ""
+	c.UploadTarget.WebDAV.Password = ""
+	c.UploadTarget.S3.HasSecretKey = c.UploadTarget.S3.SecretKey != ""
+	c.UploadTarget.S3.SecretKey = ""
+	return c
+}
+
+// withSecrets fills the passwords and keys api clients left empty from the
+// stored configuration, cameras are matched by name
+func (c Config) withSecrets(old Config) Config {
+	if c.Backend.HTTP.Password == "" {
+		c.Backend.HTTP.Password = old.Backend.HTTP.Password
+	}
+	c.Backend.HTTP.HasPassword = false
+	for i := range c.Cameras {
+		cam := &c.Cameras[i]
+		if cam.Backend.HTTP.Password == "" {
+			if o, err := old.camera(cam.Name); err == nil {
+				cam.Backend.HTTP.Password = o.Backend.HTTP.Password
+			}
+		}
+		cam.Backend.HTTP.HasPassword = false
+	}
+	if c.UploadTarget.WebDAV.Password == "" {
+		c.UploadTarget.WebDAV.Password = old.UploadTarget.WebDAV.Password
+	}
+	c.UploadTarget.WebDAV.HasPassword = false
+	if c.UploadTarget.S3.SecretKey == "" {
+		c.UploadTarget.S3.SecretKey = old.UploadTarget.S3.SecretKey
+	}
+	c.UploadTarget.S3.HasSecretKey = false
+	return c
 }
 
 var Default = Config{
@@ -47,5 +138,35 @@ func saveConfig(store storage.Store, conf Config) error {
 	if conf.ImageDirectory == "" {
 		return fmt.Errorf("Image directory cant not be empty")
 	}
+	if err := conf.Backend.Validate(); err != nil {
+		return err
+	}
+	if err := conf.Retention.Validate(); err != nil {
+		return err
+	}
+	if err := conf.Analysis.Validate(); err != nil {
+		return err
+	}
+	if conf.Upload {
+		if err := conf.UploadTarget.Validate(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	for _, cam := range conf.Cameras {
+		if !validCameraName.MatchString(cam.Name) {
+			return fmt.Errorf("Camera name should only contain letters, digits and underscores. Supplied: '%s'", cam.Name)
+		}
+		if names[cam.Name] {
+			return fmt.Errorf("Duplicate camera name: '%s'", cam.Name)
+		}
+		names[cam.Name] = true
+		if cam.TickInterval <= 0 {
+			return fmt.Errorf("Tick Interval of camera '%s' must be greater than zero", cam.Name)
+		}
+		if err := cam.Backend.Validate(); err != nil {
+			return fmt.Errorf("Invalid backend for camera '%s'. Error: %w", cam.Name, err)
+		}
+	}
 	return store.Update(Bucket, "config", conf)
 }
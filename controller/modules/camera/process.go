@@ -5,16 +5,24 @@ import (
 	"image/png"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/nfnt/resize"
 )
 
 type ImageItem struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Camera  string    `json:"camera"`
+	Time    time.Time `json:"time"`
+	Metrics *Metrics  `json:"metrics,omitempty"`
 }
 
 func (c *Controller) Process(name string) error {
+	return c.process("", name)
+}
+
+func (c *Controller) process(camera, name string) error {
 	d, err := filepath.Abs(c.config.ImageDirectory)
 	if err != nil {
 		return err
@@ -42,7 +50,18 @@ func (c *Controller) Process(name string) error {
 	defer out.Close()
 	png.Encode(out, m)
 	i := ImageItem{
-		Name: name,
+		Name:   name,
+		Camera: camera,
+		Time:   time.Now(),
+	}
+	c.mu.Lock()
+	a := c.config.Analysis
+	c.mu.Unlock()
+	if a.Enable {
+		m := analyze(img, a.Region)
+		i.Metrics = &m
+		c.emitMetrics(camera, m)
+		c.checkThresholds(camera, m, a.Thresholds, i.Time)
 	}
 	fn := func(id string) interface{} {
 		i.ID = id
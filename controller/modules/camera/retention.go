@@ -0,0 +1,185 @@
+package camera
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+// Retention limits how many images are kept. Images of the last Days days are
+// all kept, older ones are deleted or, with Daily set, thinned to the first
+// image of each day per camera. MaxSize (in MB) caps the disk usage of images
+// and thumbnails, deleting the oldest first. Zero values disable a limit.
+type Retention struct {
+	Days    int   `json:"days"`
+	Daily   bool  `json:"daily"`
+	MaxSize int64 `json:"max_size"`
+}
+
+func (r Retention) Validate() error {
+	if r.Days < 0 {
+		return fmt.Errorf("Retention days can not be negative. Supplied: %d", r.Days)
+	}
+	if r.MaxSize < 0 {
+		return fmt.Errorf("Maximum disk usage can not be negative. Supplied: %d", r.MaxSize)
+	}
+	return nil
+}
+
+// itemTime returns the capture time of an image, items stored before capture
+// times were recorded fall back to the modification time of the file
+func itemTime(dir string, i ImageItem) time.Time {
+	if !i.Time.IsZero() {
+		return i.Time
+	}
+	info, err := os.Stat(filepath.Join(dir, i.Name))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// items returns all images sorted by capture time, oldest first
+func (c *Controller) items(dir string) ([]ImageItem, error) {
+	items, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Time = itemTime(dir, items[i])
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Time.Before(items[j].Time)
+	})
+	return items, nil
+}
+
+// attached returns true when a journal entry uses the image
+func (c *Controller) attached(i ImageItem) bool {
+	sub, err := c.c.Subsystem(storage.JournalBucket)
+	if err != nil {
+		return false
+	}
+	deps, err := sub.InUse(ItemBucket, i.ID)
+	if err != nil {
+		log.Println("ERROR: camera subsystem: Failed to check journal entries of image:", i.Name, "Error:", err)
+		return true
+	}
+	return len(deps) > 0
+}
+
+// queued returns the names of images waiting in the upload queue
+func (c *Controller) queued() (map[string]bool, error) {
+	us, err := c.Uploads()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, u := range us {
+		names[u.Image] = true
+	}
+	return names, nil
+}
+
+func (c *Controller) deleteImage(dir string, i ImageItem) error {
+	for _, name := range []string{i.Name, "thumbnail-" + i.Name} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return c.c.Store().Delete(ItemBucket, i.ID)
+}
+
+func imageSize(dir string, i ImageItem) int64 {
+	var size int64
+	for _, name := range []string{i.Name, "thumbnail-" + i.Name} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// applyRetention deletes images according to the retention policy and
+// returns how many were deleted. The newest image, images attached to journal
+// entries and images waiting to be uploaded are never deleted.
+func (c *Controller) applyRetention(now time.Time) (int, error) {
+	c.mu.Lock()
+	r := c.config.Retention
+	d := c.config.ImageDirectory
+	c.mu.Unlock()
+	if r.Days == 0 && r.MaxSize == 0 {
+		return 0, nil
+	}
+	dir, err := filepath.Abs(d)
+	if err != nil {
+		return 0, err
+	}
+	items, err := c.items(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+	queued, err := c.queued()
+	if err != nil {
+		return 0, err
+	}
+	keep := func(i ImageItem) bool {
+		return queued[i.Name] || c.attached(i)
+	}
+	deleted := 0
+	var kept []ImageItem
+	if r.Days > 0 {
+		cutoff := now.AddDate(0, 0, -r.Days)
+		daily := make(map[string]bool)
+		for n, i := range items {
+			if !i.Time.Before(cutoff) || n == len(items)-1 {
+				kept = append(kept, i)
+				continue
+			}
+			day := i.Camera + "/" + i.Time.Format("2006-01-02")
+			if r.Daily && !daily[day] {
+				daily[day] = true
+				kept = append(kept, i)
+				continue
+			}
+			if keep(i) {
+				kept = append(kept, i)
+				continue
+			}
+			if err := c.deleteImage(dir, i); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	} else {
+		kept = items
+	}
+	if r.MaxSize > 0 {
+		var total int64
+		for _, i := range kept {
+			total += imageSize(dir, i)
+		}
+		for n := 0; total > r.MaxSize*1024*1024 && n < len(kept)-1; n++ {
+			if keep(kept[n]) {
+				continue
+			}
+			total -= imageSize(dir, kept[n])
+			if err := c.deleteImage(dir, kept[n]); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		log.Println("camera subsystem: Deleted", deleted, "images as per retention policy")
+	}
+	return deleted, nil
+}
@@ -0,0 +1,234 @@
+package camera
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/storage"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func addImage(t *testing.T, c *Controller, camera string, at time.Time) ImageItem {
+	t.Helper()
+	i := ImageItem{Name: camera + at.Format("2006-01-02-15-04-05.png"), Camera: camera, Time: at}
+	out, err := os.Create(filepath.Join(c.config.ImageDirectory, i.Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(out, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	fn := func(id string) interface{} {
+		i.ID = id
+		return &i
+	}
+	if err := c.c.Store().Create(ItemBucket, fn); err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func newTestCamera(t *testing.T) (*Controller, *utils.TestRouter) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { con.Store().Close() })
+	c, err := New(true, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	c.config.ImageDirectory = t.TempDir()
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	return c, tr
+}
+
+func TestRetention(t *testing.T) {
+	c, _ := newTestCamera(t)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	for d := 5; d >= 0; d-- {
+		for h := 0; h < 3; h++ {
+			addImage(t, c, "", now.AddDate(0, 0, -d).Add(time.Duration(h)*time.Hour))
+			addImage(t, c, "top", now.AddDate(0, 0, -d).Add(time.Duration(h)*time.Hour))
+		}
+	}
+	c.config.Retention = Retention{Days: 2, Daily: true}
+	deleted, err := c.applyRetention(now.Add(3 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 4 days beyond retention, 2 of 3 images deleted per day and camera
+	if deleted != 16 {
+		t.Error("Expected 16 images to be deleted, found:", deleted)
+	}
+	items, _ := c.List()
+	if len(items) != 20 {
+		t.Error("Expected 20 images to be kept, found:", len(items))
+	}
+	if files, _ := filepath.Glob(filepath.Join(c.config.ImageDirectory, "*.png")); len(files) != 20 {
+		t.Error("Deleted images should be removed from disk, found:", len(files))
+	}
+
+	size := imageSize(c.config.ImageDirectory, items[0])
+	c.config.Retention = Retention{MaxSize: 1}
+	deleted, err = c.applyRetention(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Error("Images below maximum disk usage should be kept, deleted:", deleted)
+	}
+	if size*20 < 1024*1024 {
+		c.config.Retention = Retention{Days: 1}
+		if _, err := c.applyRetention(now.AddDate(1, 0, 0)); err != nil {
+			t.Fatal(err)
+		}
+		if items, _ := c.List(); len(items) != 1 {
+			t.Error("Newest image should never be deleted, found:", len(items))
+		}
+	}
+	if err := (Retention{Days: -1}).Validate(); err == nil {
+		t.Error("Negative retention should fail validation")
+	}
+}
+
+func TestTimelapse(t *testing.T) {
+	c, tr := newTestCamera(t)
+	day := time.Date(2024, 3, 1, 8, 0, 0, 0, time.Local)
+	for h := 0; h < 10; h++ {
+		addImage(t, c, "", day.Add(time.Duration(h)*time.Hour))
+	}
+	addImage(t, c, "top", day)
+	addImage(t, c, "", day.AddDate(0, 0, 1))
+
+	buf := new(bytes.Buffer)
+	if err := c.Timelapse(buf, Timelapse{From: day, To: day.Add(12 * time.Hour), Skip: 1, Width: 32}); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 5 || anim.Image[0].Bounds().Dx() != 32 {
+		t.Error("Expected 5 frames 32 pixels wide, found:", len(anim.Image))
+	}
+
+	buf.Reset()
+	if err := c.Timelapse(buf, Timelapse{From: day, To: day.AddDate(0, 0, 2), Format: MJPEGFormat, Width: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	// every frame starts with a jpeg start of image marker
+	if frames := bytes.Count(buf.Bytes(), []byte{0xFF, 0xD8, 0xFF}); frames != 11 {
+		t.Error("Expected 11 motion jpeg frames, found:", frames)
+	}
+
+	req := httptest.NewRequest("GET", "/api/camera/timelapse?from=2024-03-01&camera=top&width=16", nil)
+	rr := httptest.NewRecorder()
+	tr.Router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/gif" {
+		t.Fatal("Failed to assemble timelapse using api. Response:", rr.Body.String())
+	}
+	if anim, err := gif.DecodeAll(rr.Body); err != nil || len(anim.Image) != 1 {
+		t.Error("Expected a single frame gif for camera top. Error:", err)
+	}
+	if err := tr.Do("GET", "/api/camera/timelapse?from=2024-03-05", new(bytes.Buffer), nil); err == nil {
+		t.Error("Timelapse without images should fail")
+	}
+	if err := tr.Do("GET", "/api/camera/timelapse?from=2024-03-01&format=avi", new(bytes.Buffer), nil); err == nil {
+		t.Error("Unsupported format should fail")
+	}
+}
+
+type journalStub struct {
+	controller.Subsystem
+	photos map[string]bool
+}
+
+func (j *journalStub) InUse(_, id string) ([]string, error) {
+	if j.photos[id] {
+		return []string{"entry"}, nil
+	}
+	return nil, nil
+}
+
+type testController struct {
+	controller.Controller
+	journal controller.Subsystem
+}
+
+func (t *testController) Subsystem(name string) (controller.Subsystem, error) {
+	if name == storage.JournalBucket {
+		return t.journal, nil
+	}
+	return t.Controller.Subsystem(name)
+}
+
+func TestRetentionKeepsJournalPhotos(t *testing.T) {
+	c, _ := newTestCamera(t)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	old := addImage(t, c, "", now.AddDate(0, 0, -5))
+	addImage(t, c, "", now.AddDate(0, 0, -4))
+	addImage(t, c, "", now)
+	c.c = &testController{Controller: c.c, journal: &journalStub{photos: map[string]bool{old.ID: true}}}
+	c.config.Retention = Retention{Days: 1}
+	deleted, err := c.applyRetention(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Error("Expected one image to be deleted, found:", deleted)
+	}
+	var i ImageItem
+	if err := c.c.Store().Get(ItemBucket, old.ID, &i); err != nil {
+		t.Error("Images attached to journal entries should be kept")
+	}
+}
+
+func TestRetentionKeepsQueuedUploads(t *testing.T) {
+	c, _ := newTestCamera(t)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	old := addImage(t, c, "", now.AddDate(0, 0, -5))
+	addImage(t, c, "", now.AddDate(0, 0, -4))
+	addImage(t, c, "", now)
+	u := Upload{Image: old.Name, Queued: now}
+	fn := func(id string) interface{} {
+		u.ID = id
+		return &u
+	}
+	if err := c.c.Store().Create(UploadBucket, fn); err != nil {
+		t.Fatal(err)
+	}
+	c.config.Retention = Retention{Days: 1}
+	deleted, err := c.applyRetention(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Error("Expected one image to be deleted, found:", deleted)
+	}
+	var i ImageItem
+	if err := c.c.Store().Get(ItemBucket, old.ID, &i); err != nil {
+		t.Error("Images waiting to be uploaded should be kept")
+	}
+	if _, err := os.Stat(filepath.Join(c.config.ImageDirectory, old.Name)); err != nil {
+		t.Error("Image file waiting to be uploaded should be kept. Error:", err)
+	}
+}
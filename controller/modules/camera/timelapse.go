@@ -0,0 +1,152 @@
+package camera
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	GIFFormat   = "gif"
+	MJPEGFormat = "mjpeg"
+
+	DefaultTimelapseWidth = 320
+	DefaultTimelapseDelay = 200 // milliseconds between frames
+	_maxTimelapseFrames   = 500
+	_maxTimelapseWidth    = 1920
+)
+
+// Timelapse selects the images of a camera captured between From and To and
+// assembles every Skip+1th one into an animation Width pixels wide
+type Timelapse struct {
+	From   time.Time
+	To     time.Time
+	Camera string
+	Format string
+	Skip   int
+	Width  uint
+	Delay  int
+}
+
+func (t *Timelapse) Validate() error {
+	switch t.Format {
+	case "":
+		t.Format = GIFFormat
+	case GIFFormat, MJPEGFormat:
+	default:
+		return fmt.Errorf("Unsupported timelapse format: '%s'", t.Format)
+	}
+	if t.Width == 0 {
+		t.Width = DefaultTimelapseWidth
+	}
+	if t.Width > _maxTimelapseWidth {
+		return fmt.Errorf("Timelapse width should be at most %d. Supplied: %d", _maxTimelapseWidth, t.Width)
+	}
+	if t.Delay == 0 {
+		t.Delay = DefaultTimelapseDelay
+	}
+	if t.Skip < 0 || t.Delay < 0 {
+		return fmt.Errorf("Frame skip and delay can not be negative")
+	}
+	if t.To.Before(t.From) {
+		return fmt.Errorf("Timelapse end is before its start")
+	}
+	return nil
+}
+
+func (t Timelapse) ContentType() string {
+	if t.Format == MJPEGFormat {
+		return "video/x-motion-jpeg"
+	}
+	return "image/gif"
+}
+
+func (c *Controller) frames(t Timelapse, dir string) ([]ImageItem, error) {
+	items, err := c.items(dir)
+	if err != nil {
+		return nil, err
+	}
+	var frames []ImageItem
+	n := 0
+	for _, i := range items {
+		if i.Camera != t.Camera || i.Time.Before(t.From) || i.Time.After(t.To) {
+			continue
+		}
+		if n%(t.Skip+1) == 0 {
+			frames = append(frames, i)
+		}
+		n++
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("No images captured in the given period")
+	}
+	if len(frames) > _maxTimelapseFrames {
+		return nil, fmt.Errorf("Too many frames (%d), at most %d are supported. Increase frame skip or shorten the period", len(frames), _maxTimelapseFrames)
+	}
+	return frames, nil
+}
+
+func loadFrame(path string, width uint) (image.Image, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	img, err := png.Decode(fi)
+	if err != nil {
+		return nil, err
+	}
+	return resize.Resize(width, 0, img, resize.Bilinear), nil
+}
+
+// Timelapse assembles the selected images into an animated gif, or a motion
+// jpeg stream (concatenated jpeg frames), and writes it to w. Motion jpeg
+// frames are written as they are encoded, an error may leave partial output.
+func (c *Controller) Timelapse(w io.Writer, t Timelapse) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	d := c.config.ImageDirectory
+	c.mu.Unlock()
+	dir, err := filepath.Abs(d)
+	if err != nil {
+		return err
+	}
+	frames, err := c.frames(t, dir)
+	if err != nil {
+		return err
+	}
+	anim := &gif.GIF{}
+	for _, f := range frames {
+		img, err := loadFrame(filepath.Join(dir, f.Name), t.Width)
+		if err != nil {
+			return fmt.Errorf("Failed to load image %s. Error: %w", f.Name, err)
+		}
+		switch t.Format {
+		case MJPEGFormat:
+			if err := jpeg.Encode(w, img, &jpeg.Options{Quality: 85}); err != nil {
+				return err
+			}
+		default:
+			p := image.NewPaletted(img.Bounds(), palette.Plan9)
+			draw.FloydSteinberg.Draw(p, img.Bounds(), img, image.Point{})
+			anim.Image = append(anim.Image, p)
+			anim.Delay = append(anim.Delay, t.Delay/10)
+		}
+	}
+	if t.Format == GIFFormat {
+		return gif.EncodeAll(w, anim)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package camera
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WebDAVTarget    = "webdav"
+	S3Target        = "s3"
+	DirectoryTarget = "directory"
+
+	_uploadTimeout       = 30 * time.Second
+	_uploadRetryInterval = 5 * time.Minute
+)
+
+// Uploader stores a captured image on a remote target
+type Uploader interface {
+	Upload(name string, data []byte) error
+}
+
+// WebDAVConfig uploads images into an existing collection at URL
+type WebDAVConfig struct {
+	URL         string `json:"url"`
+	Username    string `json:"username"`
+	Password    string `json:"password,omitempty"`
+	HasPassword bool   `json:"has_password"`
+}
+
+// S3Config uploads images to a bucket of an S3 compatible object store, using
+// path style requests, e.g. https://s3.eu-west-1.amazonaws.com or a MinIO server
+type S3Config struct {
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix"`
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key,omitempty"`
+	HasSecretKey bool   `json:"has_secret_key"`
+}
+
+// MountConfig copies images to a local directory, like an NFS or SMB mount
+type MountConfig struct {
+	Path string `json:"path"`
+}
+
+type UploadConfig struct {
+	Type      string       `json:"type"`
+	WebDAV    WebDAVConfig `json:"webdav"`
+	S3        S3Config     `json:"s3"`
+	Directory MountConfig  `json:"directory"`
+}
+
+func (u UploadConfig) Validate() error {
+	switch u.Type {
+	case WebDAVTarget:
+		if _, err := url.ParseRequestURI(u.WebDAV.URL); err != nil {
+			return fmt.Errorf("Invalid WebDAV URL. Error: %w", err)
+		}
+	case S3Target:
+		if _, err := url.ParseRequestURI(u.S3.Endpoint); err != nil {
+			return fmt.Errorf("Invalid S3 endpoint. Error: %w", err)
+		}
+		if u.S3.Bucket == "" || u.S3.AccessKey == "" || u.S3.SecretKey == "" {
+			return fmt.Errorf("S3 bucket and credentials are required")
+		}
+	case DirectoryTarget:
+		if u.Directory.Path == "" {
+			return fmt.Errorf("Upload directory can not be empty")
+		}
+	default:
+		return fmt.Errorf("Unknown upload target: '%s'", u.Type)
+	}
+	return nil
+}
+
+func NewUploader(conf UploadConfig) (Uploader, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: _uploadTimeout}
+	switch conf.Type {
+	case WebDAVTarget:
+		return &webdav{conf: conf.WebDAV, client: client}, nil
+	case S3Target:
+		return &s3{conf: conf.S3, client: client}, nil
+	default:
+		return &mount{conf: conf.Directory}, nil
+	}
+}
+
+func put(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("Upload failed with status: %s. Response: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+type webdav struct {
+	conf   WebDAVConfig
+	client *http.Client
+}
+
+func (w *webdav) Upload(name string, data []byte) error {
+	req, err := http.NewRequest("PUT", strings.TrimSuffix(w.conf.URL, "/")+"/"+url.PathEscape(name), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	if w.conf.Username != "" {
+		req.SetBasicAuth(w.conf.Username, w.conf.Password)
+	}
+	return put(w.client, req)
+}
+
+type s3 struct {
+	conf   S3Config
+	client *http.Client
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// signingKey derives the AWS signature version 4 key of a day
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+// sign adds AWS signature version 4 headers to a request without query parameters
+func (s *s3) sign(req *http.Request, payload []byte, t time.Time) {
+	region := s.conf.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	hash := sha256Hex(payload)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", hash)
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + hash,
+		"x-amz-date:" + amzDate,
+		"",
+		signed,
+		hash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+	signature := hex.EncodeToString(hmacSHA256(signingKey(s.conf.SecretKey, date, region, "s3"), toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signed, signature))
+}
+
+func (s *s3) Upload(name string, data []byte) error {
+	key := path.Join(s.conf.Prefix, name)
+	u := strings.TrimSuffix(s.conf.Endpoint, "/") + "/" + url.PathEscape(s.conf.Bucket) + "/" + (&url.URL{Path: key}).EscapedPath()
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "image/png")
+	s.sign(req, data, time.Now())
+	return put(s.client, req)
+}
+
+type mount struct {
+	conf MountConfig
+}
+
+// Upload writes to a temporary file first, so that readers of the mount never
+// see partial images
+func (m *mount) Upload(name string, data []byte) error {
+	tmp := filepath.Join(m.conf.Path, "."+name+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.conf.Path, name))
+}
+
+// Upload is an image waiting in the upload queue, failed uploads are retried
+// in order until they succeed or the image is deleted
+type Upload struct {
+	ID       string    `json:"id"`
+	Image    string    `json:"image"`
+	Queued   time.Time `json:"queued"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+}
+
+func (c *Controller) Uploads() ([]Upload, error) {
+	us := []Upload{}
+	fn := func(_ string, v []byte) error {
+		var u Upload
+		if err := json.Unmarshal(v, &u); err != nil {
+			return err
+		}
+		us = append(us, u)
+		return nil
+	}
+	if err := c.c.Store().List(UploadBucket, fn); err != nil {
+		return nil, err
+	}
+	sort.Slice(us, func(i, j int) bool {
+		a, _ := strconv.Atoi(us[i].ID)
+		b, _ := strconv.Atoi(us[j].ID)
+		return a < b
+	})
+	return us, nil
+}
+
+func (c *Controller) uploadImage(imgName string) {
+	u := Upload{Image: filepath.Base(imgName), Queued: time.Now()}
+	fn := func(id string) interface{} {
+		u.ID = id
+		return &u
+	}
+	if err := c.c.Store().Create(UploadBucket, fn); err != nil {
+		log.Println("ERROR: camera subsystem: Failed to queue image for upload. Error:", err)
+		return
+	}
+	if err := c.flushUploads(); err != nil {
+		log.Println("ERROR: camera subsystem: Failed to upload image. Error:", err)
+	}
+}
+
+// flushUploads uploads queued images oldest first. It stops at the first
+// failure, as the target is likely unreachable, leaving the rest queued.
+func (c *Controller) flushUploads() error {
+	c.uploadMu.Lock()
+	defer c.uploadMu.Unlock()
+	c.mu.Lock()
+	conf := c.config.UploadTarget
+	d := c.config.ImageDirectory
+	c.mu.Unlock()
+	us, err := c.Uploads()
+	if err != nil || len(us) == 0 {
+		return err
+	}
+	uploader, err := NewUploader(conf)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(d)
+	if err != nil {
+		return err
+	}
+	for _, u := range us {
+		data, err := os.ReadFile(filepath.Join(dir, u.Image))
+		if os.IsNotExist(err) {
+			log.Println("camera subsystem: Dropping upload of deleted image:", u.Image)
+			if err := c.c.Store().Delete(UploadBucket, u.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err == nil {
+			err = uploader.Upload(u.Image, data)
+		}
+		if err != nil {
+			u.Attempts++
+			u.Error = err.Error()
+			if err := c.c.Store().Update(UploadBucket, u.ID, u); err != nil {
+				log.Println("ERROR: camera subsystem: Failed to update upload queue. Error:", err)
+			}
+			c.c.LogError("camera-upload", "Failed to upload image "+u.Image+". Error:"+err.Error())
+			return err
+		}
+		log.Println("camera subsystem: Uploaded image:", u.Image)
+		if err := c.c.Store().Delete(UploadBucket, u.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Controller) retryUploads(quit chan struct{}) {
+	ticker := time.NewTicker(_uploadRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.flushUploads(); err != nil {
+				log.Println("ERROR: camera subsystem: Failed to upload queued images. Error:", err)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package camera
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type standIn struct {
+	sync.Mutex
+	down    bool
+	uploads map[string][]byte
+	headers map[string]http.Header
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if s.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	s.uploads[r.URL.Path] = data
+	s.headers[r.URL.Path] = r.Header
+	w.WriteHeader(http.StatusCreated)
+}
+
+func newStandIn() (*standIn, *httptest.Server) {
+	s := &standIn{uploads: make(map[string][]byte), headers: make(map[string]http.Header)}
+	return s, httptest.NewServer(s)
+}
+
+func TestSigningKey(t *testing.T) {
+	// example from the AWS signature version 4 documentation
+	k := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	if h := hex.EncodeToString(k); h != "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d" {
+		t.Error("Unexpected signing key:", h)
+	}
+}
+
+func TestUploaders(t *testing.T) {
+	s, ts := newStandIn()
+	defer ts.Close()
+	data := []byte("image")
+
+	u, err := NewUploader(UploadConfig{Type: WebDAVTarget, WebDAV: WebDAVConfig{URL: ts.URL + "/dav/", Username: "reef", Password: "pi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Upload("a.png", data); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.uploads["/dav/a.png"]) != "image" {
+		t.Error("Image should be uploaded to the WebDAV collection, found:", s.uploads)
+	}
+	if user, pass, _ := (&http.Request{Header: s.headers["/dav/a.png"]}).BasicAuth(); user != "reef" || pass != "pi" {
+		t.Error("WebDAV upload should use basic auth")
+	}
+
+	u, err = NewUploader(UploadConfig{Type: S3Target, S3: S3Config{Endpoint: ts.URL, Region: "eu-west-1", Bucket: "reef", Prefix: "tank", AccessKey: "AK", SecretKey: "SK"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Upload("b.png", data); err != nil {
+		t.Fatal(err)
+	}
+	h := s.headers["/reef/tank/b.png"]
+	if h == nil {
+		t.Fatal("Image should be uploaded as object tank/b.png of bucket reef, found:", s.uploads)
+	}
+	auth := h.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AK/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		t.Error("Unexpected authorization header:", auth)
+	}
+	if h.Get("x-amz-content-sha256") != sha256Hex(data) {
+		t.Error("Payload hash header should match the image")
+	}
+	if _, err := NewUploader(UploadConfig{Type: S3Target, S3: S3Config{Endpoint: ts.URL}}); err == nil {
+		t.Error("S3 target without bucket and credentials should fail validation")
+	}
+
+	dir := t.TempDir()
+	u, err = NewUploader(UploadConfig{Type: DirectoryTarget, Directory: MountConfig{Path: dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Upload("c.png", data); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := os.ReadFile(filepath.Join(dir, "c.png")); err != nil || string(d) != "image" {
+		t.Error("Image should be copied to the upload directory. Error:", err)
+	}
+	if _, err := NewUploader(UploadConfig{}); err == nil {
+		t.Error("Missing upload target should fail validation")
+	}
+}
+
+func TestUploadQueue(t *testing.T) {
+	s, ts := newStandIn()
+	defer ts.Close()
+	c, tr := newTestCamera(t)
+	c.config.Upload = true
+	c.config.UploadTarget = UploadConfig{Type: WebDAVTarget, WebDAV: WebDAVConfig{URL: ts.URL}}
+	if err := saveConfig(c.c.Store(), c.config); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	first := addImage(t, c, "", now.Add(-time.Minute))
+	second := addImage(t, c, "", now)
+	deleted := addImage(t, c, "", now.Add(time.Minute))
+
+	s.Lock()
+	s.down = true
+	s.Unlock()
+	c.uploadImage(first.Name)
+	c.uploadImage(second.Name)
+	c.uploadImage(deleted.Name)
+	us, err := c.Uploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 3 || us[0].Image != first.Name || us[0].Attempts != 3 || us[0].Error == "" {
+		t.Fatal("Failed uploads should stay queued in order, found:", us)
+	}
+	if err := os.Remove(filepath.Join(c.config.ImageDirectory, deleted.Name)); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Lock()
+	s.down = false
+	s.Unlock()
+	if err := tr.Do("POST", "/api/camera/uploads/retry", new(bytes.Buffer), nil); err != nil {
+		t.Fatal("Failed to retry uploads using api. Error:", err)
+	}
+	if len(s.uploads) != 2 || s.uploads["/"+first.Name] == nil || s.uploads["/"+second.Name] == nil {
+		t.Error("Queued images should be uploaded once the target is back, found:", len(s.uploads))
+	}
+	var queue []Upload
+	if err := tr.Do("GET", "/api/camera/uploads", new(bytes.Buffer), &queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 0 {
+		t.Error("Upload queue should be empty, found:", queue)
+	}
+
+	conf := c.config
+	conf.UploadTarget = UploadConfig{Type: "drive"}
+	if err := saveConfig(c.c.Store(), conf); err == nil {
+		t.Error("Unknown upload target should fail validation when uploads are enabled")
+	}
+}
@@ -45,7 +45,7 @@ func (c *Controller) GetEquipment(w http.ResponseWriter, r *http.Request) {
 	utils.JSONGetResponse(fn, w, r)
 }
 
-func (c Controller) ListEquipment(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) ListEquipment(w http.ResponseWriter, r *http.Request) {
 	fn := func() (interface{}, error) {
 		return c.List()
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/kidoman/embd"
 	"github.com/reef-pi/reef-pi/controller"
@@ -20,6 +21,8 @@ type Controller struct {
 	telemetry telemetry.Telemetry
 	store     storage.Store
 	outlets   *connectors.Outlets
+	mu        sync.Mutex
+	revisions map[string]uint64
 }
 
 func New(config Config, c controller.Controller) *Controller {
@@ -28,6 +31,7 @@ func New(config Config, c controller.Controller) *Controller {
 		telemetry: c.Telemetry(),
 		store:     c.Store(),
 		outlets:   c.DM().Outlets(),
+		revisions: make(map[string]uint64),
 	}
 }
 
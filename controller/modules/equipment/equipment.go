@@ -25,7 +25,7 @@ func (c *Controller) Get(id string) (Equipment, error) {
 	return eq, c.store.Get(Bucket, id, &eq)
 }
 
-func (c Controller) List() ([]Equipment, error) {
+func (c *Controller) List() ([]Equipment, error) {
 	es := []Equipment{}
 	fn := func(_ string, v []byte) error {
 		var eq Equipment
@@ -58,9 +58,20 @@ func (c *Controller) Update(id string, eq Equipment) error {
 	if err := c.store.Update(Bucket, id, eq); err != nil {
 		return err
 	}
+	c.mu.Lock()
+	c.revisions[id]++
+	c.mu.Unlock()
 	return c.updateOutlet(eq)
 }
 
+// Revision counts the updates of an equipment since start, letting automations
+// notice when others switched it
+func (c *Controller) Revision(id string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.revisions[id]
+}
+
 func (c *Controller) Delete(id string) error {
 	_, err := c.Get(id)
 	if err != nil {
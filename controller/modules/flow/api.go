@@ -17,6 +17,7 @@ func (f *Controller) LoadAPI(r *mux.Router) {
 	r.HandleFunc("/api/fcs/{id}", f.update).Methods("POST")
 	r.HandleFunc("/api/fcs/{id}", f.delete).Methods("DELETE")
 	r.HandleFunc("/api/fcs/{id}/usage", f.getUsage).Methods("GET")
+	r.HandleFunc("/api/fcs/{id}/pump", f.getPumpHealth).Methods("GET")
 }
 func (f *Controller) currentReading(w http.ResponseWriter, r *http.Request) {
 	fn := func(id string) (interface{}, error) {
@@ -24,8 +25,11 @@ func (f *Controller) currentReading(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return nil, err
 		}
+		fc.Lock()
+		defer fc.Unlock()
 		v := make(map[string]float64)
 		v["flow"] = fc.FlowCount
+		v["flow_rate"] = fc.FlowRate
 		return v, nil
 	}
 	utils.JSONGetResponse(fn, w, r)
@@ -37,7 +41,7 @@ func (f *Controller) read(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return nil, err
 		}
-		return f.Read(*fc)
+		return f.Read(fc)
 	}
 	utils.JSONGetResponse(fn, w, r)
 
@@ -50,7 +54,7 @@ func (f *Controller) get(w http.ResponseWriter, r *http.Request) {
 	utils.JSONGetResponse(fn, w, r)
 }
 
-func (c Controller) list(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) list(w http.ResponseWriter, r *http.Request) {
 	fn := func() (interface{}, error) {
 		return c.List()
 	}
@@ -60,7 +64,7 @@ func (c Controller) list(w http.ResponseWriter, r *http.Request) {
 func (c *Controller) create(w http.ResponseWriter, r *http.Request) {
 	var f FC
 	fn := func() error {
-		return c.Create(f)
+		return c.Create(&f)
 	}
 	utils.JSONCreateResponse(&f, fn, w, r)
 }
@@ -77,6 +81,11 @@ func (f *Controller) getUsage(w http.ResponseWriter, r *http.Request) {
 	utils.JSONGetResponse(fn, w, r)
 }
 
+func (c *Controller) getPumpHealth(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) { return c.PumpHealth(id) }
+	utils.JSONGetResponse(fn, w, r)
+}
+
 func (c *Controller) update(w http.ResponseWriter, r *http.Request) {
 	var f FC
 	fn := func(id string) error {
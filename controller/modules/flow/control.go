@@ -1,54 +1,174 @@
 package flow
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/storage"
 	"github.com/reef-pi/reef-pi/controller/telemetry"
 )
 
+// LowFlow raises an alert and runs Macro once the flow rate stays below Min
+// (litres per minute) for Duration seconds, e.g. on pump failure or a clogged
+// overflow
+type LowFlow struct {
+	Enable   bool    `json:"enable"`
+	Min      float64 `json:"min"`
+	Duration int     `json:"duration"`
+	Macro    string  `json:"macro"`
+}
+
+func (l LowFlow) Validate() error {
+	if !l.Enable {
+		return nil
+	}
+	if l.Min <= 0 {
+		return fmt.Errorf("Low flow threshold should be positive. Supplied:%f", l.Min)
+	}
+	if l.Duration < 0 {
+		return fmt.Errorf("Low flow duration can not be negative. Supplied:%d", l.Duration)
+	}
+	return nil
+}
+
+type lowFlow struct {
+	since  time.Time
+	raised bool
+}
+
+// flowRate converts the pulses counted in a period into calibrated litres per
+// minute
+func (fc *FC) flowRate(pulses uint64) float64 {
+	v := float64(pulses) / fc.Rate * 60 / float64(fc.Period)
+	if fc.calibrator != nil {
+		v = fc.calibrator.Calibrate(v)
+	}
+	return telemetry.TwoDecimal(v)
+}
+
 func (c *Controller) Check(fc *FC) {
-	currentPulseCount := fc.PulseCount
-	lastPulseCount, ok := c.lastpulses[fc.ID]
-	if ok && fc.FlowCount != 0 &&
-		currentPulseCount == lastPulseCount {
-		// log.Println("sensor flow same pulse value, skipping check calculations")
+	fc.Lock()
+	enabled := fc.Enable
+	pulses := fc.PulseCount
+	fc.Unlock()
+	if !enabled {
 		return
 	}
-	c.lastpulses[fc.ID] = currentPulseCount
-	log.Println("flow sub-system:  sensor ", fc.Name,
-		" lastValue:", lastPulseCount,
-		" currentValue:", currentPulseCount, " enabled ", fc.Enable)
-	if !fc.Enable {
-		return
+	c.Lock()
+	last, ok := c.lastpulses[fc.ID]
+	c.lastpulses[fc.ID] = pulses
+	c.Unlock()
+	if !ok || pulses < last {
+		last = pulses
 	}
 
-	c.c.Telemetry().EmitMetric(fc.Name, "reading", float64(currentPulseCount))
 	fc.Lock()
-	fc.FlowCount = float64(currentPulseCount) / fc.Rate
-	if err := c.c.Store().Update(Bucket, fc.ID, fc); err != nil {
-		log.Fatalln(err.Error())
+	rate := fc.flowRate(pulses - last)
+	count := telemetry.TwoDecimal(float64(pulses) / fc.Rate)
+	changed := rate != fc.FlowRate || count != fc.FlowCount
+	fc.FlowRate = rate
+	fc.FlowCount = count
+	var data []byte
+	var err error
+	if changed {
+		// snapshot under the lock, the pulse watcher must not wait on the store
+		data, err = json.Marshal(fc)
 	}
 	fc.Unlock()
-	u := controller.Observation{
-		Time:  telemetry.TeleTime(time.Now()),
-		Value: fc.FlowCount,
+	if changed && err == nil {
+		err = c.c.Store().RawUpdate(Bucket, fc.ID, data)
+	}
+	if err != nil {
+		log.Println("ERROR: flow sub-system. Failed to save sensor:", fc.Name, "Error:", err)
+		c.c.LogError("fc-"+fc.ID, "Failed to save flow sensor "+fc.Name+". Error:"+err.Error())
 	}
-	c.NotifyIfNeeded(*fc, fc.FlowCount)
-	c.statsMgr.Update(fc.ID, u)
+	log.Println("flow sub-system: sensor:", fc.Name, "pulses:", pulses-last, "rate:", rate, "L/min")
+	c.c.Telemetry().EmitMetric(fc.Name, "reading", rate)
+	c.statsMgr.Update(fc.ID, controller.NewObservation(rate))
+	c.NotifyIfNeeded(fc)
+	now := time.Now()
+	c.checkLowFlow(fc, rate, now)
+	c.checkPump(fc, rate, now)
 }
 
-func (c *Controller) NotifyIfNeeded(fc FC, count float64) {
-	if !fc.Notify.Enable {
+// NotifyIfNeeded alerts when the total volume reaches the notify count
+func (c *Controller) NotifyIfNeeded(fc *FC) {
+	fc.Lock()
+	name := fc.Name
+	notify := fc.Notify
+	count := fc.FlowCount
+	fc.Unlock()
+	if !notify.Enable {
 		return
 	}
-	subject := fmt.Sprintf("[Reef-Pi ALERT] flow of '%s' out of range", fc.Name)
+	subject := fmt.Sprintf("[Reef-Pi ALERT] flow of '%s' out of range", name)
 	format := "Current flow count (%f) is out of acceptable range ( %f )"
-	body := fmt.Sprintf(format, count, fc.Notify.Count)
-	if fc.FlowCount >= fc.Notify.Count {
+	body := fmt.Sprintf(format, count, notify.Count)
+	if count >= notify.Count {
 		c.c.Telemetry().Alert(subject, "Flow sensor has reached the specified count cap."+body)
 		return
 	}
 }
+
+func (c *Controller) checkLowFlow(fc *FC, rate float64, now time.Time) {
+	fc.Lock()
+	l := fc.LowFlow
+	name := fc.Name
+	fc.Unlock()
+	if !l.Enable {
+		return
+	}
+	c.Lock()
+	s, ok := c.lows[fc.ID]
+	if !ok {
+		s = new(lowFlow)
+		c.lows[fc.ID] = s
+	}
+	if rate >= l.Min {
+		restored := s.raised
+		s.since = time.Time{}
+		s.raised = false
+		c.Unlock()
+		if restored {
+			log.Println("flow sub-system: flow restored for sensor:", name)
+			subject := fmt.Sprintf("[Reef-Pi ALERT] flow of '%s' restored", name)
+			c.c.Telemetry().Alert(subject, fmt.Sprintf("Flow rate (%.2f L/min) is back above %.2f L/min.", rate, l.Min))
+		}
+		return
+	}
+	if s.since.IsZero() {
+		s.since = now
+	}
+	since := s.since
+	trigger := !s.raised && now.Sub(since) >= time.Duration(l.Duration)*time.Second
+	if trigger {
+		s.raised = true
+	}
+	c.Unlock()
+	if !trigger {
+		return
+	}
+	log.Println("WARNING: flow sub-system: low flow on sensor:", name, "rate:", rate)
+	c.c.LogError("fc-"+fc.ID, "Low flow on sensor "+name)
+	subject := fmt.Sprintf("[Reef-Pi ALERT] low flow on '%s'", name)
+	format := "Flow rate (%.2f L/min) has been below %.2f L/min since %s. Check pumps and overflows."
+	c.c.Telemetry().Alert(subject, fmt.Sprintf(format, rate, l.Min, since.Format(time.RFC1123)))
+	if l.Macro == "" {
+		return
+	}
+	sub, err := c.c.Subsystem(storage.MacroBucket)
+	if err != nil {
+		log.Println("ERROR: flow sub-system: macro subsystem is not available. Error:", err)
+		return
+	}
+	// macros may take long, do not delay the next check
+	go func() {
+		if err := sub.On(l.Macro, false); err != nil {
+			log.Println("ERROR: flow sub-system: Failed to trigger low flow macro. Error:", err)
+			c.c.LogError("fc-"+fc.ID, "Failed to trigger low flow macro. Error:"+err.Error())
+		}
+	}()
+}
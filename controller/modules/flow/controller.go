@@ -3,6 +3,7 @@ package flow
 import (
 	"encoding/json"
 	"log"
+	"sync"
 
 	"github.com/kidoman/embd"
 	"github.com/reef-pi/reef-pi/controller"
@@ -13,33 +14,38 @@ import (
 
 const Bucket = storage.FlowBucket
 const UsageBucket = storage.FlowUsageBucket
+const PumpBucket = storage.FlowPumpBucket
 
 type Config struct {
 	DevMode bool `json:"dev_mode"`
 }
 type Controller struct {
+	sync.Mutex
 	config     Config
 	c          controller.Controller
 	inlets     *connectors.Inlets
-	pins       map[string]*embd.DigitalPin
 	devMode    bool
 	quitters   map[string]chan struct{}
+	dones      map[string]chan struct{}
 	statsMgr   telemetry.StatsManager
 	fcs        map[string]*FC
-	pulses     map[string]chan interface{}
 	lastpulses map[string]uint64
+	lows       map[string]*lowFlow
+	pumps      map[string]*pumpState
 }
 
 func New(devMode bool, c controller.Controller) (*Controller, error) {
 	return &Controller{
 		c:          c,
+		config:     Config{DevMode: devMode},
 		inlets:     c.DM().Inlets(),
 		devMode:    devMode,
-		pins:       make(map[string]*embd.DigitalPin),
 		quitters:   make(map[string]chan struct{}),
-		pulses:     make(map[string]chan interface{}),
+		dones:      make(map[string]chan struct{}),
 		fcs:        make(map[string]*FC),
 		lastpulses: make(map[string]uint64),
+		lows:       make(map[string]*lowFlow),
+		pumps:      make(map[string]*pumpState),
 		statsMgr:   c.Telemetry().NewStatsManager(UsageBucket),
 	}, nil
 }
@@ -51,19 +57,26 @@ func (c *Controller) Setup() error {
 	if err := c.c.Store().CreateBucket(UsageBucket); err != nil {
 		return err
 	}
+	if err := c.c.Store().CreateBucket(PumpBucket); err != nil {
+		return err
+	}
 	fcs, err := c.List()
 	if err != nil {
 		return err
 	}
-	for i, tc := range fcs {
-		c.fcs[tc.ID] = &fcs[i]
+	for _, fc := range fcs {
+		fc.loadCalibrator()
+		c.fcs[fc.ID] = fc
 	}
 	return nil
 }
 
 func (c *Controller) Start() {
-	if !c.config.DevMode {
-		embd.InitGPIO()
+	if !c.devMode {
+		if err := embd.InitGPIO(); err != nil {
+			log.Println("ERROR: flow subsystem. Failed to initialize gpio. Error:", err)
+			c.c.LogError("flow-gpio", "Failed to initialize gpio. Error:"+err.Error())
+		}
 	}
 	for _, f := range c.fcs {
 		if !f.Enable {
@@ -77,40 +90,52 @@ func (c *Controller) Start() {
 		if err := c.statsMgr.Load(f.ID, fn); err != nil {
 			log.Println("ERROR: flow subsystem. Failed to load usage. Error:", err)
 		}
-		quit := make(chan struct{})
-		c.quitters[f.ID] = quit
-		pulse := make(chan interface{})
-		c.pulses[f.ID] = pulse
-		c.preparePin(f.ID, f)
-		go c.Run(f, quit)
+		c.start(f)
 	}
 }
+
 func (c *Controller) Stop() {
-	for id, quit := range c.quitters {
-		close(quit)
-		pulse := c.pulses[id]
-		close(pulse)
-		c.releasePin(id)
+	for id := range c.quitters {
+		c.stop(id)
 		if err := c.statsMgr.Save(id); err != nil {
 			log.Println("ERROR: flow controller. Failed to save usage. Error:", err)
 		}
 		log.Println("flow sub-system: Saved usage data of sensor:", id)
-		delete(c.quitters, id)
-		delete(c.pulses, id)
-		delete(c.pins, id)
 	}
 }
 
 func (c *Controller) On(id string, on bool) error {
-	tc, err := c.Get(id)
+	fc, err := c.Get(id)
 	if err != nil {
 		return err
 	}
-	tc.SetEnable(on)
-	return c.Update(id, tc)
+	fc.SetEnable(on)
+	return c.Update(id, fc)
 }
 
 func (c *Controller) InUse(depType, id string) ([]string, error) {
 	var deps []string
+	c.Lock()
+	defer c.Unlock()
+	switch depType {
+	case storage.InletBucket:
+		for _, fc := range c.fcs {
+			if fc.Pin == id {
+				deps = append(deps, fc.Name)
+			}
+		}
+	case storage.MacroBucket:
+		for _, fc := range c.fcs {
+			if fc.LowFlow.Enable && fc.LowFlow.Macro == id {
+				deps = append(deps, fc.Name)
+			}
+		}
+	case storage.EquipmentBucket:
+		for _, fc := range c.fcs {
+			if fc.Pump.Enable && fc.Pump.Equipment == id {
+				deps = append(deps, fc.Name)
+			}
+		}
+	}
 	return deps, nil
 }
@@ -0,0 +1,448 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/modules/equipment"
+	"github.com/reef-pi/reef-pi/controller/storage"
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+// macroStub reports triggered macros on a channel, macros are run
+// asynchronously
+type macroStub struct {
+	controller.Subsystem
+	calls chan string
+}
+
+func (s *macroStub) On(id string, _ bool) error {
+	s.calls <- id
+	return nil
+}
+
+type telemetryStub struct {
+	telemetry.Telemetry
+	alerts []string
+}
+
+func (t *telemetryStub) Alert(subject, _ string) (bool, error) {
+	t.alerts = append(t.alerts, subject)
+	return true, nil
+}
+
+type testController struct {
+	controller.Controller
+	t      *telemetryStub
+	macros *macroStub
+	eqs    *equipment.Controller
+}
+
+func (c *testController) Telemetry() telemetry.Telemetry {
+	return c.t
+}
+
+func (c *testController) Subsystem(name string) (controller.Subsystem, error) {
+	switch name {
+	case storage.MacroBucket:
+		return c.macros, nil
+	case storage.EquipmentBucket:
+		return c.eqs, nil
+	}
+	return c.Controller.Subsystem(name)
+}
+
+func newTestFlow(t *testing.T) (*Controller, *testController) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { con.Store().Close() })
+	tc := &testController{
+		Controller: con,
+		t:          &telemetryStub{Telemetry: con.Telemetry()},
+		macros:     &macroStub{calls: make(chan string, 1)},
+	}
+	outlets := con.DM().Outlets()
+	if err := outlets.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := outlets.Create(connectors.Outlet{Name: "pump", Pin: 23, Driver: "rpi"}); err != nil {
+		t.Fatal(err)
+	}
+	tc.eqs = equipment.New(equipment.Config{DevMode: true}, tc)
+	if err := tc.eqs.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.eqs.Create(equipment.Equipment{Name: "return", Outlet: "1", On: true}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(true, tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	return c, tc
+}
+
+func TestFlowController(t *testing.T) {
+	c, _ := newTestFlow(t)
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	c.Start()
+	defer c.Stop()
+
+	fc := FC{
+		Name:   "return",
+		Rate:   450,
+		Period: 60,
+		Enable: true,
+		Pin:    "1",
+	}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(&fc)
+	if err := tr.Do("PUT", "/api/fcs", body, nil); err != nil {
+		t.Fatal("Failed to create flow sensor using api. Error:", err)
+	}
+	var fcs []FC
+	if err := tr.Do("GET", "/api/fcs", new(bytes.Buffer), &fcs); err != nil {
+		t.Fatal("Failed to list flow sensors using api. Error:", err)
+	}
+	if len(fcs) != 1 {
+		t.Fatal("Expected a single flow sensor, found:", len(fcs))
+	}
+	var f FC
+	if err := tr.Do("GET", "/api/fcs/1", new(bytes.Buffer), &f); err != nil {
+		t.Fatal("Failed to get flow sensor using api. Error:", err)
+	}
+	c.Lock()
+	done := c.dones["1"]
+	c.Unlock()
+	f.Name = "overflow"
+	body.Reset()
+	json.NewEncoder(body).Encode(&f)
+	if err := tr.Do("POST", "/api/fcs/1", body, nil); err != nil {
+		t.Fatal("Failed to update flow sensor using api. Error:", err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Error("Update should wait for the running sensor to stop")
+	}
+	c.Lock()
+	running := len(c.dones)
+	c.Unlock()
+	if running != 1 {
+		t.Error("Updated sensor should run once, found:", running)
+	}
+
+	// dev mode simulates pulses
+	for i := 0; i < 100; i++ {
+		if n, _ := c.Read(c.fcs["1"]); n > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	var pulses uint64
+	if err := tr.Do("GET", "/api/fcs/1/read", new(bytes.Buffer), &pulses); err != nil {
+		t.Fatal("Failed to read flow sensor using api. Error:", err)
+	}
+	if pulses == 0 {
+		t.Error("Dev mode should simulate pulses")
+	}
+	var reading map[string]float64
+	if err := tr.Do("GET", "/api/fcs/1/current_reading", new(bytes.Buffer), &reading); err != nil {
+		t.Fatal("Failed to get current reading using api. Error:", err)
+	}
+	if _, ok := reading["flow_rate"]; !ok {
+		t.Error("Current reading should include the flow rate, found:", reading)
+	}
+	if err := tr.Do("GET", "/api/fcs/1/usage", new(bytes.Buffer), nil); err != nil {
+		t.Error("Failed to get usage using api. Error:", err)
+	}
+	if err := c.On("1", false); err != nil {
+		t.Error(err)
+	}
+	if err := tr.Do("DELETE", "/api/fcs/1", new(bytes.Buffer), nil); err != nil {
+		t.Fatal("Failed to delete flow sensor using api. Error:", err)
+	}
+}
+
+func TestFlowValidate(t *testing.T) {
+	cases := map[string]*FC{
+		"period":   {Rate: 450},
+		"rate":     {Period: 60},
+		"low flow": {Rate: 450, Period: 60, LowFlow: LowFlow{Enable: true}},
+		"duration": {Rate: 450, Period: 60, LowFlow: LowFlow{Enable: true, Min: 1, Duration: -1}},
+	}
+	for name, fc := range cases {
+		if err := fc.Validate(); err == nil {
+			t.Error("Invalid", name, "should not be accepted")
+		}
+	}
+	fc := FC{Rate: 450, Period: 60, LowFlow: LowFlow{Enable: true, Min: 2, Duration: 30}}
+	if err := fc.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlowRate(t *testing.T) {
+	fc := FC{Rate: 450, Period: 30}
+	if r := fc.flowRate(900); r != 4 {
+		t.Error("Expected 4 L/min, found:", r)
+	}
+	c, _ := newTestFlow(t)
+	fc.Name = "return"
+	fc.Enable = true
+	if err := c.Create(&fc); err != nil {
+		t.Fatal(err)
+	}
+	f, err := c.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.stop(f.ID)
+	c.Lock()
+	c.lastpulses[f.ID] = 0
+	c.Unlock()
+	f.Lock()
+	f.PulseCount = 1350
+	f.Unlock()
+	c.Check(f)
+	if f.FlowRate != 6 || f.FlowCount != 3 {
+		t.Error("Expected a flow rate of 6 L/min and a count of 3 L, found:", f.FlowRate, f.FlowCount)
+	}
+	f.Lock()
+	f.PulseCount = 1800
+	f.Unlock()
+	c.Check(f)
+	if f.FlowRate != 2 {
+		t.Error("Flow rate should only account for pulses of the last period, found:", f.FlowRate)
+	}
+	fcs, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fcs) != 1 || fcs[0].FlowRate != 2 || fcs[0].FlowCount != 4 {
+		t.Error("Flow rate and count should be saved, found:", fcs)
+	}
+}
+
+func TestLowFlow(t *testing.T) {
+	c, tc := newTestFlow(t)
+	fc := &FC{
+		ID:      "1",
+		Name:    "return",
+		LowFlow: LowFlow{Enable: true, Min: 5, Duration: 60, Macro: "2"},
+	}
+	now := time.Now()
+	c.checkLowFlow(fc, 2, now)
+	c.checkLowFlow(fc, 2, now.Add(30*time.Second))
+	if len(tc.t.alerts) != 0 {
+		t.Fatal("Low flow should not alert before the duration, found:", tc.t.alerts)
+	}
+	c.checkLowFlow(fc, 2, now.Add(time.Minute))
+	if len(tc.t.alerts) != 1 {
+		t.Fatal("Sustained low flow should alert, found:", tc.t.alerts)
+	}
+	select {
+	case id := <-tc.macros.calls:
+		if id != "2" {
+			t.Error("Expected low flow macro '2', found:", id)
+		}
+	case <-time.After(time.Second):
+		t.Error("Sustained low flow should trigger the macro")
+	}
+	c.checkLowFlow(fc, 2, now.Add(2*time.Minute))
+	if len(tc.t.alerts) != 1 {
+		t.Error("Low flow should alert only once, found:", tc.t.alerts)
+	}
+	c.checkLowFlow(fc, 6, now.Add(3*time.Minute))
+	if len(tc.t.alerts) != 2 {
+		t.Error("Restored flow should alert, found:", tc.t.alerts)
+	}
+	c.checkLowFlow(fc, 6, now.Add(4*time.Minute))
+	c.checkLowFlow(fc, 2, now.Add(5*time.Minute))
+	if len(tc.t.alerts) != 2 {
+		t.Error("Low flow timer should restart after recovery, found:", tc.t.alerts)
+	}
+	deps, err := c.InUse(storage.MacroBucket, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps) != 0 {
+		t.Error("Unknown sensors should not use the macro, found:", deps)
+	}
+}
+
+func TestPumpHealth(t *testing.T) {
+	c, tc := newTestFlow(t)
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	fc := FC{
+		Name:   "return",
+		Rate:   450,
+		Period: 60,
+		Pump:   Pump{Enable: true, Equipment: "1", Min: 5},
+	}
+	if err := c.Create(&fc); err == nil {
+		t.Error("Pump checks should be validated")
+	}
+	fc.Pump.Checks = 2
+	fc.Pump.PowerCycle = true
+	fc.Pump.Retries = 1
+	if err := c.Create(&fc); err != nil {
+		t.Fatal(err)
+	}
+	deps, err := c.InUse(storage.EquipmentBucket, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps) != 1 {
+		t.Error("Pump equipment should be in use, found:", deps)
+	}
+	f, err := c.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cycled := func() {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			c.Lock()
+			cycling := c.pumps[f.ID].cycling
+			c.Unlock()
+			if !cycling {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		eq, err := tc.eqs.Get("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !eq.On {
+			t.Error("Pump should be back on after power cycle")
+		}
+	}
+	now := time.Now()
+	c.checkPump(f, 1, now)
+	if len(tc.t.alerts) != 0 {
+		t.Fatal("Pump should not fail before the consecutive checks, found:", tc.t.alerts)
+	}
+	f.Lock()
+	f.PulseCount = 900
+	f.Unlock()
+	c.checkPump(f, 1, now.Add(time.Minute))
+	if len(tc.t.alerts) != 1 {
+		t.Fatal("No flow from a running pump should alert, found:", tc.t.alerts)
+	}
+	cycled()
+	c.Lock()
+	last := c.lastpulses[f.ID]
+	c.Unlock()
+	if last != 900 {
+		t.Error("Power cycle should reset the pulses of the next period, found:", last)
+	}
+	c.checkPump(f, 1, now.Add(2*time.Minute))
+	c.checkPump(f, 1, now.Add(3*time.Minute))
+	if len(tc.t.alerts) != 1 {
+		t.Fatal("Period spanning the power cycle should not count as a check, found:", tc.t.alerts)
+	}
+	c.checkPump(f, 1, now.Add(4*time.Minute))
+	if len(tc.t.alerts) != 2 {
+		t.Fatal("Exhausted power cycle retries should alert, found:", tc.t.alerts)
+	}
+	c.checkPump(f, 1, now.Add(5*time.Minute))
+	c.checkPump(f, 1, now.Add(6*time.Minute))
+	if len(tc.t.alerts) != 2 {
+		t.Error("Failed pump should not alert again, found:", tc.t.alerts)
+	}
+	c.checkPump(f, 6, now.Add(7*time.Minute))
+	if len(tc.t.alerts) != 3 {
+		t.Error("Recovered pump should alert, found:", tc.t.alerts)
+	}
+	if err := tc.eqs.On("1", false); err != nil {
+		t.Fatal(err)
+	}
+	c.checkPump(f, 0, now.Add(8*time.Minute))
+	c.checkPump(f, 0, now.Add(9*time.Minute))
+	if len(tc.t.alerts) != 3 {
+		t.Error("Pump switched off should not fail, found:", tc.t.alerts)
+	}
+
+	var h PumpHealth
+	if err := tr.Do("GET", "/api/fcs/1/pump", new(bytes.Buffer), &h); err != nil {
+		t.Fatal("Failed to get pump health using api. Error:", err)
+	}
+	var types []string
+	for _, e := range h.Events {
+		types = append(types, e.Type)
+	}
+	expected := []string{"failed", "power_cycle", "gave_up", "healthy", "off"}
+	if h.Status != PumpOff || len(types) != len(expected) {
+		t.Fatal("Unexpected pump health history:", h.Status, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Error("Expected pump event", expected[i], "found:", types[i])
+		}
+	}
+	if err := c.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.PumpHealth("1"); err == nil {
+		t.Error("Pump health of deleted sensor should not be available")
+	}
+}
+
+func TestPowerCycleInterrupted(t *testing.T) {
+	c, tc := newTestFlow(t)
+	fc := &FC{
+		Name:   "return",
+		Rate:   450,
+		Period: 60,
+		Pump:   Pump{Enable: true, Equipment: "1", Min: 5, Checks: 1, PowerCycle: true, Retries: 1, OffTime: 1},
+	}
+	if err := c.Create(fc); err != nil {
+		t.Fatal(err)
+	}
+	c.Lock()
+	c.pumps[fc.ID] = &pumpState{cycling: true}
+	c.Unlock()
+	rev := tc.eqs.Revision("1")
+	done := make(chan struct{})
+	go func() {
+		c.powerCycle(fc, fc.Name, fc.Pump, 1)
+		close(done)
+	}()
+	for i := 0; i < 100 && tc.eqs.Revision("1") == rev; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	// leak shutoff while the pump is off
+	if err := tc.eqs.On("1", false); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	eq, err := tc.eqs.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eq.On {
+		t.Error("Power cycle should not switch on a pump others switched off")
+	}
+	h, err := c.PumpHealth(fc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.Events); n != 1 || h.Events[0].Type != "power_cycle_aborted" {
+		t.Error("Interrupted power cycle should be recorded, found:", h.Events)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/kidoman/embd"
 	"github.com/reef-pi/hal"
 
 	"github.com/reef-pi/reef-pi/controller/telemetry"
@@ -32,32 +31,47 @@ type FC struct {
 	Pin               string            `json:"pin"`
 	CalibrationPoints []hal.Measurement `json:"calibration_points"`
 	PulseCount        uint64            `json:"pulse_count"`
+	FlowRate          float64           `json:"flow_rate"`
+	LowFlow           LowFlow           `json:"low_flow"`
+	Pump              Pump              `json:"pump"`
 	calibrator        hal.Calibrator
 }
 
+// Validate checks the settings of a flow sensor. Rate is the number of pulses
+// per litre, e.g. 450 for a YF-S201 sensor. Period is in seconds.
+func (fc *FC) Validate() error {
+	if fc.Period <= 0 {
+		return fmt.Errorf("Period should be positive. Supplied:%d", fc.Period)
+	}
+	if fc.Rate <= 0 {
+		return fmt.Errorf("Pulses per litre should be positive. Supplied:%f", fc.Rate)
+	}
+	if err := fc.LowFlow.Validate(); err != nil {
+		return err
+	}
+	return fc.Pump.Validate()
+}
+
 func (c *Controller) Get(id string) (*FC, error) {
+	c.Lock()
+	defer c.Unlock()
 	fc, ok := c.fcs[id]
 	if !ok {
-		return nil, fmt.Errorf("flow controller with id '%s' is not present", fc.ID)
+		return nil, fmt.Errorf("flow controller with id '%s' is not present", id)
 	}
 	return fc, nil
 }
 
-func (c Controller) List() ([]FC, error) {
-	fcs := []FC{}
+func (c *Controller) List() ([]*FC, error) {
+	fcs := []*FC{}
 	fn := func(_ string, v []byte) error {
-		var fc FC
-		if err := json.Unmarshal(v, &fc); err != nil {
+		fc := new(FC)
+		if err := json.Unmarshal(v, fc); err != nil {
 			return err
 		}
 		fcs = append(fcs, fc)
 		return nil
 	}
-
-	// demofc := FC{
-	// Enable: true, Name: "demo1", pulseCount: 0, ID: "1",
-	// Period: 1, MaxCount: 0, Pin: "17", Rate: 60 * 7.5}
-	// fcs = append(fcs, demofc)
 	return fcs, c.c.Store().List(Bucket, fn)
 }
 
@@ -72,91 +86,45 @@ func (fc *FC) loadCalibrator() {
 	}
 }
 
-func (c *Controller) Create(fc FC) error {
-	if fc.Period <= 0 {
-		return fmt.Errorf("Check period for flow controller must be greater than zero")
+func (c *Controller) Create(fc *FC) error {
+	if err := fc.Validate(); err != nil {
+		return err
 	}
 	fn := func(id string) interface{} {
 		fc.ID = id
-		return &fc
+		return fc
 	}
 	if err := c.c.Store().Create(Bucket, fn); err != nil {
 		return err
 	}
 	fc.loadCalibrator()
-	c.fcs[fc.ID] = &fc
+	c.Lock()
+	c.fcs[fc.ID] = fc
+	c.Unlock()
 	c.statsMgr.Initialize(fc.ID)
 	if fc.Enable {
-		pulse := make(chan interface{})
-		quit := make(chan struct{})
-		fc.FlowCount = 0
-		c.pulses[fc.ID] = pulse
-		c.quitters[fc.ID] = quit
-		c.preparePin(fc.ID, &fc)
-		go c.Run(&fc, quit)
+		c.start(fc)
 	}
 	return nil
 }
-func (c *Controller) releasePin(id string) {
-	if c.devMode {
-		return
-	}
-	pin, ok := c.pins[id]
-	if ok {
-		(*pin).StopWatching()
-		(*pin).Close()
-	}
 
-}
-func (c *Controller) preparePin(id string, f *FC) {
-	if c.devMode {
-		return
-	}
-	inlet, err := c.inlets.Get(f.Pin)
-	if err != nil {
-		log.Fatalln("flow subsystem. Failed to find inlet fc")
-		panic("Failed to get the inlet of fc")
-	}
-	inletpin := inlet.Pin
-	pin, err := embd.NewDigitalPin(inletpin)
-	if err != nil {
-		log.Fatalln("flow subsystem. Failed to allocate digital pin")
-		panic("flow subsystem. Failed to allocate digital pin")
-	}
-	pin.SetDirection(embd.In)
-	pin.ActiveLow(false)
-	c.pins[f.ID] = &pin
-}
 func (c *Controller) Update(id string, fc *FC) error {
 	fc.ID = id
-	if fc.Period <= 0 {
-		return fmt.Errorf("Period should be positive. Supplied:%d", fc.Period)
+	if err := fc.Validate(); err != nil {
+		return err
 	}
 	if err := c.c.Store().Update(Bucket, id, fc); err != nil {
 		return err
 	}
-
-	c.releasePin(fc.ID)
-
-	quit, ok := c.quitters[fc.ID]
-	if ok {
-		close(quit)
-		delete(c.quitters, fc.ID)
-	}
-	pulse, ok := c.pulses[fc.ID]
-	if ok {
-		close(pulse)
-		delete(c.pulses, fc.ID)
-	}
+	c.stop(id)
 	fc.loadCalibrator()
+	c.Lock()
 	c.fcs[fc.ID] = fc
+	delete(c.lows, id)
+	delete(c.pumps, id)
+	c.Unlock()
 	if fc.Enable {
-		quit := make(chan struct{})
-		pulse := make(chan interface{})
-		c.quitters[fc.ID] = quit
-		c.pulses[fc.ID] = pulse
-		c.preparePin(id, fc)
-		go c.Run(fc, quit)
+		c.start(fc)
 	}
 	return nil
 }
@@ -168,42 +136,81 @@ func (c *Controller) Delete(id string) error {
 	if err := c.c.Store().Delete(UsageBucket, id); err != nil {
 		log.Println("ERROR:  flow sub-system: Failed to delete usage details for sensor:", id)
 	}
-	c.releasePin(id)
+	if err := c.c.Store().Delete(PumpBucket, id); err != nil {
+		log.Println("ERROR:  flow sub-system: Failed to delete pump health of sensor:", id)
+	}
+	c.stop(id)
+	c.Lock()
+	delete(c.fcs, id)
+	delete(c.lows, id)
+	delete(c.pumps, id)
+	delete(c.lastpulses, id)
+	c.Unlock()
+	return nil
+}
+
+func (c *Controller) start(f *FC) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	c.Lock()
+	c.quitters[f.ID] = quit
+	c.dones[f.ID] = done
+	c.Unlock()
+	go func() {
+		defer close(done)
+		c.Run(f, quit)
+	}()
+}
+
+// stop waits for Run to release the sensor pin, embd hands out the same pin
+// to the next watcher
+func (c *Controller) stop(id string) {
+	c.Lock()
 	quit, ok := c.quitters[id]
+	done := c.dones[id]
 	if ok {
 		close(quit)
 		delete(c.quitters, id)
+		delete(c.dones, id)
 	}
-	pulse, ok := c.pulses[id]
+	c.Unlock()
 	if ok {
-		close(pulse)
-		delete(c.pulses, id)
+		<-done
 	}
-	delete(c.fcs, id)
-	return nil
 }
 
+// Run counts pulses of the sensor, simulated in dev mode, and checks the flow
+// rate every period until quit is closed
 func (c *Controller) Run(f *FC, quit chan struct{}) {
 	f.CreateFeed(c.c.Telemetry())
 	log.Println("flow sub-system. Start Running with ticks of ", f.Period*time.Second)
 	if f.Period <= 0 {
-		log.Printf(`ERROR: flow sub-system. Invalid period set for sensor:%s. 
-		Expected positive, found:%d\n`, f.Name, f.Period)
+		log.Printf("ERROR: flow sub-system. Invalid period set for sensor:%s. Expected positive, found:%d\n", f.Name, f.Period)
 		return
 	}
+	if c.devMode {
+		simulated := make(chan struct{})
+		go func() {
+			c.simulate(f, quit)
+			close(simulated)
+		}()
+		defer func() { <-simulated }()
+	} else {
+		pin, err := c.watch(f)
+		if err != nil {
+			log.Println("ERROR: flow sub-system. Failed to watch sensor:", f.Name, "Error:", err)
+			c.c.LogError("fc-"+f.ID, "Failed to watch flow sensor "+f.Name+". Error:"+err.Error())
+			return
+		}
+		defer release(pin)
+	}
+	f.Lock()
+	pulses := f.PulseCount
+	f.Unlock()
+	c.Lock()
+	c.lastpulses[f.ID] = pulses
+	c.Unlock()
 	ticker := time.NewTicker(f.Period * time.Second)
-	pulse, ok := c.pulses[f.ID]
-	if !ok {
-		log.Fatalln("flow subsystem. Failed to find pulse channel for fc")
-		panic("No pulse channel found for the flow sensor")
-	}
-	pin, ok := c.pins[f.ID]
-	if !ok && !c.devMode {
-		log.Fatalln("flow subsystem. Failed to find digitalPin")
-		panic("Failed to find digitalPin")
-	}
-
-	go f.Listen(c.devMode, pin, pulse, quit)
 	for {
 		select {
 		case <-ticker.C:
@@ -0,0 +1,257 @@
+package flow
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/modules/equipment"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const (
+	PumpHealthy = "healthy"
+	PumpFailed  = "failed"
+	PumpOff     = "off"
+
+	_maxPumpEvents = 100
+)
+
+// Pump links a flow sensor to the equipment driving its flow. While the
+// equipment is on, a flow rate below Min (litres per minute) for Checks
+// consecutive periods is a pump failure. With PowerCycle enabled, the
+// equipment is switched off for OffTime seconds and back on, up to Retries
+// times until the flow recovers.
+type Pump struct {
+	Enable     bool    `json:"enable"`
+	Equipment  string  `json:"equipment"`
+	Min        float64 `json:"min"`
+	Checks     int     `json:"checks"`
+	PowerCycle bool    `json:"power_cycle"`
+	Retries    int     `json:"retries"`
+	OffTime    int     `json:"off_time"`
+}
+
+func (p Pump) Validate() error {
+	if !p.Enable {
+		return nil
+	}
+	if p.Equipment == "" {
+		return fmt.Errorf("Pump equipment is not specified")
+	}
+	if p.Min <= 0 {
+		return fmt.Errorf("Expected pump flow should be positive. Supplied:%f", p.Min)
+	}
+	if p.Checks < 1 {
+		return fmt.Errorf("Pump checks should be at least one. Supplied:%d", p.Checks)
+	}
+	if p.PowerCycle && p.Retries < 1 {
+		return fmt.Errorf("Pump power cycle retries should be at least one. Supplied:%d", p.Retries)
+	}
+	if p.OffTime < 0 {
+		return fmt.Errorf("Pump off time can not be negative. Supplied:%d", p.OffTime)
+	}
+	return nil
+}
+
+// PumpEvent is an entry of the pump health history
+type PumpEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Rate    float64   `json:"rate"`
+	Message string    `json:"message"`
+}
+
+// PumpHealth is the pump state of a flow sensor, persisted across restarts
+type PumpHealth struct {
+	Status  string      `json:"status"`
+	Retries int         `json:"retries"`
+	Events  []PumpEvent `json:"events"`
+}
+
+type pumpState struct {
+	lows    int
+	cycling bool
+	skip    bool
+}
+
+// PumpHealth returns the pump health history of a sensor, sensors without
+// history are healthy
+func (c *Controller) PumpHealth(id string) (PumpHealth, error) {
+	if _, err := c.Get(id); err != nil {
+		return PumpHealth{}, err
+	}
+	var h PumpHealth
+	if err := c.c.Store().Get(PumpBucket, id, &h); err != nil {
+		return PumpHealth{Status: PumpHealthy, Events: []PumpEvent{}}, nil
+	}
+	return h, nil
+}
+
+// record appends an event to the pump health history of a sensor
+func (c *Controller) record(id, status string, retries int, e PumpEvent) {
+	h, _ := c.PumpHealth(id)
+	h.Status = status
+	h.Retries = retries
+	if e.Type != "" {
+		h.Events = append(h.Events, e)
+		if len(h.Events) > _maxPumpEvents {
+			h.Events = h.Events[len(h.Events)-_maxPumpEvents:]
+		}
+	}
+	if err := c.c.Store().Update(PumpBucket, id, h); err != nil {
+		log.Println("ERROR: flow sub-system: Failed to save pump health of sensor:", id, "Error:", err)
+	}
+}
+
+func (c *Controller) equipmentOn(id string) (bool, error) {
+	sub, err := c.c.Subsystem(storage.EquipmentBucket)
+	if err != nil {
+		return false, err
+	}
+	eqs, ok := sub.(*equipment.Controller)
+	if !ok {
+		return false, fmt.Errorf("Failed to cast equipment subsystem to equipment controller")
+	}
+	eq, err := eqs.Get(id)
+	if err != nil {
+		return false, err
+	}
+	return eq.On, nil
+}
+
+// checkPump cross checks the flow rate against the state of the linked
+// equipment
+func (c *Controller) checkPump(fc *FC, rate float64, now time.Time) {
+	fc.Lock()
+	p := fc.Pump
+	name := fc.Name
+	fc.Unlock()
+	if !p.Enable {
+		return
+	}
+	on, err := c.equipmentOn(p.Equipment)
+	if err != nil {
+		log.Println("ERROR: flow sub-system: Failed to get pump equipment of sensor:", name, "Error:", err)
+		c.c.LogError("fc-"+fc.ID, "Failed to get pump equipment of sensor "+name+". Error:"+err.Error())
+		return
+	}
+	h, _ := c.PumpHealth(fc.ID)
+	c.Lock()
+	s, ok := c.pumps[fc.ID]
+	if !ok {
+		s = new(pumpState)
+		c.pumps[fc.ID] = s
+	}
+	if s.cycling {
+		c.Unlock()
+		return
+	}
+	if s.skip {
+		// the period spans the power cycle, its rate does not reflect the pump
+		s.skip = false
+		c.Unlock()
+		return
+	}
+	if !on || rate >= p.Min {
+		s.lows = 0
+		c.Unlock()
+		switch {
+		case !on && h.Status != PumpOff:
+			c.record(fc.ID, PumpOff, 0, PumpEvent{Time: now, Type: "off", Rate: rate, Message: "Pump switched off"})
+		case on && h.Status != PumpHealthy:
+			msg := fmt.Sprintf("Flow rate (%.2f L/min) is back above %.2f L/min", rate, p.Min)
+			if h.Status == PumpFailed {
+				subject := fmt.Sprintf("[Reef-Pi ALERT] pump of '%s' recovered", name)
+				c.c.Telemetry().Alert(subject, msg)
+			}
+			c.record(fc.ID, PumpHealthy, 0, PumpEvent{Time: now, Type: "healthy", Rate: rate, Message: msg})
+		}
+		return
+	}
+	s.lows++
+	if s.lows < p.Checks {
+		c.Unlock()
+		return
+	}
+	cycle := p.PowerCycle && h.Retries < p.Retries
+	if cycle {
+		s.cycling = true
+	}
+	c.Unlock()
+
+	format := "Pump equipment is on but flow rate (%.2f L/min) is below %.2f L/min."
+	msg := fmt.Sprintf(format, rate, p.Min)
+	if h.Status != PumpFailed {
+		log.Println("WARNING: flow sub-system: no flow from pump of sensor:", name, "rate:", rate)
+		c.c.LogError("fc-"+fc.ID, "No flow from pump of sensor "+name)
+		subject := fmt.Sprintf("[Reef-Pi ALERT] pump of '%s' failed", name)
+		c.c.Telemetry().Alert(subject, msg+" Check the pump.")
+		c.record(fc.ID, PumpFailed, h.Retries, PumpEvent{Time: now, Type: "failed", Rate: rate, Message: msg})
+	}
+	if !cycle {
+		if p.PowerCycle && h.Retries == p.Retries {
+			subject := fmt.Sprintf("[Reef-Pi ALERT] pump of '%s' did not recover", name)
+			body := fmt.Sprintf("Flow did not recover after %d power cycles.", h.Retries)
+			c.c.Telemetry().Alert(subject, body)
+			c.record(fc.ID, PumpFailed, h.Retries+1, PumpEvent{Time: now, Type: "gave_up", Rate: rate, Message: body})
+		}
+		return
+	}
+	retries := h.Retries + 1
+	body := fmt.Sprintf("Power cycling pump, attempt %d of %d", retries, p.Retries)
+	c.record(fc.ID, PumpFailed, retries, PumpEvent{Time: now, Type: "power_cycle", Rate: rate, Message: body})
+	// do not delay the next check while the pump is off
+	go c.powerCycle(fc, name, p, retries)
+}
+
+// powerCycle switches the pump equipment off for OffTime seconds and back on,
+// leaving it alone when others switched it meanwhile, e.g. a leak shutoff
+func (c *Controller) powerCycle(fc *FC, name string, p Pump, retries int) {
+	id := fc.ID
+	defer func() {
+		fc.Lock()
+		pulses := fc.PulseCount
+		fc.Unlock()
+		c.Lock()
+		if s, ok := c.pumps[id]; ok {
+			// pulses counted while the pump was off do not belong to the next rate
+			c.lastpulses[id] = pulses
+			s.cycling = false
+			s.skip = true
+			s.lows = 0
+		}
+		c.Unlock()
+	}()
+	sub, err := c.c.Subsystem(storage.EquipmentBucket)
+	if err != nil {
+		log.Println("ERROR: flow sub-system: equipment subsystem is not available. Error:", err)
+		return
+	}
+	eqs, ok := sub.(*equipment.Controller)
+	if !ok {
+		log.Println("ERROR: flow sub-system: Failed to cast equipment subsystem to equipment controller")
+		return
+	}
+	log.Println("flow sub-system: power cycling pump of sensor:", name)
+	if err := eqs.On(p.Equipment, false); err != nil {
+		log.Println("ERROR: flow sub-system: Failed to switch off pump. Error:", err)
+		c.c.LogError("fc-"+id, "Failed to switch off pump of sensor "+name+". Error:"+err.Error())
+		return
+	}
+	rev := eqs.Revision(p.Equipment)
+	time.Sleep(time.Duration(p.OffTime) * time.Second)
+	if eqs.Revision(p.Equipment) != rev {
+		msg := "Pump was switched while power cycling, leaving it as is"
+		log.Println("flow sub-system:", msg, "sensor:", name)
+		c.record(id, PumpFailed, retries, PumpEvent{Time: time.Now(), Type: "power_cycle_aborted", Message: msg})
+		return
+	}
+	if err := eqs.On(p.Equipment, true); err != nil {
+		log.Println("ERROR: flow sub-system: Failed to switch on pump. Error:", err)
+		c.c.LogError("fc-"+id, "Failed to switch on pump of sensor "+name+". Error:"+err.Error())
+		msg := "Failed to switch the pump back on after power cycling. Error: " + err.Error()
+		c.c.Telemetry().Alert(fmt.Sprintf("[Reef-Pi ALERT] pump of '%s' is off", name), msg)
+		c.record(id, PumpFailed, retries, PumpEvent{Time: time.Now(), Type: "switch_on_failed", Message: msg})
+	}
+}
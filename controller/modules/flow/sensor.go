@@ -1,63 +1,82 @@
 package flow
 
 import (
+	"fmt"
 	"log"
+	"math/rand"
+	"time"
 
 	"github.com/kidoman/embd"
 )
 
-func detectFlowSensorDevice() (string, error) {
-	// files, err := filepath.Glob("/sys/bus/w1/devices/28-*")
-	// if err != nil {
-	// 	return "", err
-	// }
-	// if len(files) != 1 {
-	// 	return "", fmt.Errorf("Only one flow device expected, found: %d", len(files))
-	// }
-	// return filepath.Join(files[0], "w1_slave"), nil
-	return "", nil
+const (
+	// SimulatedFlow is the flow rate in litres per minute simulated in dev mode
+	SimulatedFlow = 10.0
+
+	_simulationTick = 100 * time.Millisecond
+)
+
+func (fc *FC) pulse(n uint64) {
+	fc.Lock()
+	fc.PulseCount += n
+	fc.Unlock()
 }
-func (fc *FC) Listen(devMode bool, pin *embd.DigitalPin, pulse chan interface{}, quit chan struct{}) error {
-	log.Println("Listening to flow from sensor:", fc.Name, fc.Pin)
-	if devMode {
-		log.Println("Flow controller is running in dev mode, skipping sensor listening.")
-		return nil
-	}
-	if pulse == nil {
-		log.Fatalln("Flow controller. Listen. Pulse is null")
+
+// watch counts falling edges on the gpio pin of the sensor inlet
+func (c *Controller) watch(f *FC) (embd.DigitalPin, error) {
+	inlet, err := c.inlets.Get(f.Pin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find inlet '%s'. Error: %w", f.Pin, err)
 	}
-	err := (*pin).Watch(embd.EdgeFalling, func(pin embd.DigitalPin) {
-		// log.Println("Flow controller. flowsensor:", fc.ID, " ", fc.Name, " pulse observed")
-		pulse <- 1
-	})
+	pin, err := embd.NewDigitalPin(inlet.Pin)
 	if err != nil {
-		log.Fatalln("Flow controller", err.Error())
-		// log.Println("ERROR: flow sub-system. Failed to read  sensor. Error:", err)
-		// c.c.LogError("fc-"+f.ID, "flow sub-system. Failed to read  sensor "+f.Name+". Error:"+err.Error())
-		// subject := fmt.Sprintf("Flow sensor '%s' failed", f.Name)
-		// c.c.Telemetry().Alert(subject, "Flow sensor failure. Error:"+err.Error())
-		return err
+		return nil, fmt.Errorf("failed to allocate digital pin %d. Error: %w", inlet.Pin, err)
+	}
+	if err := pin.SetDirection(embd.In); err != nil {
+		pin.Close()
+		return nil, err
 	}
+	pin.ActiveLow(false)
+	log.Println("Listening to flow from sensor:", f.Name, f.Pin)
+	if err := pin.Watch(embd.EdgeFalling, func(embd.DigitalPin) { f.pulse(1) }); err != nil {
+		pin.Close()
+		return nil, err
+	}
+	return pin, nil
+}
+
+func release(pin embd.DigitalPin) {
+	if err := pin.StopWatching(); err != nil {
+		log.Println("ERROR: flow sub-system. Failed to stop watching pin. Error:", err)
+	}
+	pin.Close()
+}
+
+// simulate generates pulses of a steady flow, with some noise, until quit is
+// closed
+func (c *Controller) simulate(f *FC, quit chan struct{}) {
+	log.Println("Flow controller is running in dev mode, simulating pulses of sensor:", f.Name)
+	ticker := time.NewTicker(_simulationTick)
+	defer ticker.Stop()
+	var pending float64
 	for {
 		select {
-		case <-pulse:
-			// log.Println("Flow controller. Sensing pulse in sensor.go ",
-			// fc.PulseCount)
-			fc.Lock()
-			fc.PulseCount++
-			fc.Unlock()
+		case <-ticker.C:
+			f.Lock()
+			rate := f.Rate
+			f.Unlock()
+			pending += rate * SimulatedFlow / 60 * _simulationTick.Seconds() * (0.9 + 0.2*rand.Float64())
+			n := uint64(pending)
+			pending -= float64(n)
+			f.pulse(n)
 		case <-quit:
-			log.Println("Flow controller. Quit listening to flow from sensor:", fc.Name, fc.Pin)
-			return nil
+			return
 		}
 	}
 }
 
-func (c *Controller) Read(fc FC) (uint64, error) {
-	log.Println("Reading flow from device:", fc.Name, fc.Pin)
-	if c.devMode {
-		log.Println("Flow controller is running in dev mode, skipping sensor reading.")
-		return 2191, nil
-	}
+func (c *Controller) Read(fc *FC) (uint64, error) {
+	fc.Lock()
+	defer fc.Unlock()
 	return fc.PulseCount, nil
 }
@@ -0,0 +1,97 @@
+package journal
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func (c *Controller) LoadAPI(r *mux.Router) {
+	r.HandleFunc("/api/journal/config", c.getConfig).Methods("GET")
+	r.HandleFunc("/api/journal/config", c.updateConfig).Methods("POST")
+	r.HandleFunc("/api/journal/timeline", c.timeline).Methods("GET")
+	r.HandleFunc("/api/journal", c.list).Methods("GET")
+	r.HandleFunc("/api/journal", c.create).Methods("PUT")
+	r.HandleFunc("/api/journal/{id}", c.get).Methods("GET")
+	r.HandleFunc("/api/journal/{id}", c.update).Methods("POST")
+	r.HandleFunc("/api/journal/{id}", c.delete).Methods("DELETE")
+}
+
+func (c *Controller) getConfig(w http.ResponseWriter, r *http.Request) {
+	fn := func(_ string) (interface{}, error) {
+		return c.GetConfig(), nil
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) updateConfig(w http.ResponseWriter, r *http.Request) {
+	var conf Config
+	fn := func(_ string) error {
+		return c.UpdateConfig(conf)
+	}
+	utils.JSONUpdateResponse(&conf, fn, w, r)
+}
+
+// timeline accepts optional 'from' and 'to' (RFC3339) and 'type' query parameters
+func (c *Controller) timeline(w http.ResponseWriter, r *http.Request) {
+	fn := func(_ string) (interface{}, error) {
+		q := r.URL.Query()
+		var from, to time.Time
+		if v := q.Get("from"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, err
+			}
+			from = t
+		}
+		if v := q.Get("to"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, err
+			}
+			to = t
+		}
+		return c.Timeline(from, to, q.Get("type"))
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) get(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.Get(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) list(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.List()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Controller) create(w http.ResponseWriter, r *http.Request) {
+	var e Entry
+	fn := func() error {
+		return c.Create(e)
+	}
+	utils.JSONCreateResponse(&e, fn, w, r)
+}
+
+func (c *Controller) update(w http.ResponseWriter, r *http.Request) {
+	var e Entry
+	fn := func(id string) error {
+		return c.Update(id, e)
+	}
+	utils.JSONUpdateResponse(&e, fn, w, r)
+}
+
+func (c *Controller) delete(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Delete(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
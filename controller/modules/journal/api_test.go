@@ -0,0 +1,143 @@
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/modules/camera"
+	"github.com/reef-pi/reef-pi/controller/storage"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func TestJournalAPI(t *testing.T) {
+	r, err := controller.TestController()
+	if err != nil {
+		t.Fatal("Failed to create test controller. Error:", err)
+	}
+	defer r.Store().Close()
+	c := New(r)
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+
+	if err := r.Store().CreateBucket(storage.MacroBucket); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Store().Update(storage.MacroBucket, "1", map[string]string{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Store().CreateBucket(storage.CameraItemBucket); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Store().Update(storage.CameraItemBucket, "1", camera.ImageItem{ID: "1", Name: "foo.png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	body := new(bytes.Buffer)
+	enc := json.NewEncoder(body)
+	enc.Encode(Config{WaterChangeMacro: "2"})
+	if err := tr.Do("POST", "/api/journal/config", body, nil); err == nil {
+		t.Error("Config with invalid macro should fail")
+	}
+	body.Reset()
+	enc.Encode(Config{WaterChangeMacro: "1"})
+	if err := tr.Do("POST", "/api/journal/config", body, nil); err != nil {
+		t.Fatal("Failed to update config using api. Error:", err)
+	}
+	if err := tr.Do("GET", "/api/journal/config", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to get config using api. Error:", err)
+	}
+
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	entries := []Entry{
+		{Type: WaterChangeType, Title: "Weekly", Config: []byte(`{"volume":20,"unit":"l"}`), Photos: []string{"1"}},
+		{Type: FeedingType, Title: "Mysis", Config: []byte(`{"food":"mysis"}`), Time: lastWeek},
+		{Type: MaintenanceType, Title: "Filter sock", Config: []byte(`{"task":"swap filter sock"}`)},
+		{Type: LivestockAddType, Title: "Clownfish", Config: []byte(`{"species":"A. ocellaris","count":2}`)},
+		{Type: NoteType, Title: "Note", Notes: "Cyano on sand bed"},
+	}
+	for _, e := range entries {
+		body.Reset()
+		enc.Encode(e)
+		if err := tr.Do("PUT", "/api/journal", body, nil); err != nil {
+			t.Fatal("Failed to create entry using api. Error:", err)
+		}
+	}
+	invalid := []Entry{
+		{Type: "foo"},
+		{Type: WaterChangeType, Config: []byte(`{"volume":0}`)},
+		{Type: LivestockLossType, Config: []byte(`{"species":"foo"}`)},
+		{Type: NoteType},
+		{Type: NoteType, Notes: "bar", Photos: []string{"2"}},
+	}
+	for _, e := range invalid {
+		body.Reset()
+		enc.Encode(e)
+		if err := tr.Do("PUT", "/api/journal", body, nil); err == nil {
+			t.Error("Invalid entry should fail. Type:", e.Type)
+		}
+	}
+	var timeline []Entry
+	if err := tr.Do("GET", "/api/journal/timeline", strings.NewReader("{}"), &timeline); err != nil {
+		t.Fatal("Failed to get timeline using api. Error:", err)
+	}
+	if len(timeline) != 5 {
+		t.Fatal("Expected 5 entries in timeline, found:", len(timeline))
+	}
+	if timeline[4].Type != FeedingType {
+		t.Error("Timeline should be sorted with most recent entries first")
+	}
+	from := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+	if err := tr.Do("GET", "/api/journal/timeline?type=feeding&from="+from, strings.NewReader("{}"), &timeline); err != nil {
+		t.Fatal("Failed to get filtered timeline using api. Error:", err)
+	}
+	if len(timeline) != 0 {
+		t.Error("Expected no recent feeding entries, found:", len(timeline))
+	}
+	if err := tr.Do("GET", "/api/journal/timeline?from=yesterday", strings.NewReader("{}"), nil); err == nil {
+		t.Error("Invalid from date should fail")
+	}
+	deps, err := c.InUse(storage.CameraItemBucket, "1")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(deps) != 1 {
+		t.Error("Expected photo to be in use by one entry, found:", len(deps))
+	}
+	deps, err = c.InUse(storage.MacroBucket, "1")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(deps) != 1 {
+		t.Error("Expected water change macro to be in use")
+	}
+	if _, err := c.InUse("foo", "1"); err == nil {
+		t.Error("Unknown dependency type should fail")
+	}
+	if err := c.On("1", true); err == nil {
+		t.Error("Journal does not support on interface")
+	}
+	if err := tr.Do("GET", "/api/journal/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to get entry using api. Error:", err)
+	}
+	body.Reset()
+	entries[0].Notes = "Replaced with NSW"
+	enc.Encode(entries[0])
+	if err := tr.Do("POST", "/api/journal/1", body, nil); err != nil {
+		t.Error("Failed to update entry using api. Error:", err)
+	}
+	if err := tr.Do("GET", "/api/journal", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to list entries using api. Error:", err)
+	}
+	if err := tr.Do("DELETE", "/api/journal/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to delete entry using api. Error:", err)
+	}
+	c.Stop()
+}
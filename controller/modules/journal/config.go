@@ -0,0 +1,44 @@
+package journal
+
+import (
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+// Config holds journal wide settings. WaterChangeMacro, when set, is triggered
+// every time a water change entry is logged.
+type Config struct {
+	WaterChangeMacro string `json:"water_change_macro"`
+}
+
+var Default = Config{}
+
+func loadConfig(store storage.Store) (Config, error) {
+	var conf Config
+	return conf, store.Get(Bucket, "config", &conf)
+}
+
+func saveConfig(store storage.Store, conf Config) error {
+	return store.Update(Bucket, "config", conf)
+}
+
+func (c *Controller) GetConfig() Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+func (c *Controller) UpdateConfig(conf Config) error {
+	if conf.WaterChangeMacro != "" {
+		var m map[string]interface{}
+		if err := c.c.Store().Get(storage.MacroBucket, conf.WaterChangeMacro, &m); err != nil {
+			return err
+		}
+	}
+	if err := saveConfig(c.c.Store(), conf); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.config = conf
+	c.mu.Unlock()
+	return nil
+}
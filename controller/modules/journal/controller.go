@@ -0,0 +1,83 @@
+package journal
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const Bucket = storage.JournalBucket
+const EntryBucket = storage.JournalEntryBucket
+
+type Controller struct {
+	c      controller.Controller
+	mu     sync.Mutex
+	config Config
+}
+
+func New(c controller.Controller) *Controller {
+	return &Controller{
+		c:      c,
+		mu:     sync.Mutex{},
+		config: Default,
+	}
+}
+
+func (c *Controller) Setup() error {
+	if err := c.c.Store().CreateBucket(Bucket); err != nil {
+		return err
+	}
+	conf, err := loadConfig(c.c.Store())
+	if err != nil {
+		log.Println("WARNING: journal config not found. Initializing default config")
+		conf = Default
+		if err := saveConfig(c.c.Store(), conf); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.config = conf
+	c.mu.Unlock()
+	return c.c.Store().CreateBucket(EntryBucket)
+}
+
+func (c *Controller) Start() {
+}
+
+func (c *Controller) Stop() {
+}
+
+func (c *Controller) On(_ string, _ bool) error {
+	return fmt.Errorf("Journal subsystem does not support 'on' interface")
+}
+
+func (c *Controller) InUse(depType, id string) ([]string, error) {
+	var deps []string
+	switch depType {
+	case storage.MacroBucket:
+		c.mu.Lock()
+		if c.config.WaterChangeMacro == id {
+			deps = append(deps, "journal(water change)")
+		}
+		c.mu.Unlock()
+		return deps, nil
+	case storage.CameraItemBucket:
+		es, err := c.List()
+		if err != nil {
+			return deps, err
+		}
+		for _, e := range es {
+			for _, p := range e.Photos {
+				if p == id {
+					deps = append(deps, e.Title)
+				}
+			}
+		}
+		return deps, nil
+	default:
+		return deps, fmt.Errorf("unknown dependency type:%s", depType)
+	}
+}
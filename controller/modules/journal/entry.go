@@ -0,0 +1,210 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/modules/camera"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const (
+	WaterChangeType   = "water_change"
+	FeedingType       = "feeding"
+	MaintenanceType   = "maintenance"
+	LivestockAddType  = "livestock_add"
+	LivestockLossType = "livestock_loss"
+	NoteType          = "note"
+)
+
+type WaterChange struct {
+	Volume float64 `json:"volume"`
+	Unit   string  `json:"unit"`
+}
+
+type Feeding struct {
+	Food   string `json:"food"`
+	Amount string `json:"amount"`
+}
+
+type Maintenance struct {
+	Task string `json:"task"`
+}
+
+type Livestock struct {
+	Species string `json:"species"`
+	Count   int    `json:"count"`
+}
+
+// Entry is a single journal record. Config carries the type specific details
+// (WaterChange, Feeding, Maintenance or Livestock) and Photos references images
+// from the camera subsystem.
+type Entry struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Title  string          `json:"title"`
+	Notes  string          `json:"notes"`
+	Time   time.Time       `json:"time"`
+	Photos []string        `json:"photos"`
+	Config json.RawMessage `json:"config"`
+}
+
+func (e Entry) Validate() error {
+	switch e.Type {
+	case WaterChangeType:
+		var wc WaterChange
+		if err := json.Unmarshal(e.Config, &wc); err != nil {
+			return err
+		}
+		if wc.Volume <= 0 {
+			return fmt.Errorf("Water change volume should be positive. Supplied: %f", wc.Volume)
+		}
+	case FeedingType:
+		var f Feeding
+		if err := json.Unmarshal(e.Config, &f); err != nil {
+			return err
+		}
+		if f.Food == "" {
+			return fmt.Errorf("Missing food")
+		}
+	case MaintenanceType:
+		var m Maintenance
+		if err := json.Unmarshal(e.Config, &m); err != nil {
+			return err
+		}
+		if m.Task == "" {
+			return fmt.Errorf("Missing maintenance task")
+		}
+	case LivestockAddType, LivestockLossType:
+		var l Livestock
+		if err := json.Unmarshal(e.Config, &l); err != nil {
+			return err
+		}
+		if l.Species == "" {
+			return fmt.Errorf("Missing livestock species")
+		}
+		if l.Count <= 0 {
+			return fmt.Errorf("Livestock count should be positive. Supplied: %d", l.Count)
+		}
+	case NoteType:
+		if e.Notes == "" {
+			return fmt.Errorf("Missing note")
+		}
+	default:
+		return fmt.Errorf("Invalid journal entry type: %s", e.Type)
+	}
+	return nil
+}
+
+func (c *Controller) validatePhotos(e Entry) error {
+	for _, p := range e.Photos {
+		var i camera.ImageItem
+		if err := c.c.Store().Get(storage.CameraItemBucket, p, &i); err != nil {
+			return fmt.Errorf("Invalid photo '%s'. Error: %s", p, err)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) Get(id string) (Entry, error) {
+	var e Entry
+	return e, c.c.Store().Get(EntryBucket, id, &e)
+}
+
+func (c *Controller) List() ([]Entry, error) {
+	es := []Entry{}
+	fn := func(_ string, v []byte) error {
+		var e Entry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		es = append(es, e)
+		return nil
+	}
+	return es, c.c.Store().List(EntryBucket, fn)
+}
+
+// Timeline returns entries logged between from and to (zero values are open
+// ended), optionally restricted to a single type, most recent first.
+func (c *Controller) Timeline(from, to time.Time, t string) ([]Entry, error) {
+	es, err := c.List()
+	if err != nil {
+		return es, err
+	}
+	timeline := []Entry{}
+	for _, e := range es {
+		if t != "" && e.Type != t {
+			continue
+		}
+		if !from.IsZero() && e.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && e.Time.After(to) {
+			continue
+		}
+		timeline = append(timeline, e)
+	}
+	sort.Slice(timeline, func(i, j int) bool {
+		return timeline[i].Time.After(timeline[j].Time)
+	})
+	return timeline, nil
+}
+
+func (c *Controller) Create(e Entry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if err := c.validatePhotos(e); err != nil {
+		return err
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	fn := func(id string) interface{} {
+		e.ID = id
+		return &e
+	}
+	if err := c.c.Store().Create(EntryBucket, fn); err != nil {
+		return err
+	}
+	if e.Type == WaterChangeType {
+		c.triggerWaterChangeMacro()
+	}
+	return nil
+}
+
+func (c *Controller) Update(id string, e Entry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if err := c.validatePhotos(e); err != nil {
+		return err
+	}
+	e.ID = id
+	return c.c.Store().Update(EntryBucket, id, e)
+}
+
+func (c *Controller) Delete(id string) error {
+	return c.c.Store().Delete(EntryBucket, id)
+}
+
+func (c *Controller) triggerWaterChangeMacro() {
+	id := c.GetConfig().WaterChangeMacro
+	if id == "" {
+		return
+	}
+	m, err := c.c.Subsystem(storage.MacroBucket)
+	if err != nil {
+		log.Println("ERROR: journal sub-system: macro sub-system is not available. Error:", err)
+		return
+	}
+	go func() {
+		if err := m.On(id, false); err != nil {
+			log.Println("ERROR: journal sub-system: Failed to trigger water change macro. Error:", err)
+			c.c.LogError("journal-macro-"+id, "Failed to trigger water change macro. Error:"+err.Error())
+		}
+	}()
+}
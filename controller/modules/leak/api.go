@@ -14,6 +14,7 @@ import (
 //API
 func (e *Controller) LoadAPI(r *mux.Router) {
 	r.HandleFunc("/api/leaks/status/{id}", e.Status).Methods("POST")
+	r.HandleFunc("/api/leaks/last_seen", e.GetLastSeen).Methods("GET")
 	r.HandleFunc("/api/leaks/{id}", e.GetLeak).Methods("GET")
 	r.HandleFunc("/api/leaks", e.ListLeak).Methods("GET")
 	r.HandleFunc("/api/leaks", e.CreateLeak).Methods("PUT")
@@ -28,6 +29,7 @@ func (c *Controller) Status(w http.ResponseWriter, r *http.Request) {
 		leaks, _ := c.List()
 		for _, lk := range leaks {
 			if lk.EndpointID == id {
+				c.remote.seen(id, remoteAddr(r), status.Status, false)
 				status.Date = time.Now()
 				//if the macro takes long the post would throw timeout on the post request
 				//therefore, we need to handle the status asynchronously
@@ -42,14 +44,19 @@ func (c *Controller) Status(w http.ResponseWriter, r *http.Request) {
 
 func (c *Controller) GetLeak(w http.ResponseWriter, r *http.Request) {
 	fn := func(id string) (interface{}, error) {
-		return c.Get(id)
+		lk, err := c.Get(id)
+		return lk.redacted(), err
 	}
 	utils.JSONGetResponse(fn, w, r)
 }
 
 func (c Controller) ListLeak(w http.ResponseWriter, r *http.Request) {
 	fn := func() (interface{}, error) {
-		return c.List()
+		lks, err := c.List()
+		for i := range lks {
+			lks[i] = lks[i].redacted()
+		}
+		return lks, err
 	}
 	utils.JSONListResponse(fn, w, r)
 }
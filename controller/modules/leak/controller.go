@@ -21,6 +21,9 @@ type Controller struct {
 	c         controller.Controller
 	quitters  map[string]chan struct{}
 	lks       map[string]*Leak
+	inlets    InletReader
+	readings  map[string]*reading
+	remote    *remoteSensors
 }
 
 func New(c controller.Controller) *Controller {
@@ -29,6 +32,9 @@ func New(c controller.Controller) *Controller {
 		store:     c.Store(),
 		lks:       make(map[string]*Leak),
 		quitters:  make(map[string]chan struct{}),
+		inlets:    c.DM().Inlets(),
+		readings:  make(map[string]*reading),
+		remote:    newRemoteSensors(),
 		c:         c,
 	}
 }
@@ -58,44 +64,109 @@ func (c *Controller) Setup() error {
 	return nil
 }
 
+// HandleStatusReport records a status report of a remote sensor
 func (c *Controller) HandleStatusReport(lk Leak, status SensorStatus) {
+	if err := c.report(lk.ID, status); err != nil {
+		log.Println("ERROR: leak-subsystem: Failed to handle status report. Error:", err)
+	}
+}
 
+// report records the status of a remote or local sensor and reacts when it
+// changes. A first report only counts as a change when it indicates a leak.
+func (c *Controller) report(id string, status SensorStatus) error {
 	//add the last state report to the leak sensor
 	//and drop old reads when the cap is reached
 	c.Lock()
-	defer c.Unlock()
+	lk, ok := c.lks[id]
+	if !ok {
+		c.Unlock()
+		return fmt.Errorf("leak sensor '%s' does not exist", id)
+	}
+	prev := -1
 	all := len(lk.States)
-	lk.States = append(lk.States, status)
+	if all > 0 {
+		prev = lk.States[all-1].Status
+	}
+	states := append(lk.States, status)
 	if all+1 > CapLeakStates {
-		lk.States = lk.States[all+1-CapLeakStates:]
+		states = states[all+1-CapLeakStates:]
 	}
+	lk.States = states
 	lk.LastHeartbeat = status.Date
-	c.Update(lk.ID, lk)
-
-	if c.macro == nil {
-		log.Println("ERROR: leak-subsystem: macro subsystem is nil; cannot handle status reports with no macro subsystem")
-		return
+	l := *lk
+	c.Unlock()
+	if err := c.store.Update(Bucket, id, l); err != nil {
+		return err
 	}
+	if status.Status == prev || (prev == -1 && status.Status == 0) {
+		return nil
+	}
+	c.trigger(l, status.Status)
+	return nil
+}
+
+// trigger runs the hooks of a sensor on a status change. A leak (status 1)
+// turns off the shutoff equipment and sends an alert, the equipment stays off
+// when the leak clears.
+func (c *Controller) trigger(lk Leak, status int) {
 	triggerMacro := ""
-	if status.Status == 0 {
-		//run on status zero macro
-		if lk.OnStatusZeroMacro != "" {
-			triggerMacro = lk.OnStatusZeroMacro
-			log.Println("INFO: leak-subsystem: status report 0 received; OnStatusZeroMacro will be triggered")
+	switch status {
+	case 1:
+		log.Println("WARNING: leak-subsystem: leak detected by sensor:", lk.Name)
+		c.shutoff(lk)
+		if lk.Notify.Enable {
+			subject := fmt.Sprintf("[Reef-Pi ALERT] leak detected by '%s'", lk.Name)
+			body := fmt.Sprintf("Leak sensor '%s' reported a leak at %s.", lk.Name, time.Now().Format(time.RFC1123))
+			if len(lk.Shutoff) > 0 {
+				body += fmt.Sprintf(" %d equipment turned off.", len(lk.Shutoff))
+			}
+			c.c.Telemetry().Alert(subject, body)
 		}
-	} else if status.Status == 1 {
 		//run on status one macro
 		if lk.OnStatusOneMacro != "" {
 			triggerMacro = lk.OnStatusOneMacro
 			log.Println("INFO: leak-subsystem: status report 1 received; OnStatusOneMacro will be triggered")
 		}
-	} else {
+	case 0:
+		log.Println("INFO: leak-subsystem: leak cleared for sensor:", lk.Name)
+		if lk.Notify.Enable {
+			subject := fmt.Sprintf("[Reef-Pi ALERT] leak cleared for '%s'", lk.Name)
+			c.c.Telemetry().Alert(subject, fmt.Sprintf("Leak sensor '%s' no longer reports a leak.", lk.Name))
+		}
+		//run on status zero macro
+		if lk.OnStatusZeroMacro != "" {
+			triggerMacro = lk.OnStatusZeroMacro
+			log.Println("INFO: leak-subsystem: status report 0 received; OnStatusZeroMacro will be triggered")
+		}
+	default:
 		//log the status error
-		log.Println("ERROR. leak-subsystem: status report indicates an status value other than 0 or 1; value is:", status.Status)
+		log.Println("ERROR. leak-subsystem: status report indicates an status value other than 0 or 1; value is:", status)
 	}
-	if triggerMacro != "" {
-		if err := c.macro.On(triggerMacro, false); err != nil {
-			log.Println("ERROR: leak sub-system, Failed to trigger macro. Error:", err)
+	if triggerMacro == "" {
+		return
+	}
+	if c.macro == nil {
+		log.Println("ERROR: leak-subsystem: macro subsystem is nil; cannot handle status reports with no macro subsystem")
+		return
+	}
+	if err := c.macro.On(triggerMacro, false); err != nil {
+		log.Println("ERROR: leak sub-system, Failed to trigger macro. Error:", err)
+	}
+}
+
+func (c *Controller) shutoff(lk Leak) {
+	if len(lk.Shutoff) == 0 {
+		return
+	}
+	sub, err := c.c.Subsystem(storage.EquipmentBucket)
+	if err != nil {
+		log.Println("ERROR: leak-subsystem: equipment subsystem is not available. Error:", err)
+		return
+	}
+	for _, eq := range lk.Shutoff {
+		if err := sub.On(eq, false); err != nil {
+			log.Println("ERROR: leak-subsystem: Failed to turn off equipment:", eq, "Error:", err)
+			c.c.LogError("leak-"+lk.ID, "Failed to turn off equipment "+eq+" on leak. Error:"+err.Error())
 		}
 	}
 }
@@ -123,6 +194,29 @@ func (c *Controller) Stop() {
 }
 func (c *Controller) InUse(depType, id string) ([]string, error) {
 	var deps []string
+	lks, err := c.List()
+	if err != nil {
+		return deps, err
+	}
+	for _, lk := range lks {
+		switch depType {
+		case storage.InletBucket:
+			if lk.Inlet == id {
+				deps = append(deps, lk.Name)
+			}
+		case storage.MacroBucket:
+			if lk.OnStatusZeroMacro == id || lk.OnStatusOneMacro == id {
+				deps = append(deps, lk.Name)
+			}
+		case storage.EquipmentBucket:
+			for _, eq := range lk.Shutoff {
+				if eq == id {
+					deps = append(deps, lk.Name)
+					break
+				}
+			}
+		}
+	}
 	return deps, nil
 }
 
@@ -130,24 +224,28 @@ func (c *Controller) Check(lk *Leak) {
 	if !lk.Enable {
 		return
 	}
+	if lk.Inlet != "" {
+		c.poll(lk)
+		return
+	}
 	if lk.ExpectedHeartbeatFrequency <= 0 {
 		//we do not need to check for heartbeat
 		return
 	}
-
-	if lk.LastHeartbeat.IsZero() {
-		//so far no hearbeat
-	}
-
-	diff := time.Since(lk.LastHeartbeat)
+	c.Lock()
+	last := lk.LastHeartbeat
+	c.Unlock()
+	diff := time.Since(last)
 	inf := fmt.Sprintf("checking heartbeat %s, expected heartbeat frequency:%d, seconds since last heartbeat: %f",
-		lk.LastHeartbeat.String(), lk.ExpectedHeartbeatFrequency,
+		last.String(), lk.ExpectedHeartbeatFrequency,
 		diff.Seconds())
 	log.Println("INFO. Leak sub-system:" + inf)
 	c.c.Telemetry().EmitMetric(lk.Name,
 		inf, diff.Seconds())
 	if diff.Seconds() > float64(lk.ExpectedHeartbeatFrequency) {
-		c.NotifyIfNeeded(*lk, diff.Seconds())
+		l := *lk
+		l.LastHeartbeat = last
+		c.NotifyIfNeeded(l, diff.Seconds())
 	}
 }
 func (c *Controller) NotifyIfNeeded(lk Leak, diff float64) {
@@ -1 +1,218 @@
 package leak
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/storage"
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+type mockInlets map[string]int
+
+func (m mockInlets) Read(id string) (int, error) {
+	v, ok := m[id]
+	if !ok {
+		return 0, fmt.Errorf("inlet '%s' does not exist", id)
+	}
+	return v, nil
+}
+
+// subsystemStub records On calls of the equipment and macro subsystems
+type subsystemStub struct {
+	controller.Subsystem
+	calls []string
+}
+
+func (s *subsystemStub) On(id string, on bool) error {
+	s.calls = append(s.calls, fmt.Sprintf("%s:%t", id, on))
+	return nil
+}
+
+type telemetryStub struct {
+	telemetry.Telemetry
+	alerts []string
+}
+
+func (t *telemetryStub) Alert(subject, _ string) (bool, error) {
+	t.alerts = append(t.alerts, subject)
+	return true, nil
+}
+
+type testController struct {
+	controller.Controller
+	t      *telemetryStub
+	eqs    *subsystemStub
+	macros *subsystemStub
+}
+
+func (c *testController) Telemetry() telemetry.Telemetry {
+	return c.t
+}
+
+func (c *testController) Subsystem(name string) (controller.Subsystem, error) {
+	switch name {
+	case storage.EquipmentBucket:
+		return c.eqs, nil
+	case storage.MacroBucket:
+		return c.macros, nil
+	}
+	return c.Controller.Subsystem(name)
+}
+
+func newTestLeak(t *testing.T) (*Controller, *testController, *utils.TestRouter) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { con.Store().Close() })
+	tc := &testController{
+		Controller: con,
+		t:          &telemetryStub{Telemetry: con.Telemetry()},
+		eqs:        new(subsystemStub),
+		macros:     new(subsystemStub),
+	}
+	c := New(tc)
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	return c, tc, tr
+}
+
+func TestLocalSensor(t *testing.T) {
+	c, tc, tr := newTestLeak(t)
+	inlets := mockInlets{"1": 0}
+	c.inlets = inlets
+	lk := Leak{
+		Name:              "sump",
+		Inlet:             "1",
+		Period:            60,
+		Debounce:          2,
+		Shutoff:           []string{"return", "heater"},
+		OnStatusOneMacro:  "leak",
+		OnStatusZeroMacro: "dry",
+		Notify:            Notify{Enable: true},
+	}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(lk)
+	if err := tr.Do("PUT", "/api/leaks", body, nil); err != nil {
+		t.Fatal("Failed to create leak sensor using api. Error:", err)
+	}
+	l := c.lks["1"]
+	l.Enable = true
+
+	c.Check(l)
+	c.Check(l)
+	if len(tc.t.alerts) != 0 || len(tc.macros.calls) != 0 {
+		t.Error("Dry sensor should not trigger hooks")
+	}
+	// a single wet reading is a splash
+	inlets["1"] = 1
+	c.Check(l)
+	inlets["1"] = 0
+	c.Check(l)
+	if len(tc.eqs.calls) != 0 {
+		t.Error("Readings shorter than debounce should be ignored, found:", tc.eqs.calls)
+	}
+	inlets["1"] = 1
+	for i := 0; i < 4; i++ {
+		c.Check(l)
+	}
+	if strings.Join(tc.eqs.calls, ",") != "return:false,heater:false" {
+		t.Error("Shutoff equipment should be turned off once, found:", tc.eqs.calls)
+	}
+	if strings.Join(tc.macros.calls, ",") != "leak:false" {
+		t.Error("OnStatusOneMacro should be triggered once, found:", tc.macros.calls)
+	}
+	if len(tc.t.alerts) != 1 || !strings.Contains(tc.t.alerts[0], "leak detected") {
+		t.Error("Expected a single leak alert, found:", tc.t.alerts)
+	}
+	inlets["1"] = 0
+	c.Check(l)
+	c.Check(l)
+	if len(tc.macros.calls) != 2 || tc.macros.calls[1] != "dry:false" || len(tc.eqs.calls) != 2 {
+		t.Error("OnStatusZeroMacro should be triggered and equipment left off, found:", tc.macros.calls, tc.eqs.calls)
+	}
+	if len(tc.t.alerts) != 2 || !strings.Contains(tc.t.alerts[1], "cleared") {
+		t.Error("Expected a leak cleared alert, found:", tc.t.alerts)
+	}
+	stored, err := c.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.States) != 3 {
+		t.Error("Expected status changes to be recorded, found:", stored.States)
+	}
+
+	for dep, id := range map[string]string{storage.InletBucket: "1", storage.EquipmentBucket: "heater", storage.MacroBucket: "dry"} {
+		if deps, _ := c.InUse(dep, id); len(deps) != 1 {
+			t.Error("Expected", dep, id, "to be in use, found:", deps)
+		}
+	}
+	lk.Period = 0
+	if err := c.Create(lk); err == nil {
+		t.Error("Local sensor without period should fail validation")
+	}
+	delete(inlets, "1")
+	c.Check(l)
+	c.Stop()
+}
+
+func TestRemoteSensor(t *testing.T) {
+	c, tc, tr := newTestLeak(t)
+	lk := Leak{
+		Name:                       "remote",
+		EndpointID:                 "tank",
+		Period:                     60,
+		ExpectedHeartbeatFrequency: 10,
+		OnStatusOneMacro:           "leak",
+		Shutoff:                    []string{"return"},
+		Notify:                     Notify{Enable: true, Max: 5},
+	}
+	if err := c.Create(lk); err != nil {
+		t.Fatal(err)
+	}
+	l := c.lks["1"]
+	l.Enable = true
+	c.Check(l)
+	if len(tc.t.alerts) != 1 || !strings.Contains(tc.t.alerts[0], "heartbeat") {
+		t.Error("Missing heartbeat should raise an alert, found:", tc.t.alerts)
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(SensorStatus{Status: 0})
+	if err := tr.Do("POST", "/api/leaks/status/tank", body, nil); err != nil {
+		t.Fatal("Failed to report status using api. Error:", err)
+	}
+	// status reports are handled asynchronously
+	for i := 0; i < 100; i++ {
+		if s, _ := c.Get("1"); len(s.States) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.HandleStatusReport(*l, SensorStatus{Status: 1, Date: time.Now()})
+	c.HandleStatusReport(*l, SensorStatus{Status: 1, Date: time.Now()})
+	if len(tc.eqs.calls) != 1 || len(tc.macros.calls) != 1 {
+		t.Error("Remote leak should trigger shutoff and macro once, found:", tc.eqs.calls, tc.macros.calls)
+	}
+	found := false
+	for _, a := range tc.t.alerts {
+		found = found || strings.Contains(a, "leak detected")
+	}
+	if !found {
+		t.Error("Remote leak should raise the same alert as local sensors, found:", tc.t.alerts)
+	}
+	c.Check(l)
+	if n := len(tc.t.alerts); strings.Contains(tc.t.alerts[n-1], "heartbeat") {
+		t.Error("Recent report should count as heartbeat, found:", tc.t.alerts)
+	}
+}
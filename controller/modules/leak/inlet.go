@@ -0,0 +1,54 @@
+package leak
+
+import (
+	"log"
+	"time"
+)
+
+// InletReader reads digital inputs, satisfied by connectors.Inlets
+type InletReader interface {
+	Read(string) (int, error)
+}
+
+// reading tracks how many consecutive polls of a local sensor returned the
+// same value
+type reading struct {
+	value int
+	count int
+}
+
+// poll reads the inlet of a local sensor. A new value is reported once it
+// was read Debounce times in a row, so that splashes or contact bounce do not
+// trigger hooks.
+func (c *Controller) poll(lk *Leak) {
+	v, err := c.inlets.Read(lk.Inlet)
+	if err != nil {
+		log.Println("ERROR: leak sub-system. Failed to read sensor:", lk.Name, "Error:", err)
+		c.c.LogError("leak-"+lk.ID, "Failed to read leak sensor. Name:"+lk.Name+". Error:"+err.Error())
+		return
+	}
+	c.c.Telemetry().EmitMetric("leak", lk.Name+"-state", float64(v))
+	debounce := lk.Debounce
+	if debounce < 1 {
+		debounce = 1
+	}
+	c.Lock()
+	r, ok := c.readings[lk.ID]
+	if !ok || r.value != v {
+		r = &reading{value: v}
+		c.readings[lk.ID] = r
+	}
+	r.count++
+	stable := r.count == debounce
+	current := -1
+	if n := len(lk.States); n > 0 {
+		current = lk.States[n-1].Status
+	}
+	c.Unlock()
+	if !stable || v == current {
+		return
+	}
+	if err := c.report(lk.ID, SensorStatus{Status: v, Date: time.Now()}); err != nil {
+		log.Println("ERROR: leak sub-system. Failed to record status of sensor:", lk.Name, "Error:", err)
+	}
+}
@@ -2,6 +2,7 @@ package leak
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"time"
 
@@ -31,6 +32,35 @@ type Leak struct {
 	States                     []SensorStatus `json:"states"`
 	Notify                     Notify         `json:"notify"`
 	DisableOnAlert             bool           `json:"disable_on_alert"`
+	Inlet                      string         `json:"inlet"`
+	Debounce                   int            `json:"debounce"`
+	Shutoff                    []string       `json:"shutoff"`
+	Secret                     string         `json:"secret,omitempty"`
+	HasSecret                  bool           `json:"has_secret"`
+	ClearSecret                bool           `json:"clear_secret,omitempty"`
+}
+
+// redacted hides the secret of a sensor from api responses, reporting only
+// whether one is set
+func (lk Leak) redacted() Leak {
+	lk.HasSecret = lk.Secret != ""
+	lk.Secret = ""
+	return lk
+}
+
+// Validate checks local sensors, which poll Inlet every Period seconds and
+// report status 1 (leak) or 0. Remote sensors report via the status api.
+func (lk Leak) Validate() error {
+	if lk.Inlet == "" {
+		return nil
+	}
+	if lk.Period <= 0 {
+		return fmt.Errorf("Period of local leak sensor should be positive. Supplied:%d", lk.Period)
+	}
+	if lk.Debounce < 0 {
+		return fmt.Errorf("Debounce can not be negative. Supplied:%d", lk.Debounce)
+	}
+	return nil
 }
 
 func (c *Controller) Get(id string) (Leak, error) {
@@ -52,6 +82,13 @@ func (c Controller) List() ([]Leak, error) {
 }
 
 func (c *Controller) Create(lk Leak) error {
+	if err := lk.Validate(); err != nil {
+		return err
+	}
+	lk.HasSecret = false
+	lk.ClearSecret = false
+	c.Lock()
+	defer c.Unlock()
 	fn := func(id string) interface{} {
 		lk.ID = id
 		return &lk
@@ -70,9 +107,26 @@ func (c *Controller) Create(lk Leak) error {
 
 func (c *Controller) Update(id string, lk Leak) error {
 	lk.ID = id
+	if err := lk.Validate(); err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	// api responses do not carry the secret, keep the stored one unless it
+	// is cleared explicitly
+	if lk.ClearSecret {
+		lk.Secret = ""
+	} else if lk.Secret == "" {
+		if old, err := c.Get(id); err == nil {
+			lk.Secret = old.Secret
+		}
+	}
+	lk.HasSecret = false
+	lk.ClearSecret = false
 	if err := c.store.Update(Bucket, id, lk); err != nil {
 		return err
 	}
+	delete(c.readings, id)
 	quit, ok := c.quitters[lk.ID]
 	if ok {
 		close(quit)
@@ -104,6 +158,7 @@ func (c *Controller) Delete(id string) error {
 			delete(c.quitters, id)
 		}
 		delete(c.lks, id)
+		delete(c.readings, id)
 	}
 	return err
 
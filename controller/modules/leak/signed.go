@@ -0,0 +1,248 @@
+package leak
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+const (
+	SignatureHeader = "X-Signature"
+
+	_maxClockSkew    = 5 * time.Minute
+	_rateLimit       = 30 // requests per address and minute
+	_rateWindow      = time.Minute
+	_maxReportLength = 1024
+)
+
+// SignedReport is the body of a status report from a remote sensor. The
+// X-Signature header carries the hex encoded HMAC-SHA256 of the body, keyed
+// with the secret of the sensor. Reports are accepted within five minutes of
+// Timestamp (unix seconds) and each Nonce only once.
+type SignedReport struct {
+	Status    int    `json:"status"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+}
+
+// LastSeen is the latest accepted report of an endpoint, signed or not.
+// Rejected signed reports are recorded apart, so unauthenticated requests can
+// not hide the latest report of the sensor.
+type LastSeen struct {
+	Time         time.Time `json:"time"`
+	Address      string    `json:"address"`
+	Status       int       `json:"status"`
+	Verified     bool      `json:"verified"`
+	Error        string    `json:"error,omitempty"`
+	ErrorTime    time.Time `json:"error_time,omitempty"`
+	ErrorAddress string    `json:"error_address,omitempty"`
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// remoteSensors keeps the replay protection, rate limiting and last seen state
+// of remote sensor endpoints
+type remoteSensors struct {
+	sync.Mutex
+	nonces   map[string]time.Time
+	limits   map[string]*window
+	lastSeen map[string]LastSeen
+	now      func() time.Time
+}
+
+func newRemoteSensors() *remoteSensors {
+	return &remoteSensors{
+		nonces:   make(map[string]time.Time),
+		limits:   make(map[string]*window),
+		lastSeen: make(map[string]LastSeen),
+		now:      time.Now,
+	}
+}
+
+// allow counts a request from an address, returning false once it exceeds the
+// rate limit of the current window
+func (s *remoteSensors) allow(addr string) bool {
+	s.Lock()
+	defer s.Unlock()
+	now := s.now()
+	w, ok := s.limits[addr]
+	if !ok || now.Sub(w.start) >= _rateWindow {
+		for a, w := range s.limits {
+			if now.Sub(w.start) >= _rateWindow {
+				delete(s.limits, a)
+			}
+		}
+		w = &window{start: now}
+		s.limits[addr] = w
+	}
+	w.count++
+	return w.count <= _rateLimit
+}
+
+// fresh checks the timestamp of a report and records its nonce, returning an
+// error for stale or replayed reports
+func (s *remoteSensors) fresh(endpoint string, r SignedReport) error {
+	s.Lock()
+	defer s.Unlock()
+	now := s.now()
+	t := time.Unix(r.Timestamp, 0)
+	if t.Before(now.Add(-_maxClockSkew)) || t.After(now.Add(_maxClockSkew)) {
+		return fmt.Errorf("report timestamp is outside the accepted window")
+	}
+	if r.Nonce == "" {
+		return fmt.Errorf("report nonce is missing")
+	}
+	for k, seen := range s.nonces {
+		if now.Sub(seen) > 2*_maxClockSkew {
+			delete(s.nonces, k)
+		}
+	}
+	key := endpoint + "/" + r.Nonce
+	if _, ok := s.nonces[key]; ok {
+		return fmt.Errorf("report nonce was already used")
+	}
+	s.nonces[key] = now
+	return nil
+}
+
+func (s *remoteSensors) seen(endpoint string, addr string, status int, verified bool) {
+	s.Lock()
+	defer s.Unlock()
+	l := s.lastSeen[endpoint]
+	l.Time = s.now()
+	l.Address = addr
+	l.Status = status
+	l.Verified = verified
+	s.lastSeen[endpoint] = l
+}
+
+// rejected records a failed report, keeping the latest accepted one
+func (s *remoteSensors) rejected(endpoint string, addr string, msg string) {
+	s.Lock()
+	defer s.Unlock()
+	l := s.lastSeen[endpoint]
+	l.Error = msg
+	l.ErrorTime = s.now()
+	l.ErrorAddress = addr
+	s.lastSeen[endpoint] = l
+}
+
+func (s *remoteSensors) LastSeen() map[string]LastSeen {
+	s.Lock()
+	defer s.Unlock()
+	m := make(map[string]LastSeen, len(s.lastSeen))
+	for k, v := range s.lastSeen {
+		m[k] = v
+	}
+	return m
+}
+
+// Sign returns the signature of a report body
+func Sign(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func verify(secret string, body []byte, signature string) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hmac.Equal(sig, h.Sum(nil))
+}
+
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (c *Controller) endpoint(id string) (Leak, bool) {
+	leaks, _ := c.List()
+	for _, lk := range leaks {
+		if lk.EndpointID == id {
+			return lk, true
+		}
+	}
+	return Leak{}, false
+}
+
+// LoadSensorAPI registers the route for signed status reports. It is served
+// without session authentication, reports are verified with the secret of the
+// sensor instead.
+func (c *Controller) LoadSensorAPI(r *mux.Router) {
+	r.HandleFunc("/sensors/leaks/{id}", c.SignedStatus).Methods("POST")
+}
+
+func (c *Controller) SignedStatus(w http.ResponseWriter, r *http.Request) {
+	addr := remoteAddr(r)
+	if !c.remote.allow(addr) {
+		utils.ErrorResponse(http.StatusTooManyRequests, "Too many leak sensor reports from: "+addr, w)
+		return
+	}
+	id := mux.Vars(r)["id"]
+	lk, ok := c.endpoint(id)
+	if !ok || lk.Secret == "" {
+		utils.ErrorResponse(http.StatusUnauthorized, "Unknown leak sensor endpoint: "+id, w)
+		return
+	}
+	fail := func(code int, msg string) {
+		c.remote.rejected(id, addr, msg)
+		utils.ErrorResponse(code, "Leak sensor '"+lk.Name+"': "+msg, w)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, _maxReportLength))
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !verify(lk.Secret, body, r.Header.Get(SignatureHeader)) {
+		fail(http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	var report SignedReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		fail(http.StatusBadRequest, "invalid report. Error: "+err.Error())
+		return
+	}
+	if err := c.remote.fresh(id, report); err != nil {
+		fail(http.StatusUnauthorized, err.Error())
+		return
+	}
+	if report.Status != 0 && report.Status != 1 {
+		fail(http.StatusBadRequest, fmt.Sprintf("invalid status: %d", report.Status))
+		return
+	}
+	c.remote.seen(id, addr, report.Status, true)
+	log.Println("INFO. Leak sub-system: signed sensor report received from:", lk.Name)
+	//if the macro takes long the post would throw timeout on the post request
+	//therefore, we need to handle the status asynchronously
+	go c.HandleStatusReport(lk, SensorStatus{Status: report.Status, Date: time.Now()})
+	utils.JSONResponse(map[string]string{"noted": "true"}, w, r)
+}
+
+func (c *Controller) GetLastSeen(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.remote.LastSeen(), nil
+	}
+	utils.JSONListResponse(fn, w, r)
+}
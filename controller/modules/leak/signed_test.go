@@ -0,0 +1,154 @@
+package leak
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, tr http.Handler, endpoint, secret string, r SignedReport) int {
+	t.Helper()
+	body, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/sensors/leaks/"+endpoint, bytes.NewReader(body))
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+	rr := httptest.NewRecorder()
+	tr.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestSignedStatus(t *testing.T) {
+	c, tc, tr := newTestLeak(t)
+	c.LoadSensorAPI(tr.Router)
+	lk := Leak{
+		Name:             "sump",
+		EndpointID:       "sump",
+		Secret:           "s3cret",
+		OnStatusOneMacro: "leak",
+		Period:           60,
+	}
+	if err := c.Create(lk); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create(Leak{Name: "legacy", EndpointID: "legacy", Period: 60}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	report := SignedReport{Status: 1, Timestamp: now.Unix(), Nonce: "a"}
+
+	if code := signedRequest(t, tr.Router, "sump", "wrong", report); code != http.StatusUnauthorized {
+		t.Error("Report with invalid signature should be rejected, found:", code)
+	}
+	if code := signedRequest(t, tr.Router, "legacy", "", report); code != http.StatusUnauthorized {
+		t.Error("Sensors without secret should not accept signed reports, found:", code)
+	}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", report); code != http.StatusOK {
+		t.Fatal("Valid signed report should be accepted, found:", code)
+	}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", report); code != http.StatusUnauthorized {
+		t.Error("Replayed report should be rejected, found:", code)
+	}
+	stale := SignedReport{Status: 1, Timestamp: now.Add(-10 * time.Minute).Unix(), Nonce: "b"}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", stale); code != http.StatusUnauthorized {
+		t.Error("Stale report should be rejected, found:", code)
+	}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", SignedReport{Status: 1, Timestamp: now.Unix()}); code != http.StatusUnauthorized {
+		t.Error("Report without nonce should be rejected, found:", code)
+	}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", SignedReport{Status: 3, Timestamp: now.Unix(), Nonce: "c"}); code != http.StatusBadRequest {
+		t.Error("Report with invalid status should be rejected, found:", code)
+	}
+
+	// status reports are handled asynchronously
+	for i := 0; i < 100; i++ {
+		if s, _ := c.Get("1"); len(s.States) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s, _ := c.Get("1"); len(s.States) != 1 || s.States[0].Status != 1 {
+		t.Error("Verified report should be recorded, found:", s.States)
+	}
+	if len(tc.macros.calls) != 1 {
+		t.Error("Verified leak report should trigger the macro, found:", tc.macros.calls)
+	}
+
+	var seen map[string]LastSeen
+	if err := tr.Do("GET", "/api/leaks/last_seen", new(bytes.Buffer), &seen); err != nil {
+		t.Fatal("Failed to get last seen endpoints using api. Error:", err)
+	}
+	if s, ok := seen["sump"]; !ok || !s.Verified || s.Status != 1 || s.Error == "" || s.ErrorTime.IsZero() {
+		t.Error("Rejected reports should not hide the latest verified report, found:", seen)
+	}
+	if _, ok := seen["legacy"]; ok {
+		t.Error("Reports for sensors without secret should not be recorded, found:", seen)
+	}
+
+	var l Leak
+	if err := tr.Do("GET", "/api/leaks/1", new(bytes.Buffer), &l); err != nil {
+		t.Fatal("Failed to get leak sensor using api. Error:", err)
+	}
+	if l.Secret != "" || !l.HasSecret {
+		t.Error("Secret should be hidden from api responses, found:", l.Secret, l.HasSecret)
+	}
+	var lks []Leak
+	if err := tr.Do("GET", "/api/leaks", new(bytes.Buffer), &lks); err != nil {
+		t.Fatal("Failed to list leak sensors using api. Error:", err)
+	}
+	for _, lk := range lks {
+		if lk.Secret != "" || lk.HasSecret != (lk.Name == "sump") {
+			t.Error("Secret should be hidden from api responses, found:", lk.Name, lk.Secret, lk.HasSecret)
+		}
+	}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(l)
+	if err := tr.Do("POST", "/api/leaks/1", body, nil); err != nil {
+		t.Fatal("Failed to update leak sensor using api. Error:", err)
+	}
+	report = SignedReport{Status: 0, Timestamp: time.Now().Unix(), Nonce: "d"}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", report); code != http.StatusOK {
+		t.Error("Update without secret should keep the stored one, found:", code)
+	}
+	l.ClearSecret = true
+	body = new(bytes.Buffer)
+	json.NewEncoder(body).Encode(l)
+	if err := tr.Do("POST", "/api/leaks/1", body, nil); err != nil {
+		t.Fatal("Failed to update leak sensor using api. Error:", err)
+	}
+	if s, _ := c.Get("1"); s.Secret != "" || s.ClearSecret {
+		t.Error("Update should clear the secret when requested, found:", s.Secret, s.ClearSecret)
+	}
+	report = SignedReport{Status: 0, Timestamp: time.Now().Unix(), Nonce: "e"}
+	if code := signedRequest(t, tr.Router, "sump", "s3cret", report); code != http.StatusUnauthorized {
+		t.Error("Sensors with cleared secret should not accept signed reports, found:", code)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newRemoteSensors()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	for i := 0; i < _rateLimit; i++ {
+		if !s.allow("10.0.0.2") {
+			t.Fatal("Requests below the rate limit should be allowed")
+		}
+	}
+	if s.allow("10.0.0.2") {
+		t.Error("Requests above the rate limit should be rejected")
+	}
+	if !s.allow("10.0.0.3") {
+		t.Error("Rate limit should apply per address")
+	}
+	now = now.Add(_rateWindow)
+	if !s.allow("10.0.0.2") {
+		t.Error("Rate limit should reset after the window")
+	}
+	if len(s.limits) != 1 {
+		t.Error("Expired rate limit windows should be dropped, found:", len(s.limits))
+	}
+}
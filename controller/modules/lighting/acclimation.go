@@ -0,0 +1,80 @@
+package lighting
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Acclimation ramps the intensity of a light over several days, for new tanks
+// and corals. Computed channel values are scaled to Start percent on the start
+// date, rising (or falling) by an equal step every day to reach End percent
+// after Duration days, where they stay. Manual channels are not scaled.
+type Acclimation struct {
+	Enable    bool    `json:"enable"`
+	Start     float64 `json:"start"`
+	End       float64 `json:"end"`
+	StartDate string  `json:"start_date"`
+	Duration  int     `json:"duration"`
+}
+
+// AcclimationStatus is the progress of an acclimation at a given time
+type AcclimationStatus struct {
+	Day      int     `json:"day"`
+	Percent  float64 `json:"percent"`
+	Complete bool    `json:"complete"`
+}
+
+func (a Acclimation) Validate() error {
+	if !a.Enable {
+		return nil
+	}
+	if a.Start < 0 || a.Start > 100 {
+		return fmt.Errorf("Acclimation start percent should be between 0 and 100. Supplied: %f", a.Start)
+	}
+	if a.End < 0 || a.End > 100 {
+		return fmt.Errorf("Acclimation end percent should be between 0 and 100. Supplied: %f", a.End)
+	}
+	if a.Duration <= 0 {
+		return fmt.Errorf("Acclimation duration should be at least one day. Supplied: %d", a.Duration)
+	}
+	if _, err := time.ParseInLocation(_dateFormat, a.StartDate, time.Local); err != nil {
+		return fmt.Errorf("Failed to parse acclimation start date. Error: %w", err)
+	}
+	return nil
+}
+
+// Status returns the acclimation progress on the day t falls in. Days before
+// the start date use the start percent.
+func (a Acclimation) Status(t time.Time) AcclimationStatus {
+	start, _ := time.ParseInLocation(_dateFormat, a.StartDate, t.Location())
+	today := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	// rounding copes with days that are not 24 hours long due to DST
+	day := int(math.Round(today.Sub(start).Hours() / 24))
+	if day < 0 {
+		day = 0
+	}
+	if day >= a.Duration {
+		return AcclimationStatus{Day: a.Duration, Percent: a.End, Complete: true}
+	}
+	return AcclimationStatus{
+		Day:     day,
+		Percent: a.Start + (a.End-a.Start)*float64(day)/float64(a.Duration),
+	}
+}
+
+func (a Acclimation) scale(t time.Time) float64 {
+	if !a.Enable {
+		return 1
+	}
+	return a.Status(t).Percent / 100
+}
+
+func (l *Light) loadAcclimation(t time.Time) {
+	if !l.Acclimation.Enable {
+		l.AcclimationStatus = nil
+		return
+	}
+	s := l.Acclimation.Status(t)
+	l.AcclimationStatus = &s
+}
@@ -0,0 +1,104 @@
+package lighting
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func TestAcclimationStatus(t *testing.T) {
+	a := Acclimation{Enable: true, Start: 50, End: 100, StartDate: "2024-03-01", Duration: 10}
+	if err := a.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		date     string
+		day      int
+		percent  float64
+		complete bool
+	}{
+		{"2024-02-20", 0, 50, false},
+		{"2024-03-01", 0, 50, false},
+		{"2024-03-05", 4, 70, false},
+		{"2024-03-11", 10, 100, true},
+		{"2024-05-01", 10, 100, true},
+	} {
+		d, _ := time.ParseInLocation(_dateFormat, c.date, time.Local)
+		s := a.Status(d.Add(13 * time.Hour))
+		if s.Day != c.day || s.Percent != c.percent || s.Complete != c.complete {
+			t.Error("Unexpected acclimation status on", c.date, "found:", s)
+		}
+	}
+	a.Duration = 0
+	if err := a.Validate(); err == nil {
+		t.Error("Acclimation without duration should fail validation")
+	}
+	a.Enable = false
+	if err := a.Validate(); err != nil {
+		t.Error("Disabled acclimation should not be validated. Error:", err)
+	}
+}
+
+func TestAcclimationAPI(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	if err := con.DM().Drivers().Create(drivers.Driver{Name: "lighting", Type: "pca9685", Config: []byte(`{"address":64, "frequency":1000}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Create(connectors.Jack{Name: "J1", Pins: []int{3, 4}, Driver: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(Config{DevMode: true, Interval: time.Hour}, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	start := time.Now().AddDate(0, 0, -7)
+	l := Light{Name: "L1", Jack: "1",
+		Acclimation: Acclimation{Enable: true, Start: 50, End: 100, StartDate: start.Format(_dateFormat), Duration: 14},
+		Channels: map[int]*Channel{
+			3: {Name: "white", On: true, ProfileSpec: pwm_profile.ProfileSpec{Type: "fixed", Config: []byte(`{"start":"00:00:00","end":"23:59:59","value":80}`)}},
+			4: {Name: "blue", On: true, Manual: true, Value: 80},
+		}}
+	if err := c.Create(l); err != nil {
+		t.Fatal(err)
+	}
+	light := c.lights["1"]
+	if v, _ := c.channelValue(light, light.Channels[3], time.Now()); v != 60 {
+		t.Error("Expected acclimated value 60, found:", v)
+	}
+	if v, _ := c.channelValue(light, light.Channels[4], time.Now()); v != 80 {
+		t.Error("Manual channels should not be acclimated, found:", v)
+	}
+	var got Light
+	if err := tr.Do("GET", "/api/lights/1", strings.NewReader("{}"), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.AcclimationStatus == nil || got.AcclimationStatus.Day != 7 || got.AcclimationStatus.Percent != 75 {
+		t.Error("Expected acclimation progress in light state, found:", got.AcclimationStatus)
+	}
+	var p Preview
+	date := start.AddDate(0, 0, 20).Format(_dateFormat)
+	if err := tr.Do("GET", "/api/lights/1/preview?step=6h&date="+date, strings.NewReader("{}"), &p); err != nil {
+		t.Fatal(err)
+	}
+	if v := p.Channels[3].Values[0]; v != 80 {
+		t.Error("Expected full value after acclimation in preview, found:", v)
+	}
+}
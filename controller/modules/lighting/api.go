@@ -1,19 +1,37 @@
 package lighting
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
 	"github.com/reef-pi/reef-pi/controller/utils"
 )
 
 func (c *Controller) LoadAPI(r *mux.Router) {
 	r.HandleFunc("/api/lights", c.ListLights).Methods("GET")
 	r.HandleFunc("/api/lights", c.CreateLight).Methods("PUT")
+	r.HandleFunc("/api/lights/preview", c.previewBudget).Methods("POST")
+	r.HandleFunc("/api/lights/profiles", c.listProfiles).Methods("GET")
+	r.HandleFunc("/api/lights/profiles", c.createProfile).Methods("PUT")
+	r.HandleFunc("/api/lights/profiles/export", c.exportProfiles).Methods("GET")
+	r.HandleFunc("/api/lights/profiles/import", c.importProfiles).Methods("POST")
+	r.HandleFunc("/api/lights/profiles/validate", c.validateProfile).Methods("POST")
+	r.HandleFunc("/api/lights/profiles/{id}", c.getProfile).Methods("GET")
+	r.HandleFunc("/api/lights/profiles/{id}", c.updateProfile).Methods("POST")
+	r.HandleFunc("/api/lights/profiles/{id}", c.deleteProfile).Methods("DELETE")
 	r.HandleFunc("/api/lights/{id}", c.GetLight).Methods("GET")
 	r.HandleFunc("/api/lights/{id}", c.UpdateLight).Methods("POST")
 	r.HandleFunc("/api/lights/{id}", c.DeleteLight).Methods("DELETE")
+	r.HandleFunc("/api/lights/{id}/preview", c.previewLight).Methods("GET")
+	r.HandleFunc("/api/lights/{id}/overrides", c.listOverrides).Methods("GET")
+	r.HandleFunc("/api/lights/{id}/overrides", c.addOverride).Methods("POST")
+	r.HandleFunc("/api/lights/{id}/overrides", c.clearOverrides).Methods("DELETE")
+	r.HandleFunc("/api/lights/{id}/overrides/{oid}", c.endOverride).Methods("DELETE")
 }
 
 func (c *Controller) GetLight(w http.ResponseWriter, r *http.Request) {
@@ -25,7 +43,13 @@ func (c *Controller) GetLight(w http.ResponseWriter, r *http.Request) {
 
 func (c *Controller) ListLights(w http.ResponseWriter, r *http.Request) {
 	fn := func() (interface{}, error) {
-		return c.List()
+		ls, err := c.List()
+		now := time.Now()
+		for i := range ls {
+			ls[i].Overrides = c.Overrides(ls[i].ID)
+			ls[i].loadAcclimation(now)
+		}
+		return ls, err
 	}
 	utils.JSONListResponse(fn, w, r)
 }
@@ -49,3 +73,163 @@ func (c *Controller) DeleteLight(w http.ResponseWriter, r *http.Request) {
 	}
 	utils.JSONDeleteResponse(fn, w, r)
 }
+
+func (c *Controller) getProfile(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.GetProfile(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) listProfiles(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.ListProfiles()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Controller) createProfile(w http.ResponseWriter, r *http.Request) {
+	var p StoredProfile
+	fn := func() error {
+		return c.CreateProfile(p)
+	}
+	utils.JSONCreateResponse(&p, fn, w, r)
+}
+
+func (c *Controller) updateProfile(w http.ResponseWriter, r *http.Request) {
+	var p StoredProfile
+	fn := func(id string) error {
+		return c.UpdateProfile(id, p)
+	}
+	utils.JSONUpdateResponse(&p, fn, w, r)
+}
+
+func (c *Controller) deleteProfile(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.DeleteProfile(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) exportProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Disposition", `attachment; filename="lighting_profiles.json"`)
+	c.listProfiles(w, r)
+}
+
+func (c *Controller) importProfiles(w http.ResponseWriter, r *http.Request) {
+	var ps []StoredProfile
+	fn := func() error {
+		return c.ImportProfiles(ps)
+	}
+	utils.JSONCreateResponse(&ps, fn, w, r)
+}
+
+func (c *Controller) listOverrides(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		if _, err := c.Get(id); err != nil {
+			return nil, err
+		}
+		return c.Overrides(id), nil
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) addOverride(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var o Override
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	o, err := c.AddOverride(mux.Vars(r)["id"], o)
+	if err != nil {
+		utils.ErrorResponse(http.StatusInternalServerError, "Failed to override. Error: "+err.Error(), w)
+		return
+	}
+	utils.JSONResponse(o, w, r)
+}
+
+func (c *Controller) clearOverrides(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		if _, err := c.Get(id); err != nil {
+			return err
+		}
+		c.ClearOverrides(id, "")
+		return nil
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) endOverride(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.EndOverride(id, mux.Vars(r)["oid"])
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+// previewBudget computes the daily light budget of a light configuration,
+// which does not have to be saved, for today or the date query parameter
+func (c *Controller) previewBudget(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var l Light
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	day, err := previewDate(r)
+	if err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	b, err := c.Budget(l, day)
+	if err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, "Failed to compute light budget. Error: "+err.Error(), w)
+		return
+	}
+	utils.JSONResponse(b, w, r)
+}
+
+func previewDate(r *http.Request) (time.Time, error) {
+	d := r.URL.Query().Get("date")
+	if d == "" {
+		return time.Now(), nil
+	}
+	t, err := time.ParseInLocation(_dateFormat, d, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("Failed to parse date. Error: %w", err)
+	}
+	return t, nil
+}
+
+// previewLight returns the simulated output of a light over the day given
+// by the date query parameter, sampled every step (a duration like 5m)
+func (c *Controller) previewLight(w http.ResponseWriter, r *http.Request) {
+	day, err := previewDate(r)
+	if err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	step := DefaultPreviewStep
+	if s := r.URL.Query().Get("step"); s != "" {
+		step, err = time.ParseDuration(s)
+		if err != nil {
+			utils.ErrorResponse(http.StatusBadRequest, "Failed to parse step. Error: "+err.Error(), w)
+			return
+		}
+	}
+	fn := func(id string) (interface{}, error) {
+		return c.Preview(id, day, step)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+// validateProfile reports misconfigurations of a profile before it is saved
+func (c *Controller) validateProfile(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var spec pwm_profile.ProfileSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		utils.ErrorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+	utils.JSONResponse(pwm_profile.Diagnose(spec), w, r)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/reef-pi/reef-pi/controller"
 	"github.com/reef-pi/reef-pi/controller/connectors"
 	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
 	"github.com/reef-pi/reef-pi/controller/utils"
 	"strings"
 	"testing"
@@ -121,4 +122,173 @@ func TestLightingAPI(t *testing.T) {
 	channels[1] = ch
 	l.Channels = channels
 	c.syncLight(&l)
+
+	// stored profiles can be shared across channels
+	sp := StoredProfile{ProfileSpec: pwm_profile.ProfileSpec{
+		Name:   "reef crest",
+		Type:   "keyframe",
+		Config: []byte(`{"interpolation":"cosine","points":[{"time":"08:00:00","value":0},{"time":"12:00:00","value":80},{"time":"20:00:00","value":0}]}`),
+	}}
+	body.Reset()
+	enc.Encode(sp)
+	if err := tr.Do("PUT", "/api/lights/profiles", body, nil); err != nil {
+		t.Fatal("Failed to create stored profile using api. Error:", err)
+	}
+	var sps []StoredProfile
+	if err := tr.Do("GET", "/api/lights/profiles", strings.NewReader("{}"), &sps); err != nil {
+		t.Fatal("Failed to list stored profiles using api. Error:", err)
+	}
+	if len(sps) != 1 || sps[0].Name != "reef crest" || sps[0].Type != "keyframe" {
+		t.Error("Unexpected stored profiles:", sps)
+	}
+	sp.Config = []byte(`{"points":[]}`)
+	body.Reset()
+	enc.Encode(sp)
+	if err := tr.Do("POST", "/api/lights/profiles/1", body, nil); err == nil {
+		t.Error("Updating stored profile with invalid keyframes should fail")
+	}
+	if err := tr.Do("GET", "/api/lights/profiles/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to get stored profile using api. Error:", err)
+	}
+	kl := Light{Name: "keyframe", Jack: "1", Channels: map[int]*Channel{3: {Name: "white", On: true, ProfileID: "1"}}}
+	if err := c.Create(kl); err != nil {
+		t.Fatal(err)
+	}
+	var klID string
+	for id, light := range c.lights {
+		if light.Name == "keyframe" {
+			klID = id
+		}
+	}
+	kch := c.lights[klID].Channels[3]
+	if kch.Manual || kch.ProfileSpec.Type != "keyframe" {
+		t.Error("Channel should use stored keyframe profile, found:", kch.ProfileSpec.Type)
+	}
+	noon := time.Now()
+	noon = time.Date(noon.Year(), noon.Month(), noon.Day(), 12, 0, 0, 0, noon.Location())
+	if v, err := kch.ValueAt(noon); err != nil || v != 80 {
+		t.Error("Expected stored profile value 80 at noon, found:", v, err)
+	}
+	ml := Light{Name: "manual", Jack: "1", Channels: map[int]*Channel{4: {Name: "blue", On: true, Manual: true, Value: 30, ProfileID: "1"}}}
+	if err := c.resolveProfiles(&ml); err != nil {
+		t.Fatal(err)
+	}
+	if ch := ml.Channels[4]; !ch.Manual || ch.ProfileSpec.Type != "keyframe" {
+		t.Error("Resolving a stored profile should keep the channel in manual mode")
+	}
+	kl.Channels[3].ProfileID = "99"
+	if err := c.Create(kl); err == nil {
+		t.Error("Channel referring non existent profile should fail")
+	}
+	if err := tr.Do("DELETE", "/api/lights/profiles/1", strings.NewReader("{}"), nil); err == nil {
+		t.Error("Deleting a profile used by a light should fail")
+	}
+	if deps, err := c.InUse(ProfileBucket, "1"); err != nil || len(deps) != 1 {
+		t.Error("Expected profile to be used by one light, found:", deps, err)
+	}
+
+	// updates propagate to referring lights
+	sp.Config = []byte(`{"points":[{"time":"08:00:00","value":0},{"time":"12:00:00","value":40},{"time":"20:00:00","value":0}]}`)
+	body.Reset()
+	enc.Encode(sp)
+	if err := tr.Do("POST", "/api/lights/profiles/1", body, nil); err != nil {
+		t.Fatal("Failed to update stored profile using api. Error:", err)
+	}
+	if v, err := c.lights[klID].Channels[3].ValueAt(noon); err != nil || v != 40 {
+		t.Error("Expected updated profile value 40 at noon, found:", v, err)
+	}
+	if l, _ := c.Get(klID); string(l.Channels[3].ProfileSpec.Config) != string(sp.Config) {
+		t.Error("Stored light should carry updated profile, found:", string(l.Channels[3].ProfileSpec.Config))
+	}
+	sp.Name = "duplicate"
+	if err := c.CreateProfile(sp); err != nil {
+		t.Fatal(err)
+	}
+	sp.Name = "reef crest"
+	if err := c.CreateProfile(sp); err == nil {
+		t.Error("Profile names should be unique")
+	}
+
+	// export and import
+	var exported []StoredProfile
+	if err := tr.Do("GET", "/api/lights/profiles/export", strings.NewReader("{}"), &exported); err != nil {
+		t.Fatal("Failed to export profiles using api. Error:", err)
+	}
+	if len(exported) != 2 {
+		t.Error("Expected two exported profiles, found:", len(exported))
+	}
+	exported[0].Config = []byte(`{"points":[{"time":"08:00:00","value":0},{"time":"12:00:00","value":20},{"time":"20:00:00","value":0}]}`)
+	exported = append(exported, StoredProfile{ProfileSpec: pwm_profile.ProfileSpec{Name: "new", Type: "keyframe", Config: exported[0].Config}})
+	body.Reset()
+	enc.Encode(exported)
+	if err := tr.Do("POST", "/api/lights/profiles/import", body, nil); err != nil {
+		t.Fatal("Failed to import profiles using api. Error:", err)
+	}
+	if ps, _ := c.ListProfiles(); len(ps) != 3 {
+		t.Error("Expected import to add one profile, found:", len(ps))
+	}
+	if v, _ := c.lights[klID].Channels[3].ValueAt(noon); v != 20 {
+		t.Error("Imported profile should propagate to lights, found:", v)
+	}
+	if err := c.ImportProfiles([]StoredProfile{exported[2], exported[2]}); err == nil {
+		t.Error("Importing duplicate names should fail")
+	}
+	// a light that can not be reloaded fails the import half way
+	broken := Light{ID: "99", Name: "broken", Jack: "99", Channels: map[int]*Channel{3: {Name: "white", ProfileID: "1"}}}
+	if err := c.c.Store().Update(Bucket, broken.ID, broken); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := c.GetProfile("1")
+	partial := []StoredProfile{
+		{ProfileSpec: pwm_profile.ProfileSpec{Name: "partial", Type: "keyframe", Config: exported[0].Config}},
+		{ProfileSpec: pwm_profile.ProfileSpec{Name: before.Name, Type: "keyframe", Config: sp.Config}},
+	}
+	if err := c.ImportProfiles(partial); err == nil {
+		t.Error("Import should fail when a light can not be reloaded")
+	}
+	if ps, _ := c.ListProfiles(); len(ps) != 3 {
+		t.Error("Failed import should not add profiles, found:", len(ps))
+	}
+	if after, _ := c.GetProfile("1"); string(after.Config) != string(before.Config) {
+		t.Error("Failed import should restore updated profiles, found:", string(after.Config))
+	}
+	update := before
+	update.Config = sp.Config
+	if err := c.UpdateProfile("1", update); err == nil {
+		t.Error("Profile update should fail when a light rejects it")
+	}
+	if after, _ := c.GetProfile("1"); string(after.Config) != string(before.Config) {
+		t.Error("Rejected profile update should not be saved, found:", string(after.Config))
+	}
+	if v, _ := c.lights[klID].Channels[3].ValueAt(noon); v != 20 {
+		t.Error("Rejected profile update should not reload lights, found:", v)
+	}
+	if err := c.c.Store().Delete(Bucket, broken.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(klID); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Do("DELETE", "/api/lights/profiles/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to delete stored profile using api. Error:", err)
+	}
+
+	// channels simulating weather should share the same sky
+	base := `"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00","value":50}}`
+	wl := Light{
+		Name: "weather",
+		Channels: map[int]*Channel{
+			1: {Name: "white", ProfileSpec: pwm_profile.ProfileSpec{Type: "weather", Config: []byte(`{` + base + `,"seed":1,"clouds":{"frequency":4,"duration":300,"depth":0.6}}`)}},
+			2: {Name: "blue", ProfileSpec: pwm_profile.ProfileSpec{Type: "weather", Config: []byte(`{` + base + `,"seed":1,"clouds":{"frequency":4,"duration":300,"depth":0.6}}`)}},
+		},
+	}
+	wl.LoadChannels()
+	if err := wl.validateWeather(); err != nil {
+		t.Error(err)
+	}
+	wl.Channels[2].ProfileSpec.Config = []byte(`{` + base + `,"seed":2,"clouds":{"frequency":4,"duration":300,"depth":0.6}}`)
+	wl.LoadChannels()
+	if err := wl.validateWeather(); err == nil {
+		t.Error("Channels of a light with different weather should fail validation")
+	}
 }
@@ -0,0 +1,164 @@
+package lighting
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	_budgetStep = time.Minute
+	_dateFormat = "2006-01-02"
+)
+
+// ChannelBudget is the contribution of a single channel over a day
+type ChannelBudget struct {
+	Name       string  `json:"name"`
+	Color      string  `json:"color"`
+	Peak       float64 `json:"peak"`
+	PeakPAR    float64 `json:"peak_par"`
+	PeakLumens float64 `json:"peak_lumens"`
+	DLI        float64 `json:"dli"`
+}
+
+// Budget summarizes the combined output of a light over a day. PAR is in
+// µmol/m²/s and the daily light integral (DLI) in mol/m²/day, both derived
+// from the per channel calibration. Output is a percentage of all channels
+// at 100%.
+type Budget struct {
+	Date       string                `json:"date"`
+	DLI        float64               `json:"dli"`
+	PeakPAR    float64               `json:"peak_par"`
+	PeakLumens float64               `json:"peak_lumens"`
+	PeakOutput float64               `json:"peak_output"`
+	Capped     bool                  `json:"capped"`
+	Channels   map[int]ChannelBudget `json:"channels"`
+}
+
+func (l *Light) validateBudget() error {
+	if l.Cap < 0 || l.Cap > 100 {
+		return fmt.Errorf("Output cap should be between 0 and 100. Supplied: %f", l.Cap)
+	}
+	for _, ch := range l.Channels {
+		if ch.PAR < 0 {
+			return fmt.Errorf("PAR calibration of channel %s can not be negative. Supplied: %f", ch.Name, ch.PAR)
+		}
+		if ch.Lumens < 0 {
+			return fmt.Errorf("Lumens calibration of channel %s can not be negative. Supplied: %f", ch.Name, ch.Lumens)
+		}
+	}
+	return nil
+}
+
+// weights returns how much each channel contributes to the combined output.
+// PAR calibration is preferred over lumens, uncalibrated lights weigh all
+// channels equally.
+func (l *Light) weights() map[int]float64 {
+	var par, lumens bool
+	for _, ch := range l.Channels {
+		par = par || ch.PAR > 0
+		lumens = lumens || ch.Lumens > 0
+	}
+	ws := make(map[int]float64)
+	for pin, ch := range l.Channels {
+		switch {
+		case par:
+			ws[pin] = ch.PAR
+		case lumens:
+			ws[pin] = ch.Lumens
+		default:
+			ws[pin] = 1
+		}
+	}
+	return ws
+}
+
+// output returns the combined output of channel values as a percentage of
+// all channels at 100%
+func (l *Light) output(values map[int]float64) float64 {
+	var sum, full float64
+	for pin, w := range l.weights() {
+		sum += values[pin] * w
+		full += 100 * w
+	}
+	if full == 0 {
+		return 0
+	}
+	return sum / full * 100
+}
+
+// capOutput scales all channel values down by the same factor when their
+// combined output exceeds the cap, which keeps the spectrum ratio intact
+func (l *Light) capOutput(values map[int]float64) bool {
+	if l.Cap <= 0 || l.Cap >= 100 {
+		return false
+	}
+	total := l.output(values)
+	if total <= l.Cap {
+		return false
+	}
+	f := l.Cap / total
+	for pin := range values {
+		values[pin] *= f
+	}
+	return true
+}
+
+// values returns the acclimated and capped profile values of all channels at
+// t, overrides and thermal dimming are not included. Manual channels are not
+// acclimated.
+func (l *Light) values(t time.Time) (map[int]float64, bool, error) {
+	values := make(map[int]float64)
+	for pin, ch := range l.Channels {
+		v, err := ch.ValueAt(t)
+		if err != nil {
+			return nil, false, fmt.Errorf("channel: %s. Error: %w", ch.Name, err)
+		}
+		if !ch.Manual {
+			v *= l.Acclimation.scale(t)
+		}
+		values[pin] = v
+	}
+	capped := l.capOutput(values)
+	return values, capped, nil
+}
+
+// Budget computes the daily light integral and peak output of a light for the
+// day t falls in, sampling its profiles every minute
+func (c *Controller) Budget(l Light, t time.Time) (Budget, error) {
+	b := Budget{
+		Date:     t.Format(_dateFormat),
+		Channels: make(map[int]ChannelBudget),
+	}
+	if err := c.validate(&l); err != nil {
+		return b, err
+	}
+	for pin, ch := range l.Channels {
+		b.Channels[pin] = ChannelBudget{Name: ch.Name, Color: ch.Color}
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for s := midnight; s.Before(midnight.Add(24 * time.Hour)); s = s.Add(_budgetStep) {
+		values, capped, err := l.values(s)
+		if err != nil {
+			return b, err
+		}
+		b.Capped = b.Capped || capped
+		b.PeakOutput = math.Max(b.PeakOutput, l.output(values))
+		var par, lumens float64
+		for pin, v := range values {
+			ch := l.Channels[pin]
+			cb := b.Channels[pin]
+			cb.Peak = math.Max(cb.Peak, v)
+			cb.PeakPAR = math.Max(cb.PeakPAR, v/100*ch.PAR)
+			cb.PeakLumens = math.Max(cb.PeakLumens, v/100*ch.Lumens)
+			cb.DLI += v / 100 * ch.PAR * _budgetStep.Seconds() / 1e6
+			b.Channels[pin] = cb
+			par += v / 100 * ch.PAR
+			lumens += v / 100 * ch.Lumens
+		}
+		b.PeakPAR = math.Max(b.PeakPAR, par)
+		b.PeakLumens = math.Max(b.PeakLumens, lumens)
+		b.DLI += par * _budgetStep.Seconds() / 1e6
+	}
+	return b, nil
+}
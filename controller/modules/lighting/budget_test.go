@@ -0,0 +1,97 @@
+package lighting
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func TestCapOutput(t *testing.T) {
+	l := Light{Cap: 25, Channels: map[int]*Channel{
+		1: {Name: "white"},
+		2: {Name: "blue"},
+	}}
+	values := map[int]float64{1: 80, 2: 20}
+	if !l.capOutput(values) {
+		t.Error("Output above cap should be scaled")
+	}
+	if values[1] != 40 || values[2] != 10 {
+		t.Error("Expected values scaled to 40 and 10, found:", values)
+	}
+	l.Channels[1].PAR = 100
+	l.Channels[2].PAR = 300
+	values = map[int]float64{1: 80, 2: 20}
+	if o := l.output(values); o != 35 {
+		t.Error("Expected PAR weighted output 35, found:", o)
+	}
+	l.Cap = 40
+	if l.capOutput(values) {
+		t.Error("Output below cap should not be scaled")
+	}
+}
+
+func TestBudgetAPI(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	if err := con.DM().Drivers().Create(drivers.Driver{Name: "lighting", Type: "pca9685", Config: []byte(`{"address":64, "frequency":1000}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Create(connectors.Jack{Name: "J1", Pins: []int{3, 4}, Driver: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(Config{DevMode: true, Interval: time.Hour}, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	l := Light{Name: "L1", Jack: "1", Cap: 50, Channels: map[int]*Channel{
+		3: {Name: "white", On: true, Manual: true, Value: 100, PAR: 200},
+		4: {Name: "blue", On: true, Manual: true, Value: 100, PAR: 600},
+	}}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(l)
+	var b Budget
+	if err := tr.Do("POST", "/api/lights/preview?date=2024-03-01", body, &b); err != nil {
+		t.Fatal("Failed to preview light budget using api. Error:", err)
+	}
+	if b.Date != "2024-03-01" || !b.Capped {
+		t.Error("Unexpected budget:", b)
+	}
+	if b.PeakOutput != 50 || b.PeakPAR != 400 {
+		t.Error("Expected output capped at 50% and 400 PAR, found:", b.PeakOutput, b.PeakPAR)
+	}
+	if b.Channels[3].Peak != 50 || b.Channels[4].Peak != 50 {
+		t.Error("Capping should preserve the spectrum ratio, found:", b.Channels)
+	}
+	// 400 µmol/m²/s for a whole day
+	if math.Abs(b.DLI-34.56) > 1e-6 {
+		t.Error("Expected DLI 34.56, found:", b.DLI)
+	}
+	if math.Abs(b.Channels[4].DLI-25.92) > 1e-6 {
+		t.Error("Expected blue channel DLI 25.92, found:", b.Channels[4].DLI)
+	}
+
+	l.Cap = 120
+	body = new(bytes.Buffer)
+	json.NewEncoder(body).Encode(l)
+	if err := tr.Do("POST", "/api/lights/preview", body, &b); err == nil {
+		t.Error("Cap above 100 should fail validation")
+	}
+}
@@ -17,6 +17,9 @@ type Channel struct {
 	Manual      bool                    `json:"manual"`
 	Value       float64                 `json:"value"`
 	ProfileSpec pwm_profile.ProfileSpec `json:"profile"`
+	ProfileID   string                  `json:"profile_id"`
+	PAR         float64                 `json:"par"`
+	Lumens      float64                 `json:"lumens"`
 	profile     pwm_profile.Profile
 }
 
@@ -63,3 +66,13 @@ func (ch *Channel) ValueAt(t time.Time) (float64, error) {
 	}
 	return v, nil
 }
+
+// flashing reports whether a lightning flash is on at this sync or was on at
+// the previous one. Flashes are not faded in or out.
+func (ch *Channel) flashing(now time.Time, interval time.Duration) bool {
+	if ch.Manual || !ch.On {
+		return false
+	}
+	wp, ok := ch.profile.(pwm_profile.WeatherProfile)
+	return ok && (wp.Flashing(now) || wp.Flashing(now.Add(-interval)))
+}
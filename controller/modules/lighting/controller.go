@@ -29,16 +29,29 @@ type Controller struct {
 	running bool
 	c       controller.Controller
 	lights  map[string]*Light
+	// overrides are kept in memory only, a restart resumes the profiles
+	overrides  map[string][]Override
+	overrideID int
+	ramps      map[string]*ramp
+	thermal    map[string]float64
+	// lights whose temperature can not be trusted, alerted once
+	thermalLost map[string]bool
+	rampStep    time.Duration
 }
 
 func New(conf Config, c controller.Controller) (*Controller, error) {
 	return &Controller{
-		Mutex:  sync.Mutex{},
-		c:      c,
-		jacks:  c.DM().Jacks(),
-		config: conf,
-		stopCh: make(chan struct{}),
-		lights: make(map[string]*Light),
+		Mutex:       sync.Mutex{},
+		c:           c,
+		jacks:       c.DM().Jacks(),
+		config:      conf,
+		stopCh:      make(chan struct{}),
+		lights:      make(map[string]*Light),
+		overrides:   make(map[string][]Override),
+		ramps:       make(map[string]*ramp),
+		thermal:     make(map[string]float64),
+		thermalLost: make(map[string]bool),
+		rampStep:    DefaultRampStep,
 	}, nil
 }
 
@@ -61,6 +74,7 @@ func (c *Controller) StartCycle() {
 
 func (c *Controller) Stop() {
 	c.stopCh <- struct{}{}
+	c.stopRamps()
 	log.Println("Stopped lighting cycle")
 }
 
@@ -70,11 +84,17 @@ func (c *Controller) Setup() error {
 	if err := c.c.Store().CreateBucket(Bucket); err != nil {
 		return err
 	}
+	if err := c.c.Store().CreateBucket(ProfileBucket); err != nil {
+		return err
+	}
 	lights, err := c.List()
 	if err != nil {
 		return err
 	}
 	for i, light := range lights {
+		if err := c.resolveProfiles(&lights[i]); err != nil {
+			log.Println("ERROR: lighting subsystem. Failed to load stored profile for light:", light.Name, "Error:", err)
+		}
 		lights[i].LoadChannels()
 		c.lights[light.ID] = &lights[i]
 		for _, ch := range light.Channels {
@@ -115,6 +135,28 @@ func (c *Controller) InUse(depType, id string) ([]string, error) {
 			}
 		}
 		return deps, nil
+	case ProfileBucket:
+		lights, err := c.List()
+		if err != nil {
+			return deps, err
+		}
+		for _, l := range lights {
+			if l.usesProfile(id) {
+				deps = append(deps, l.Name)
+			}
+		}
+		return deps, nil
+	case storage.TemperatureBucket:
+		lights, err := c.List()
+		if err != nil {
+			return deps, err
+		}
+		for _, l := range lights {
+			if l.Thermal.TC == id {
+				deps = append(deps, l.Name)
+			}
+		}
+		return deps, nil
 	default:
 		return deps, fmt.Errorf("unknown dep type:%s", depType)
 	}
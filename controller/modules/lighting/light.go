@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
 )
 
 type Light struct {
@@ -13,6 +15,15 @@ type Light struct {
 	Channels map[int]*Channel `json:"channels"`
 	Jack     string           `json:"jack"`
 	Enable   bool             `json:"enable"`
+	Fade     FadeConfig       `json:"fade"`
+	// Cap limits the combined output to a percentage of all channels at 100%
+	Cap         float64     `json:"cap"`
+	Thermal     Thermal     `json:"thermal"`
+	Acclimation Acclimation `json:"acclimation"`
+	// Overrides are the active temporary overrides and AcclimationStatus the
+	// current acclimation progress, they are not stored
+	Overrides         []Override         `json:"overrides"`
+	AcclimationStatus *AcclimationStatus `json:"acclimation_status"`
 }
 
 func (l *Light) LoadChannels() {
@@ -25,7 +36,12 @@ func (l *Light) LoadChannels() {
 
 func (c *Controller) Get(id string) (Light, error) {
 	var l Light
-	return l, c.c.Store().Get(Bucket, id, &l)
+	if err := c.c.Store().Get(Bucket, id, &l); err != nil {
+		return l, err
+	}
+	l.Overrides = c.Overrides(id)
+	l.loadAcclimation(time.Now())
+	return l, nil
 }
 
 func (c Controller) List() ([]Light, error) {
@@ -41,7 +57,7 @@ func (c Controller) List() ([]Light, error) {
 	return ls, c.c.Store().List(Bucket, fn)
 }
 
-func (c *Controller) validate(l *Light) error {
+func (c *Controller) validate(l *Light, pending ...StoredProfile) error {
 	if l.Name == "" {
 		return fmt.Errorf("Light name can not be empty")
 	}
@@ -52,6 +68,20 @@ func (c *Controller) validate(l *Light) error {
 	if l.Channels == nil {
 		l.Channels = make(map[int]*Channel)
 	}
+	l.Overrides = nil
+	l.AcclimationStatus = nil
+	if err := l.Fade.Validate(); err != nil {
+		return err
+	}
+	if err := l.Thermal.Validate(); err != nil {
+		return err
+	}
+	if err := l.Acclimation.Validate(); err != nil {
+		return err
+	}
+	if err := c.resolveProfiles(l, pending...); err != nil {
+		return err
+	}
 	for i, pin := range j.Pins {
 		ch, ok := l.Channels[pin]
 		if !ok {
@@ -65,6 +95,9 @@ func (c *Controller) validate(l *Light) error {
 			ch.Manual = true
 		}
 		if !ch.Manual {
+			if err := ch.ProfileSpec.Validate(); err != nil {
+				return fmt.Errorf("invalid profile for channel: %s. Error: %w", ch.Name, err)
+			}
 			if err := ch.loadProfile(); err != nil {
 				return fmt.Errorf("invalid profile for channel: %s. Error: %w", ch.Name, err)
 			}
@@ -75,6 +108,29 @@ func (c *Controller) validate(l *Light) error {
 		l.Channels[pin] = ch
 	}
 	l.LoadChannels()
+	if err := l.validateBudget(); err != nil {
+		return err
+	}
+	return l.validateWeather()
+}
+
+// validateWeather ensures all channels simulating weather share the same sky,
+// so that clouds and lightning affect the whole light at once
+func (l *Light) validateWeather() error {
+	var first *Channel
+	for _, ch := range l.Channels {
+		wp, ok := ch.profile.(pwm_profile.WeatherProfile)
+		if !ok || ch.Manual {
+			continue
+		}
+		if first == nil {
+			first = ch
+			continue
+		}
+		if wp.Sky() != first.profile.(pwm_profile.WeatherProfile).Sky() {
+			return fmt.Errorf("weather settings of channel %s differ from channel %s, all channels of a light should share the same weather", ch.Name, first.Name)
+		}
+	}
 	return nil
 }
 
@@ -107,8 +163,12 @@ func (c *Controller) Update(id string, l Light) error {
 		return err
 	}
 	c.Lock()
+	old, ok := c.lights[l.ID]
 	c.lights[l.ID] = &l
 	c.Unlock()
+	if ok && old.Jack != l.Jack {
+		c.releaseRamp(old.Jack)
+	}
 	if l.Enable {
 		c.syncLight(&l)
 	}
@@ -116,7 +176,7 @@ func (c *Controller) Update(id string, l Light) error {
 }
 
 func (c *Controller) Delete(id string) error {
-	_, err := c.Get(id)
+	l, err := c.Get(id)
 	if err != nil {
 		return err
 	}
@@ -125,18 +185,50 @@ func (c *Controller) Delete(id string) error {
 	}
 	c.Lock()
 	delete(c.lights, id)
+	delete(c.thermal, id)
+	delete(c.thermalLost, id)
 	c.Unlock()
+	c.releaseRamp(l.Jack)
 	return nil
 }
 
 func (c *Controller) syncLight(light *Light) {
-	for _, ch := range light.Channels {
-		v, err := ch.ValueAt(time.Now())
+	now := time.Now()
+	c.pruneOverrides(light.ID, now)
+	c.updateThermal(light)
+	// a ramp left over from earlier fade settings keeps owning the jack, so
+	// that it can not overwrite values set directly
+	r, ramping := c.activeRamp(light.Jack)
+	if light.Fade.enabled() && !ramping {
+		r, ramping = c.rampFor(light.Jack), true
+	}
+	u := rampUpdate{
+		fade:     light.Fade,
+		interval: c.config.Interval,
+		targets:  make(map[int]rampTarget),
+	}
+	values := make(map[int]float64)
+	for pin, ch := range light.Channels {
+		v, err := c.channelValue(light, ch, now)
 		if err != nil {
 			log.Println("ERROR: lighting subsystem. Profile value computation error. Light:", light.Name, "channel:", ch.Name, "Error:", err)
 		}
+		values[pin] = v
+	}
+	if light.capOutput(values) {
+		log.Println("lighting subsystem: Output of light:", light.Name, "capped at", light.Cap, "%")
+	}
+	for pin, ch := range light.Channels {
+		v := values[pin]
 		log.Println("lighting subsystem: Setting Light: ", light.Name, "Channel:", ch.Name, "Value:", v)
-		c.UpdateChannel(light.Jack, *ch, v)
+		if ramping {
+			u.targets[ch.Pin] = rampTarget{value: v, on: ch.On, instant: ch.flashing(now, c.config.Interval)}
+		} else {
+			c.UpdateChannel(light.Jack, *ch, v)
+		}
 		c.c.Telemetry().EmitMetric(light.Name, ch.Name, v)
 	}
+	if ramping {
+		r.send(u)
+	}
 }
@@ -0,0 +1,193 @@
+package lighting
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Override temporarily sets channels of a light to fixed values. Channels maps
+// channel pins to values, when empty Value applies to all channels. The
+// override lasts for Duration seconds or until Until, after which the channels
+// fade back to their profile (or to an older override) over Fade seconds.
+type Override struct {
+	ID       string          `json:"id"`
+	Channels map[int]float64 `json:"channels"`
+	Value    float64         `json:"value"`
+	Duration time.Duration   `json:"duration"`
+	Until    time.Time       `json:"until"`
+	Fade     time.Duration   `json:"fade"`
+	Source   string          `json:"source"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+}
+
+// LightOverride is the target of macro steps and timer jobs overriding a light
+type LightOverride struct {
+	Light string `json:"light"`
+	Override
+}
+
+func (o *Override) validate(l Light, now time.Time) error {
+	if o.Value < 0 || o.Value > 100 {
+		return fmt.Errorf("Override value should be between 0 and 100. Supplied: %f", o.Value)
+	}
+	for pin, v := range o.Channels {
+		if _, ok := l.Channels[pin]; !ok {
+			return fmt.Errorf("Light '%s' has no channel at pin: %d", l.Name, pin)
+		}
+		if v < 0 || v > 100 {
+			return fmt.Errorf("Override value for pin %d should be between 0 and 100. Supplied: %f", pin, v)
+		}
+	}
+	if o.Fade < 0 {
+		return fmt.Errorf("Fade can not be negative. Supplied: %d", o.Fade)
+	}
+	switch {
+	case o.Duration > 0 && !o.Until.IsZero():
+		return fmt.Errorf("Only one of duration or until can be specified")
+	case o.Duration > 0:
+		o.End = now.Add(o.Duration * time.Second)
+	case !o.Until.IsZero():
+		if !o.Until.After(now) {
+			return fmt.Errorf("Override end time is in the past: %s", o.Until)
+		}
+		o.End = o.Until
+	default:
+		return fmt.Errorf("Override requires a duration or an end time")
+	}
+	o.Start = now
+	return nil
+}
+
+func (o Override) value(pin int) (float64, bool) {
+	if len(o.Channels) == 0 {
+		return o.Value, true
+	}
+	v, ok := o.Channels[pin]
+	return v, ok
+}
+
+func (o Override) expired(t time.Time) bool {
+	return !t.Before(o.End.Add(o.Fade * time.Second))
+}
+
+// apply stacks the overrides of a channel on top of its profile value. Newer
+// overrides take precedence, expired ones fade into whatever is beneath them.
+func apply(overrides []Override, pin int, v float64, t time.Time) float64 {
+	for _, o := range overrides {
+		ov, ok := o.value(pin)
+		if !ok || t.Before(o.Start) || o.expired(t) {
+			continue
+		}
+		if t.Before(o.End) {
+			v = ov
+			continue
+		}
+		progress := t.Sub(o.End).Seconds() / (o.Fade * time.Second).Seconds()
+		v = ov + (v-ov)*progress
+	}
+	return v
+}
+
+func (c *Controller) AddOverride(id string, o Override) (Override, error) {
+	l, err := c.Get(id)
+	if err != nil {
+		return o, err
+	}
+	if err := o.validate(l, time.Now()); err != nil {
+		return o, err
+	}
+	if o.Source == "" {
+		o.Source = "api"
+	}
+	c.Lock()
+	c.overrideID++
+	o.ID = strconv.Itoa(c.overrideID)
+	c.overrides[id] = append(c.overrides[id], o)
+	light, ok := c.lights[id]
+	c.Unlock()
+	log.Println("lighting subsystem: override", o.ID, "for light:", l.Name, "from:", o.Source, "until:", o.End)
+	if ok && light.Enable {
+		c.syncLight(light)
+	}
+	return o, nil
+}
+
+// Overrides returns the active and fading overrides of a light, oldest first
+func (c *Controller) Overrides(id string) []Override {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	os := []Override{}
+	for _, o := range c.overrides[id] {
+		if !o.expired(now) {
+			os = append(os, o)
+		}
+	}
+	return os
+}
+
+// EndOverride expires an override right away, the light fades back to its profile
+func (c *Controller) EndOverride(id, oid string) error {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	for i, o := range c.overrides[id] {
+		if o.ID == oid && !o.expired(now) {
+			if o.End.After(now) {
+				c.overrides[id][i].End = now
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("Light '%s' has no active override: %s", id, oid)
+}
+
+// ClearOverrides expires all overrides of a light, or only the ones from the
+// given source when it is not empty
+func (c *Controller) ClearOverrides(id, source string) {
+	c.Lock()
+	defer c.Unlock()
+	now := time.Now()
+	for i, o := range c.overrides[id] {
+		if (source == "" || o.Source == source) && o.End.After(now) {
+			c.overrides[id][i].End = now
+		}
+	}
+}
+
+// channelValue returns the value of a channel at t, including acclimation,
+// thermal dimming and overrides. Manual channels are neither acclimated nor
+// dimmed.
+func (c *Controller) channelValue(l *Light, ch *Channel, t time.Time) (float64, error) {
+	v, err := ch.ValueAt(t)
+	if !ch.Manual {
+		v *= l.Acclimation.scale(t)
+	}
+	c.Lock()
+	overrides := append([]Override(nil), c.overrides[l.ID]...)
+	if !ch.Manual {
+		v *= c.thermalScale(l.ID)
+	}
+	c.Unlock()
+	return apply(overrides, ch.Pin, v, t), err
+}
+
+// pruneOverrides drops overrides that have fully faded out
+func (c *Controller) pruneOverrides(id string, t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	var os []Override
+	for _, o := range c.overrides[id] {
+		if !o.expired(t) {
+			os = append(os, o)
+		}
+	}
+	if len(os) == 0 {
+		delete(c.overrides, id)
+		return
+	}
+	c.overrides[id] = os
+}
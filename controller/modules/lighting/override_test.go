@@ -0,0 +1,142 @@
+package lighting
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func TestOverrideStack(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	overrides := []Override{
+		{Value: 20, Start: t0, End: t0.Add(10 * time.Minute), Fade: 60},
+		{Channels: map[int]float64{3: 80}, Start: t0.Add(time.Minute), End: t0.Add(2 * time.Minute)},
+	}
+	for _, c := range []struct {
+		at  time.Duration
+		pin int
+		v   float64
+	}{
+		{-time.Second, 3, 50},
+		{30 * time.Second, 3, 20},
+		{90 * time.Second, 3, 80},
+		{90 * time.Second, 4, 20},
+		{3 * time.Minute, 3, 20},
+		{10*time.Minute + 30*time.Second, 3, 35},
+		{12 * time.Minute, 3, 50},
+	} {
+		if v := apply(overrides, c.pin, 50, t0.Add(c.at)); v != c.v {
+			t.Error("Expected", c.v, "for pin", c.pin, "at", c.at, "found:", v)
+		}
+	}
+}
+
+func TestOverrideAPI(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	if err := con.DM().Drivers().Create(drivers.Driver{Name: "lighting", Type: "pca9685", Config: []byte(`{"address":64, "frequency":1000}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Create(connectors.Jack{Name: "J1", Pins: []int{3, 4}, Driver: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(Config{DevMode: true, Interval: time.Hour}, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	l := Light{Name: "L1", Jack: "1", Enable: true, Channels: map[int]*Channel{
+		3: {Name: "white", On: true, Manual: true, Value: 10},
+		4: {Name: "blue", On: true, Manual: true, Value: 40},
+	}}
+	if err := c.Create(l); err != nil {
+		t.Fatal(err)
+	}
+	light := c.lights["1"]
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(Override{Channels: map[int]float64{3: 30}, Duration: 60, Fade: 1})
+	var o Override
+	if err := tr.Do("POST", "/api/lights/1/overrides", body, &o); err != nil {
+		t.Fatal("Failed to override light using api. Error:", err)
+	}
+	if o.ID == "" || o.Source != "api" || o.End.Sub(o.Start) != time.Minute {
+		t.Error("Unexpected override:", o)
+	}
+	now := time.Now()
+	if v, _ := c.channelValue(light, light.Channels[3], now); v != 30 {
+		t.Error("Expected overridden value 30, found:", v)
+	}
+	if v, _ := c.channelValue(light, light.Channels[4], now); v != 40 {
+		t.Error("Channels without override should follow profile, found:", v)
+	}
+	var got Light
+	if err := tr.Do("GET", "/api/lights/1", strings.NewReader("{}"), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Overrides) != 1 {
+		t.Error("Light state should include active override, found:", got.Overrides)
+	}
+	if err := c.Update("1", got); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := con.Store().RawGet(Bucket, "1"); strings.Contains(string(s), `"source"`) {
+		t.Error("Overrides should not be stored with the light")
+	}
+
+	until := time.Now().Add(time.Hour)
+	if _, err := c.AddOverride("1", Override{Value: 5, Until: until, Source: "macro"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.channelValue(light, light.Channels[3], time.Now()); v != 5 {
+		t.Error("Newer override should take precedence, found:", v)
+	}
+	c.ClearOverrides("1", "macro")
+	if v, _ := c.channelValue(light, light.Channels[3], time.Now()); v != 30 {
+		t.Error("Clearing macro overrides should reveal the override beneath, found:", v)
+	}
+	if err := tr.Do("DELETE", "/api/lights/1/overrides/"+o.ID, strings.NewReader("{}"), nil); err != nil {
+		t.Fatal("Failed to end override using api. Error:", err)
+	}
+	if v, _ := c.channelValue(light, light.Channels[3], time.Now().Add(2*time.Second)); v != 10 {
+		t.Error("Expected light to resume profile after fade, found:", v)
+	}
+	if err := tr.Do("DELETE", "/api/lights/1/overrides", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to clear overrides using api. Error:", err)
+	}
+	if err := tr.Do("GET", "/api/lights/1/overrides", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to list overrides using api. Error:", err)
+	}
+	for _, bad := range []Override{
+		{Value: 110, Duration: 10},
+		{Value: 10},
+		{Value: 10, Duration: 10, Until: until},
+		{Value: 10, Until: time.Now().Add(-time.Hour)},
+		{Channels: map[int]float64{9: 10}, Duration: 10},
+		{Value: 10, Duration: 10, Fade: -1},
+	} {
+		if _, err := c.AddOverride("1", bad); err == nil {
+			t.Error("Expected invalid override to fail:", bad)
+		}
+	}
+	if _, err := c.AddOverride("2", Override{Value: 10, Duration: 10}); err == nil {
+		t.Error("Overriding non existent light should fail")
+	}
+}
@@ -0,0 +1,66 @@
+package lighting
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultPreviewStep = 10 * time.Minute
+	_minPreviewStep    = 10 * time.Second
+)
+
+// ChannelSeries holds the values of a channel at every preview sample
+type ChannelSeries struct {
+	Name   string    `json:"name"`
+	Color  string    `json:"color"`
+	Values []float64 `json:"values"`
+}
+
+// Preview is the simulated output of a light over a day, with the output cap
+// applied but without temporary overrides
+type Preview struct {
+	Date     string                `json:"date"`
+	Step     string                `json:"step"`
+	Times    []time.Time           `json:"times"`
+	Output   []float64             `json:"output"`
+	Channels map[int]ChannelSeries `json:"channels"`
+}
+
+// Preview evaluates the profiles of a light every step over the day t falls in
+func (c *Controller) Preview(id string, t time.Time, step time.Duration) (Preview, error) {
+	p := Preview{
+		Date:     t.Format(_dateFormat),
+		Step:     step.String(),
+		Channels: make(map[int]ChannelSeries),
+	}
+	if step < _minPreviewStep {
+		return p, fmt.Errorf("Preview step should be at least %s. Supplied: %s", _minPreviewStep, step)
+	}
+	l, err := c.Get(id)
+	if err != nil {
+		return p, err
+	}
+	// profiles are loaded afresh, stateful profiles of the running light are not disturbed
+	if err := c.validate(&l); err != nil {
+		return p, err
+	}
+	for pin, ch := range l.Channels {
+		p.Channels[pin] = ChannelSeries{Name: ch.Name, Color: ch.Color}
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	for s := midnight; s.Before(midnight.Add(24 * time.Hour)); s = s.Add(step) {
+		values, _, err := l.values(s)
+		if err != nil {
+			return p, err
+		}
+		p.Times = append(p.Times, s)
+		p.Output = append(p.Output, l.output(values))
+		for pin, v := range values {
+			cs := p.Channels[pin]
+			cs.Values = append(cs.Values, v)
+			p.Channels[pin] = cs
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,84 @@
+package lighting
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func TestPreviewAPI(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	if err := con.DM().Drivers().Create(drivers.Driver{Name: "lighting", Type: "pca9685", Config: []byte(`{"address":64, "frequency":1000}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Create(connectors.Jack{Name: "J1", Pins: []int{3, 4}, Driver: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(Config{DevMode: true, Interval: time.Hour}, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+	l := Light{Name: "L1", Jack: "1", Channels: map[int]*Channel{
+		3: {Name: "white", On: true, ProfileSpec: pwm_profile.ProfileSpec{
+			Type:   "diurnal",
+			Config: []byte(`{"start":"08:00:00","end":"20:00:00"}`),
+		}},
+		4: {Name: "blue", On: true, Manual: true, Value: 30},
+	}}
+	if err := c.Create(l); err != nil {
+		t.Fatal(err)
+	}
+	var p Preview
+	if err := tr.Do("GET", "/api/lights/1/preview?date=2024-03-01&step=1h", strings.NewReader("{}"), &p); err != nil {
+		t.Fatal("Failed to preview light using api. Error:", err)
+	}
+	if len(p.Times) != 24 || len(p.Output) != 24 || len(p.Channels[3].Values) != 24 {
+		t.Fatal("Expected 24 hourly samples, found:", len(p.Times))
+	}
+	if p.Times[14].Hour() != 14 || p.Date != "2024-03-01" {
+		t.Error("Unexpected sample time:", p.Times[14])
+	}
+	white := p.Channels[3].Values
+	if white[2] != 0 || white[14] <= 0 {
+		t.Error("Expected diurnal profile to be dark at night and lit in the afternoon, found:", white)
+	}
+	if p.Channels[4].Values[2] != 30 {
+		t.Error("Expected manual channel value 30, found:", p.Channels[4].Values[2])
+	}
+	if err := tr.Do("GET", "/api/lights/1/preview?step=1s", strings.NewReader("{}"), &p); err == nil {
+		t.Error("Too small step should fail")
+	}
+
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(pwm_profile.ProfileSpec{
+		Type:   "composite",
+		Config: []byte(`{"profiles":[{"type":"diurnal","span":86400},{"type":"fixed","span":3600,"config":{"value":10}}]}`),
+	})
+	var d pwm_profile.Diagnostics
+	if err := tr.Do("POST", "/api/lights/profiles/validate", body, &d); err != nil {
+		t.Fatal("Failed to validate profile using api. Error:", err)
+	}
+	if d.Valid || len(d.Errors) == 0 {
+		t.Error("Overlapping composite spans should be reported, found:", d)
+	}
+}
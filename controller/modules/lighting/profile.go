@@ -0,0 +1,248 @@
+package lighting
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const ProfileBucket = storage.LightingProfileBucket
+
+// StoredProfile is a named profile that can be shared across channels. Channels
+// refer to it by id, its min and max are overridden by the channel's.
+type StoredProfile struct {
+	ID string `json:"id"`
+	pwm_profile.ProfileSpec
+}
+
+func (p StoredProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("Profile name can not be empty")
+	}
+	spec := p.ProfileSpec
+	spec.Min = 0
+	spec.Max = 100
+	if err := spec.Validate(); err != nil {
+		return fmt.Errorf("invalid profile. Error: %w", err)
+	}
+	if _, err := spec.CreateProfile(); err != nil {
+		return fmt.Errorf("invalid profile. Error: %w", err)
+	}
+	return nil
+}
+
+func (c *Controller) GetProfile(id string) (StoredProfile, error) {
+	var p StoredProfile
+	return p, c.c.Store().Get(ProfileBucket, id, &p)
+}
+
+func (c *Controller) ListProfiles() ([]StoredProfile, error) {
+	ps := []StoredProfile{}
+	fn := func(_ string, v []byte) error {
+		var p StoredProfile
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		ps = append(ps, p)
+		return nil
+	}
+	return ps, c.c.Store().List(ProfileBucket, fn)
+}
+
+func (c *Controller) CreateProfile(p StoredProfile) error {
+	return c.insertProfile(&p)
+}
+
+func (c *Controller) insertProfile(p *StoredProfile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if err := c.checkProfileName("", p.Name); err != nil {
+		return err
+	}
+	fn := func(id string) interface{} {
+		p.ID = id
+		return p
+	}
+	return c.c.Store().Create(ProfileBucket, fn)
+}
+
+// UpdateProfile saves the profile and reloads every light referring to it.
+// Nothing is saved when one of these lights rejects the new profile.
+func (c *Controller) UpdateProfile(id string, p StoredProfile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	old, err := c.GetProfile(id)
+	if err != nil {
+		return err
+	}
+	if err := c.checkProfileName(id, p.Name); err != nil {
+		return err
+	}
+	p.ID = id
+	if err := c.checkProfileUsers(p); err != nil {
+		return err
+	}
+	if err := c.c.Store().Update(ProfileBucket, id, p); err != nil {
+		return err
+	}
+	if err := c.propagateProfile(id); err != nil {
+		// lights already reloaded go back to the previous profile
+		if err := c.c.Store().Update(ProfileBucket, id, old); err != nil {
+			log.Println("ERROR: lighting subsystem: Failed to restore profile:", old.Name, "Error:", err)
+		} else if err := c.propagateProfile(id); err != nil {
+			log.Println("ERROR: lighting subsystem: Failed to reload lights with restored profile:", old.Name, "Error:", err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Controller) DeleteProfile(id string) error {
+	deps, err := c.InUse(ProfileBucket, id)
+	if err != nil {
+		return err
+	}
+	if len(deps) > 0 {
+		return fmt.Errorf("Profile is in use by: %s", strings.Join(deps, ", "))
+	}
+	return c.c.Store().Delete(ProfileBucket, id)
+}
+
+// ImportProfiles creates the supplied profiles, replacing the existing
+// profiles with the same name. Nothing is saved unless all profiles are valid,
+// and profiles already saved are rolled back when a later one fails.
+func (c *Controller) ImportProfiles(ps []StoredProfile) error {
+	names := make(map[string]bool)
+	for _, p := range ps {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("profile '%s': %w", p.Name, err)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("Duplicate profile name: %s", p.Name)
+		}
+		names[p.Name] = true
+	}
+	existing, err := c.ListProfiles()
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]StoredProfile)
+	for _, p := range existing {
+		previous[p.Name] = p
+	}
+	var created []string
+	var updated []StoredProfile
+	// undo the changes of an import that failed half way
+	rollback := func(err error) error {
+		for _, id := range created {
+			if err := c.c.Store().Delete(ProfileBucket, id); err != nil {
+				log.Println("ERROR: lighting subsystem: Failed to roll back imported profile:", id, "Error:", err)
+			}
+		}
+		for _, p := range updated {
+			if err := c.UpdateProfile(p.ID, p); err != nil {
+				log.Println("ERROR: lighting subsystem: Failed to restore profile:", p.Name, "Error:", err)
+			}
+		}
+		return err
+	}
+	for _, p := range ps {
+		if old, ok := previous[p.Name]; ok {
+			if err := c.UpdateProfile(old.ID, p); err != nil {
+				return rollback(err)
+			}
+			updated = append(updated, old)
+			continue
+		}
+		if err := c.insertProfile(&p); err != nil {
+			return rollback(err)
+		}
+		created = append(created, p.ID)
+	}
+	return nil
+}
+
+func (c *Controller) checkProfileName(id, name string) error {
+	ps, err := c.ListProfiles()
+	if err != nil {
+		return err
+	}
+	for _, p := range ps {
+		if p.Name == name && p.ID != id {
+			return fmt.Errorf("Profile with name '%s' already exists", name)
+		}
+	}
+	return nil
+}
+
+// checkProfileUsers validates every light referring to the profile as if it
+// was saved already
+func (c *Controller) checkProfileUsers(p StoredProfile) error {
+	lights, err := c.List()
+	if err != nil {
+		return err
+	}
+	for _, l := range lights {
+		if !l.usesProfile(p.ID) {
+			continue
+		}
+		if err := c.validate(&l, p); err != nil {
+			return fmt.Errorf("Profile is rejected by light '%s'. Error: %w", l.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) propagateProfile(id string) error {
+	lights, err := c.List()
+	if err != nil {
+		return err
+	}
+	for _, l := range lights {
+		if !l.usesProfile(id) {
+			continue
+		}
+		log.Println("lighting subsystem: reloading light:", l.Name, "after profile update:", id)
+		if err := c.Update(l.ID, l); err != nil {
+			return fmt.Errorf("Failed to update light '%s'. Error: %w", l.Name, err)
+		}
+	}
+	return nil
+}
+
+func (l Light) usesProfile(id string) bool {
+	for _, ch := range l.Channels {
+		if ch.ProfileID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveProfiles copies the stored profiles referred by the channels of a
+// light, pending profiles are used in place of the stored ones with their id
+func (c *Controller) resolveProfiles(l *Light, pending ...StoredProfile) error {
+	for _, ch := range l.Channels {
+		if ch.ProfileID == "" {
+			continue
+		}
+		p, err := c.GetProfile(ch.ProfileID)
+		for _, pp := range pending {
+			if pp.ID == ch.ProfileID {
+				p, err = pp, nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("Non existent profile: '%s' for channel: %s. Error: %s", ch.ProfileID, ch.Name, err)
+		}
+		ch.ProfileSpec = p.ProfileSpec
+		ch.profile = nil
+	}
+	return nil
+}
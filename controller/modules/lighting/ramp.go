@@ -0,0 +1,217 @@
+package lighting
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/connectors"
+)
+
+const DefaultRampStep = 250 * time.Millisecond
+
+// FadeConfig controls how a light moves between computed values. With
+// Interpolate set, each new value is reached gradually over the sync interval
+// instead of at once. MaxRate caps the change per second (0 disables it) and
+// OnOff is the fade duration in seconds when a channel is switched on or off.
+type FadeConfig struct {
+	Interpolate bool          `json:"interpolate"`
+	MaxRate     float64       `json:"max_rate"`
+	OnOff       time.Duration `json:"on_off"`
+}
+
+func (f FadeConfig) Validate() error {
+	if f.MaxRate < 0 {
+		return fmt.Errorf("Maximum rate of change can not be negative. Supplied: %f", f.MaxRate)
+	}
+	if f.OnOff < 0 {
+		return fmt.Errorf("On/off fade duration can not be negative. Supplied: %d", f.OnOff)
+	}
+	return nil
+}
+
+func (f FadeConfig) enabled() bool {
+	return f.Interpolate || f.MaxRate > 0 || f.OnOff > 0
+}
+
+type rampTarget struct {
+	value   float64
+	on      bool
+	instant bool
+}
+
+type rampUpdate struct {
+	fade     FadeConfig
+	interval time.Duration
+	targets  map[int]rampTarget
+}
+
+type rampPin struct {
+	from, to float64
+	start    time.Time
+	duration time.Duration
+}
+
+// ramp owns the PWM writes of a jack, moving each pin towards its target in
+// small steps so that lights on other jacks are never blocked by a fade
+type ramp struct {
+	jack    string
+	step    time.Duration
+	updates chan rampUpdate
+	quit    chan struct{}
+	current map[int]float64
+	on      map[int]bool
+	pins    map[int]*rampPin
+	write   func(string, connectors.PinValues) error
+}
+
+func newRamp(jack string, step time.Duration, write func(string, connectors.PinValues) error) *ramp {
+	return &ramp{
+		jack:    jack,
+		step:    step,
+		updates: make(chan rampUpdate, 1),
+		quit:    make(chan struct{}),
+		current: make(map[int]float64),
+		on:      make(map[int]bool),
+		pins:    make(map[int]*rampPin),
+		write:   write,
+	}
+}
+
+// duration returns how long moving a pin from one value to another should take
+func (u rampUpdate) duration(from, to float64, toggled bool) time.Duration {
+	var d time.Duration
+	if u.fade.Interpolate {
+		d = u.interval
+	}
+	if toggled && u.fade.OnOff > 0 {
+		d = u.fade.OnOff * time.Second
+	}
+	if u.fade.MaxRate > 0 {
+		min := time.Duration(math.Abs(to-from) / u.fade.MaxRate * float64(time.Second))
+		if min > d {
+			d = min
+		}
+	}
+	return d
+}
+
+func (r *ramp) set(u rampUpdate, now time.Time) {
+	immediate := make(connectors.PinValues)
+	for pin, t := range u.targets {
+		from, known := r.current[pin]
+		toggled := known && r.on[pin] != t.on
+		r.on[pin] = t.on
+		d := u.duration(from, t.value, toggled)
+		if !known || t.instant || d <= 0 || from == t.value {
+			delete(r.pins, pin)
+			immediate[pin] = t.value
+			continue
+		}
+		r.pins[pin] = &rampPin{from: from, to: t.value, start: now, duration: d}
+	}
+	if len(immediate) > 0 {
+		r.apply(immediate)
+	}
+}
+
+func (r *ramp) advance(now time.Time) {
+	if len(r.pins) == 0 {
+		return
+	}
+	values := make(connectors.PinValues)
+	for pin, p := range r.pins {
+		progress := now.Sub(p.start).Seconds() / p.duration.Seconds()
+		if progress >= 1 {
+			values[pin] = p.to
+			delete(r.pins, pin)
+			continue
+		}
+		values[pin] = p.from + (p.to-p.from)*progress
+	}
+	r.apply(values)
+}
+
+func (r *ramp) apply(values connectors.PinValues) {
+	if err := r.write(r.jack, values); err != nil {
+		log.Println("ERROR: lighting-subsystem: Failed to set pwm value on jack:", r.jack, "Error:", err)
+		return
+	}
+	for pin, v := range values {
+		r.current[pin] = v
+	}
+}
+
+func (r *ramp) run() {
+	ticker := time.NewTicker(r.step)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case u := <-r.updates:
+			r.set(u, time.Now())
+		case <-ticker.C:
+			r.advance(time.Now())
+		}
+	}
+}
+
+// send queues new targets, replacing a pending update that was not picked up yet
+func (r *ramp) send(u rampUpdate) {
+	for {
+		select {
+		case r.updates <- u:
+			return
+		default:
+		}
+		select {
+		case <-r.updates:
+		default:
+		}
+	}
+}
+
+func (c *Controller) rampFor(jack string) *ramp {
+	c.Lock()
+	defer c.Unlock()
+	r, ok := c.ramps[jack]
+	if !ok {
+		r = newRamp(jack, c.rampStep, c.jacks.Control)
+		c.ramps[jack] = r
+		go r.run()
+	}
+	return r
+}
+
+func (c *Controller) activeRamp(jack string) (*ramp, bool) {
+	c.Lock()
+	defer c.Unlock()
+	r, ok := c.ramps[jack]
+	return r, ok
+}
+
+// releaseRamp stops the ramp of a jack that is no longer driven by any light
+func (c *Controller) releaseRamp(jack string) {
+	c.Lock()
+	defer c.Unlock()
+	for _, l := range c.lights {
+		if l.Jack == jack {
+			return
+		}
+	}
+	if r, ok := c.ramps[jack]; ok {
+		close(r.quit)
+		delete(c.ramps, jack)
+	}
+}
+
+func (c *Controller) stopRamps() {
+	c.Lock()
+	defer c.Unlock()
+	for jack, r := range c.ramps {
+		close(r.quit)
+		delete(c.ramps, jack)
+	}
+}
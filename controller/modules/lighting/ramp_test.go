@@ -0,0 +1,187 @@
+package lighting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
+)
+
+func TestRamp(t *testing.T) {
+	written := make(connectors.PinValues)
+	write := func(_ string, pv connectors.PinValues) error {
+		for pin, v := range pv {
+			written[pin] = v
+		}
+		return nil
+	}
+	r := newRamp("1", time.Second, write)
+	t0 := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	update := func(fade FadeConfig, pin int, v float64, on bool) rampUpdate {
+		return rampUpdate{
+			fade:     fade,
+			interval: 10 * time.Second,
+			targets:  map[int]rampTarget{pin: {value: v, on: on}},
+		}
+	}
+	check := func(pin int, v float64) {
+		t.Helper()
+		if written[pin] != v {
+			t.Error("Expected value", v, "for pin", pin, "found:", written[pin])
+		}
+	}
+
+	// the first value is set right away, there is nothing to fade from
+	r.set(update(FadeConfig{Interpolate: true}, 1, 20, true), t0)
+	check(1, 20)
+
+	r.set(update(FadeConfig{Interpolate: true}, 1, 40, true), t0)
+	check(1, 20)
+	r.advance(t0.Add(5 * time.Second))
+	check(1, 30)
+	r.advance(t0.Add(10 * time.Second))
+	check(1, 40)
+	if len(r.pins) != 0 {
+		t.Error("Ramp should be complete")
+	}
+
+	// rate limit stretches the ramp beyond the interval
+	r.set(update(FadeConfig{Interpolate: true, MaxRate: 1}, 1, 60, true), t0)
+	r.advance(t0.Add(10 * time.Second))
+	check(1, 50)
+	// a new target picks up from where the previous ramp is
+	r.set(update(FadeConfig{MaxRate: 5}, 1, 0, true), t0.Add(10*time.Second))
+	r.advance(t0.Add(12 * time.Second))
+	check(1, 40)
+	r.advance(t0.Add(20 * time.Second))
+	check(1, 0)
+
+	// switching off fades over the on/off duration
+	r.set(update(FadeConfig{}, 1, 80, true), t0)
+	check(1, 80)
+	r.set(update(FadeConfig{OnOff: 20}, 1, 0, false), t0)
+	r.advance(t0.Add(5 * time.Second))
+	check(1, 60)
+	r.advance(t0.Add(20 * time.Second))
+	check(1, 0)
+
+	// pins without fade settings are set immediately and stop ramping
+	r.set(update(FadeConfig{Interpolate: true}, 1, 50, false), t0)
+	r.set(update(FadeConfig{}, 1, 10, false), t0)
+	check(1, 10)
+	r.advance(t0.Add(5 * time.Second))
+	check(1, 10)
+
+	// lightning flashes are never faded
+	r.set(update(FadeConfig{Interpolate: true}, 1, 20, true), t0)
+	u := update(FadeConfig{Interpolate: true}, 1, 100, true)
+	u.targets[1] = rampTarget{value: 100, on: true, instant: true}
+	r.set(u, t0)
+	check(1, 100)
+
+	if err := (FadeConfig{MaxRate: -1}).Validate(); err == nil {
+		t.Error("Negative rate should fail validation")
+	}
+	if err := (FadeConfig{OnOff: -1}).Validate(); err == nil {
+		t.Error("Negative on/off duration should fail validation")
+	}
+}
+
+func TestLightningSync(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	c, err := New(DefaultConfig, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := `{"seed":3,"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00","value":50}},` +
+		`"lightning":{"probability":1,"start":"21:00:00","end":"22:00:00","frequency":2}}`
+	ch := &Channel{Name: "white", On: true, Max: 100, Pin: 1, ProfileSpec: pwm_profile.ProfileSpec{Type: "weather", Config: []byte(conf)}}
+	l := &Light{ID: "1", Name: "storm", Channels: map[int]*Channel{1: ch}}
+	l.LoadChannels()
+	wp := ch.profile.(pwm_profile.WeatherProfile)
+
+	// syncs at the default interval, not aligned with the storm start
+	from := time.Date(2024, 3, 1, 21, 0, 7, 0, time.Local)
+	to := from.Add(time.Hour)
+	synced := make(map[time.Time]bool)
+	for s := from; s.Before(to); s = s.Add(c.config.Interval) {
+		v, err := c.channelValue(l, ch, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wp.Flashing(s) {
+			if v != 100 {
+				t.Error("Flash should drive the channel to max, found:", v, "at", s)
+			}
+			if !ch.flashing(s, c.config.Interval) {
+				t.Error("Flash should bypass fading at", s)
+			}
+			synced[s] = true
+		}
+	}
+	flashes, seen := 0, 0
+	for s := from; s.Before(to); s = s.Add(time.Second) {
+		if !wp.Flashing(s) || wp.Flashing(s.Add(-time.Second)) {
+			continue
+		}
+		flashes++
+		for k, ok := range synced {
+			if ok && !k.Before(s) && k.Sub(s) < c.config.Interval {
+				seen++
+				break
+			}
+		}
+	}
+	if flashes == 0 {
+		t.Fatal("Expected lightning flashes during the storm")
+	}
+	if seen != flashes {
+		t.Error("Every flash should be seen by a sync, seen:", seen, "of", flashes)
+	}
+}
+
+func TestReleaseRamp(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	c, err := New(DefaultConfig, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []Light{{ID: "1", Name: "a", Jack: "1"}, {ID: "2", Name: "b", Jack: "1"}} {
+		if err := con.Store().Update(Bucket, l.ID, l); err != nil {
+			t.Fatal(err)
+		}
+		l := l
+		c.lights[l.ID] = &l
+	}
+	r := c.rampFor("1")
+	if err := c.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.activeRamp("1"); !ok {
+		t.Error("Ramp of a jack still used by another light should keep running")
+	}
+	if err := c.Delete("2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.activeRamp("1"); ok {
+		t.Error("Ramp of an unused jack should be removed")
+	}
+	select {
+	case <-r.quit:
+	default:
+		t.Error("Ramp of an unused jack should be stopped")
+	}
+}
@@ -0,0 +1,137 @@
+package lighting
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/modules/temperature"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+// Thermal dims a light when the tank runs hot. Above Threshold (in the unit of
+// the temperature controller) all channels are scaled down linearly, reaching
+// Floor percent of their value Range degrees above the threshold. Temporary
+// overrides and manual channels are not dimmed.
+type Thermal struct {
+	TC        string  `json:"tc"`
+	Threshold float64 `json:"threshold"`
+	Range     float64 `json:"range"`
+	Floor     float64 `json:"floor"`
+}
+
+func (t Thermal) Validate() error {
+	if t.TC == "" {
+		return nil
+	}
+	if t.Range <= 0 {
+		return fmt.Errorf("Thermal dimming range should be positive. Supplied: %f", t.Range)
+	}
+	if t.Floor < 0 || t.Floor > 100 {
+		return fmt.Errorf("Thermal dimming floor should be between 0 and 100. Supplied: %f", t.Floor)
+	}
+	return nil
+}
+
+// scale returns the factor, between Floor/100 and 1, channel values are
+// multiplied with at the given temperature
+func (t Thermal) scale(reading float64) float64 {
+	if reading <= t.Threshold {
+		return 1
+	}
+	progress := (reading - t.Threshold) / t.Range
+	if progress > 1 {
+		progress = 1
+	}
+	return 1 - progress*(1-t.Floor/100)
+}
+
+// readings older than this many periods of the temperature controller are
+// ignored
+const _thermalMaxAge = 3
+
+var errStaleReading = errors.New("temperature reading is too old")
+
+func (c *Controller) temperature(id string) (float64, error) {
+	sub, err := c.c.Subsystem(storage.TemperatureBucket)
+	if err != nil {
+		return 0, err
+	}
+	tc, ok := sub.(*temperature.Controller)
+	if !ok {
+		return 0, errors.New("Failed to cast temperature subsystem to temperature controller")
+	}
+	t, err := tc.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	v, at, err := tc.CurrentReading(id)
+	if err != nil {
+		return 0, err
+	}
+	if time.Since(at) > _thermalMaxAge*t.Period*time.Second {
+		return 0, fmt.Errorf("%w, last read at %s", errStaleReading, at.Format(time.RFC1123))
+	}
+	return v, nil
+}
+
+// updateThermal recomputes the thermal scale of a light from the latest
+// temperature reading, alerting when dimming starts and ends. The previous
+// scale is kept, with an alert, while the temperature can not be read or the
+// reading is too old to be trusted.
+func (c *Controller) updateThermal(l *Light) {
+	if l.Thermal.TC == "" {
+		c.Lock()
+		delete(c.thermal, l.ID)
+		delete(c.thermalLost, l.ID)
+		c.Unlock()
+		return
+	}
+	reading, err := c.temperature(l.Thermal.TC)
+	if err != nil {
+		log.Println("ERROR: lighting subsystem. Failed to read temperature for light:", l.Name, "Error:", err)
+		c.Lock()
+		raise := !c.thermalLost[l.ID]
+		c.thermalLost[l.ID] = true
+		scale := c.thermalScale(l.ID)
+		c.Unlock()
+		if raise {
+			msg := fmt.Sprintf("Temperature of light '%s' is unavailable, keeping it at %.0f%%. Error: %s", l.Name, scale*100, err)
+			c.c.LogError("light-thermal-"+l.ID, msg)
+			c.c.Telemetry().Alert(fmt.Sprintf("[Reef-Pi ALERT] temperature of light '%s' unavailable", l.Name), msg)
+		}
+		return
+	}
+	scale := l.Thermal.scale(reading)
+	c.Lock()
+	delete(c.thermalLost, l.ID)
+	_, dimmed := c.thermal[l.ID]
+	if scale < 1 {
+		c.thermal[l.ID] = scale
+	} else {
+		delete(c.thermal, l.ID)
+	}
+	c.Unlock()
+	switch {
+	case scale < 1 && !dimmed:
+		msg := fmt.Sprintf("Temperature (%f) is above %f, dimming light '%s' to %.0f%%", reading, l.Thermal.Threshold, l.Name, scale*100)
+		log.Println("lighting subsystem:", msg)
+		c.c.LogError("light-thermal-"+l.ID, msg)
+		c.c.Telemetry().Alert(fmt.Sprintf("[Reef-Pi ALERT] light '%s' dimmed", l.Name), msg)
+	case scale < 1:
+		log.Println("lighting subsystem: Temperature:", reading, "light:", l.Name, "dimmed to", scale*100, "%")
+	case dimmed:
+		msg := fmt.Sprintf("Temperature (%f) is back below %f, light '%s' restored", reading, l.Thermal.Threshold, l.Name)
+		log.Println("lighting subsystem:", msg)
+		c.c.Telemetry().Alert(fmt.Sprintf("[Reef-Pi ALERT] light '%s' restored", l.Name), msg)
+	}
+}
+
+// thermalScale returns the current thermal scale of a light, callers must hold the lock
+func (c *Controller) thermalScale(id string) float64 {
+	if s, ok := c.thermal[id]; ok {
+		return s
+	}
+	return 1
+}
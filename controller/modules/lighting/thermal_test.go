@@ -0,0 +1,143 @@
+package lighting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/drivers"
+	"github.com/reef-pi/reef-pi/controller/modules/temperature"
+	"github.com/reef-pi/reef-pi/controller/pwm_profile"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+type testController struct {
+	controller.Controller
+	temperature *temperature.Controller
+	errors      []string
+}
+
+func (t *testController) LogError(id, msg string) error {
+	t.errors = append(t.errors, id)
+	return t.Controller.LogError(id, msg)
+}
+
+func (t *testController) Subsystem(name string) (controller.Subsystem, error) {
+	if name == storage.TemperatureBucket {
+		return t.temperature, nil
+	}
+	return t.Controller.Subsystem(name)
+}
+
+func TestThermalScale(t *testing.T) {
+	th := Thermal{TC: "1", Threshold: 28, Range: 2, Floor: 40}
+	for _, c := range []struct {
+		reading, scale float64
+	}{
+		{25, 1},
+		{28, 1},
+		{29, 0.7},
+		{30, 0.4},
+		{35, 0.4},
+	} {
+		if s := th.scale(c.reading); s != c.scale {
+			t.Error("Expected scale", c.scale, "at", c.reading, "found:", s)
+		}
+	}
+	if err := (Thermal{TC: "1"}).Validate(); err == nil {
+		t.Error("Thermal dimming without range should fail validation")
+	}
+	if err := (Thermal{}).Validate(); err != nil {
+		t.Error("Thermal dimming should be optional. Error:", err)
+	}
+}
+
+func TestThermalDimming(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	tc, err := temperature.New(true, con)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.Create(temperature.TC{Name: "tank", Period: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := tc.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor.Enable = true
+	// dev mode readings are between 24.4 and 25.9
+	tc.Check(sensor)
+
+	if err := con.DM().Drivers().Create(drivers.Driver{Name: "lighting", Type: "pca9685", Config: []byte(`{"address":64, "frequency":1000}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Jacks().Create(connectors.Jack{Name: "J1", Pins: []int{3, 4}, Driver: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	tcon := &testController{Controller: con, temperature: tc}
+	c, err := New(Config{DevMode: true, Interval: time.Hour}, tcon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	l := Light{Name: "L1", Jack: "1", Enable: true,
+		Thermal: Thermal{TC: "1", Threshold: 20, Range: 10},
+		Channels: map[int]*Channel{
+			3: {Name: "white", On: true, Max: 100, ProfileSpec: pwm_profile.ProfileSpec{Type: "fixed", Config: []byte(`{"start":"00:00:00","end":"23:59:59","value":100}`)}},
+			4: {Name: "blue", On: true, Manual: true, Value: 100},
+		}}
+	if err := c.Create(l); err != nil {
+		t.Fatal(err)
+	}
+	light := c.lights["1"]
+	c.syncLight(light)
+	v, _ := c.channelValue(light, light.Channels[3], time.Now())
+	if v < 40 || v > 57 {
+		t.Error("Expected light to be dimmed to 40-57%, found:", v)
+	}
+	if v, _ := c.channelValue(light, light.Channels[4], time.Now()); v != 100 {
+		t.Error("Manual channels should not be dimmed, found:", v)
+	}
+	if deps, _ := c.InUse(storage.TemperatureBucket, "1"); len(deps) != 1 {
+		t.Error("Light should be reported as using the temperature controller")
+	}
+	if _, err := c.AddOverride("1", Override{Channels: map[int]float64{4: 80}, Duration: 60}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.channelValue(light, light.Channels[4], time.Now()); v != 80 {
+		t.Error("Overrides should not be dimmed, found:", v)
+	}
+
+	// sensor lost while the tank is hot
+	light.Thermal.TC = "2"
+	tcon.errors = nil
+	c.syncLight(light)
+	c.syncLight(light)
+	if v, _ := c.channelValue(light, light.Channels[3], time.Now()); v < 40 || v > 57 {
+		t.Error("Light should stay dimmed while the temperature is unavailable, found:", v)
+	}
+	if len(tcon.errors) != 1 {
+		t.Error("Unavailable temperature should be reported once, found:", tcon.errors)
+	}
+
+	light.Thermal.TC = "1"
+	light.Thermal.Threshold = 30
+	c.syncLight(light)
+	if v, _ := c.channelValue(light, light.Channels[3], time.Now()); v != 100 {
+		t.Error("Expected light to be restored as temperature is below threshold, found:", v)
+	}
+}
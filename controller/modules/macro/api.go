@@ -12,6 +12,11 @@ import (
 func (t *Subsystem) LoadAPI(r *mux.Router) {
 	r.HandleFunc("/api/macros", t.list).Methods("GET")
 	r.HandleFunc("/api/macros/scheduled", t.scheduledlist).Methods("GET")
+	r.HandleFunc("/api/macros/runs", t.listRuns).Methods("GET")
+	r.HandleFunc("/api/macros/runs/{id}", t.getRun).Methods("GET")
+	r.HandleFunc("/api/macros/runs/{id}/cancel", t.cancel).Methods("POST")
+	r.HandleFunc("/api/macros/runs/{id}/pause", t.pause).Methods("POST")
+	r.HandleFunc("/api/macros/runs/{id}/resume", t.resume).Methods("POST")
 	r.HandleFunc("/api/macros", t.create).Methods("PUT")
 	r.HandleFunc("/api/macros/{id}", t.get).Methods("GET")
 	r.HandleFunc("/api/macros/{id}", t.update).Methods("POST")
@@ -89,3 +94,38 @@ func (c *Subsystem) revert(w http.ResponseWriter, r *http.Request) {
 	}
 	utils.JSONDeleteResponse(fn, w, r)
 }
+
+func (c *Subsystem) listRuns(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.Runs()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Subsystem) getRun(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.GetRun(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Subsystem) cancel(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Cancel(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Subsystem) pause(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Pause(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Subsystem) resume(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Resume(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
@@ -0,0 +1,167 @@
+package macro
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/modules/flow"
+	"github.com/reef-pi/reef-pi/controller/modules/ph"
+	"github.com/reef-pi/reef-pi/controller/modules/temperature"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const (
+	ContinueOnTimeout = "continue"
+	AbortOnTimeout    = "abort"
+)
+
+// ErrAborted is returned by a step when the macro should not proceed further
+var ErrAborted = errors.New("macro aborted")
+
+// Condition compares the current value of a sensor against a threshold. Type
+// is the bucket of the sensor: inlets, analog_inputs, phprobes, temperature or flow.
+type Condition struct {
+	Type     string  `json:"type"`
+	ID       string  `json:"id"`
+	Operator string  `json:"operator"`
+	Value    float64 `json:"value"`
+}
+
+func (cond Condition) Validate() error {
+	switch cond.Type {
+	case storage.InletBucket, storage.AnalogInputBucket, storage.PhBucket, storage.TemperatureBucket, storage.FlowBucket:
+	default:
+		return fmt.Errorf("Unknown sensor type:%s", cond.Type)
+	}
+	if cond.ID == "" {
+		return fmt.Errorf("Missing sensor id")
+	}
+	switch cond.Operator {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("Unknown operator:%s", cond.Operator)
+	}
+	return nil
+}
+
+func (cond Condition) Evaluate(c controller.Controller) (bool, error) {
+	v, err := readSensor(c, cond.Type, cond.ID)
+	if err != nil {
+		return false, err
+	}
+	log.Println("macro-subsystem: evaluating condition. Sensor:", cond.Type, cond.ID, "value:", v, cond.Operator, cond.Value)
+	switch cond.Operator {
+	case ">":
+		return v > cond.Value, nil
+	case ">=":
+		return v >= cond.Value, nil
+	case "<":
+		return v < cond.Value, nil
+	case "<=":
+		return v <= cond.Value, nil
+	case "==":
+		return v == cond.Value, nil
+	case "!=":
+		return v != cond.Value, nil
+	default:
+		return false, fmt.Errorf("Unknown operator:%s", cond.Operator)
+	}
+}
+
+func readSensor(c controller.Controller, t, id string) (float64, error) {
+	switch t {
+	case storage.InletBucket:
+		v, err := c.DM().Inlets().Read(id)
+		return float64(v), err
+	case storage.AnalogInputBucket:
+		return c.DM().AnalogInputs().Read(id)
+	case storage.PhBucket:
+		sub, err := c.Subsystem(storage.PhBucket)
+		if err != nil {
+			return 0, err
+		}
+		pc, ok := sub.(*ph.Controller)
+		if !ok {
+			return 0, errors.New("Failed to cast ph subsystem to ph controller")
+		}
+		p, err := pc.Get(id)
+		if err != nil {
+			return 0, err
+		}
+		return pc.CalibratedRead(p)
+	case storage.TemperatureBucket:
+		sub, err := c.Subsystem(storage.TemperatureBucket)
+		if err != nil {
+			return 0, err
+		}
+		tc, ok := sub.(*temperature.Controller)
+		if !ok {
+			return 0, errors.New("Failed to cast temperature subsystem to temperature controller")
+		}
+		sensor, err := tc.Get(id)
+		if err != nil {
+			return 0, err
+		}
+		return tc.CalibratedRead(sensor)
+	case storage.FlowBucket:
+		sub, err := c.Subsystem(storage.FlowBucket)
+		if err != nil {
+			return 0, err
+		}
+		fc, ok := sub.(*flow.Controller)
+		if !ok {
+			return 0, errors.New("Failed to cast flow subsystem to flow controller")
+		}
+		f, err := fc.Get(id)
+		if err != nil {
+			return 0, err
+		}
+		f.Lock()
+		defer f.Unlock()
+		return f.FlowRate, nil
+	default:
+		return 0, fmt.Errorf("Unknown sensor type:%s", t)
+	}
+}
+
+// waitFor polls fn every frequency seconds until it returns true. Read errors
+// are logged and polling continues. If timeout (in seconds) elapses first,
+// onTimeout decides whether the macro continues or is aborted. Closing cancel
+// interrupts the wait.
+func waitFor(fn func() (bool, error), frequency, timeout time.Duration, onTimeout string, cancel <-chan struct{}) error {
+	if frequency <= 0 {
+		frequency = 1
+	}
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout * time.Second)
+		defer t.Stop()
+		deadline = t.C
+	}
+	ticker := time.NewTicker(frequency * time.Second)
+	defer ticker.Stop()
+	for {
+		ok, err := fn()
+		if err != nil {
+			log.Println("macro-subsystem: wait condition check failed, retrying. Error:", err)
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-cancel:
+			return ErrCancelled
+		case <-deadline:
+			if onTimeout == ContinueOnTimeout {
+				log.Println("macro-subsystem: wait timed out after", int(timeout), "seconds, continuing")
+				return nil
+			}
+			log.Println("macro-subsystem: wait timed out after", int(timeout), "seconds, aborting")
+			return ErrAborted
+		}
+	}
+}
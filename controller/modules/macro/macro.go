@@ -38,7 +38,19 @@ func (s *Subsystem) List() ([]Macro, error) {
 	return ms, s.controller.Store().List(Bucket, fn)
 }
 
+func (m Macro) Validate() error {
+	for i := range m.Steps {
+		if err := m.Steps[i].Validate(); err != nil {
+			return fmt.Errorf("Invalid step %d. Error: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
 func (s *Subsystem) Create(m Macro) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
 	fn := func(id string) interface{} {
 		m.ID = id
 		return &m
@@ -47,6 +59,9 @@ func (s *Subsystem) Create(m Macro) error {
 }
 
 func (s *Subsystem) Update(id string, m Macro) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
 	m.ID = id
 	return s.controller.Store().Update(Bucket, id, m)
 }
@@ -88,7 +103,11 @@ func (s *Subsystem) Run(m Macro, reverse bool) error {
 	if reverse && !m.Reversible {
 		return fmt.Errorf("macro is not reversible")
 	}
-	log.Println("macro subsystem. Running:", m.Name)
+	e, err := s.startExecution(m, reverse)
+	if err != nil {
+		return err
+	}
+	log.Println("macro subsystem. Running:", m.Name, "run:", e.ID)
 	steps := m.Steps
 	if reverse {
 		steps = []Step{}
@@ -111,14 +130,19 @@ func (s *Subsystem) Run(m Macro, reverse bool) error {
 		}
 	}
 	for i, step := range steps {
+		if err := s.beginStep(e, i, step); err != nil {
+			return s.cancelled(m, e, steps[:i], reverse)
+		}
 		if hasScheduledMacro {
 			s.Lock()
 			s.scheduledmacros[scheduledMacroIndex].Steps[i].Start = time.Now()
 			s.scheduledmacros[scheduledMacroIndex].Steps[i].Status = Started
 			s.Unlock()
 		}
-		if err := step.Run(s.controller, reverse); err != nil {
+		err := step.run(s.controller, reverse, e.cancel)
+		if err != nil && err != ErrAborted && err != ErrCancelled {
 			log.Println("ERROR: macro subsystem. Failed to execute step:", i, "of macro", m.Name, ". Error:", err)
+			s.stepFailed(e, i, err)
 		}
 		if hasScheduledMacro {
 			s.Lock()
@@ -126,7 +150,40 @@ func (s *Subsystem) Run(m Macro, reverse bool) error {
 			s.scheduledmacros[scheduledMacroIndex].Steps[i].Status = Finished
 			s.Unlock()
 		}
+		switch err {
+		case ErrAborted:
+			log.Println("macro subsystem. Aborted:", m.Name, "at step:", i)
+			s.finishExecution(e, RunAborted, err)
+			return err
+		case ErrCancelled:
+			return s.cancelled(m, e, steps[:i+1], reverse)
+		}
 	}
+	s.finishExecution(e, RunCompleted, nil)
 	log.Println("macro subsystem. Finished:", m.Name)
 	return s.Update(m.ID, m)
 }
+
+// cancelled reverts the steps executed so far, in reverse order, when a
+// reversible macro is cancelled. Wait steps are skipped so that the revert
+// happens immediately. Cancelling a revert does not undo it.
+func (s *Subsystem) cancelled(m Macro, e *Execution, executed []Step, reverse bool) error {
+	log.Println("macro subsystem. Cancelled:", m.Name, "run:", e.ID)
+	if m.Reversible && !reverse {
+		log.Println("macro subsystem. Reverting", len(executed), "step(s) of:", m.Name)
+		for i := len(executed) - 1; i >= 0; i-- {
+			if executed[i].isWait() {
+				continue
+			}
+			if err := executed[i].Run(s.controller, true); err != nil {
+				log.Println("ERROR: macro subsystem. Failed to revert step:", i, "of macro", m.Name, ". Error:", err)
+				s.stepFailed(e, i, err)
+			}
+		}
+		s.Lock()
+		e.Reverted = true
+		s.Unlock()
+	}
+	s.finishExecution(e, RunCancelled, ErrCancelled)
+	return ErrCancelled
+}
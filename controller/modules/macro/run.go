@@ -0,0 +1,259 @@
+package macro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DefaultHistoryLimit is the number of finished macro runs kept in the store
+const DefaultHistoryLimit = 100
+
+const (
+	RunRunning   = "running"
+	RunPaused    = "paused"
+	RunCompleted = "completed"
+	RunCancelled = "cancelled"
+	RunAborted   = "aborted"
+	RunFailed    = "failed"
+)
+
+// ErrCancelled is returned by a step when the macro run is cancelled via API
+var ErrCancelled = errors.New("macro cancelled")
+
+// Execution records a single run of a macro. Current is the index of the
+// step being executed. Errors holds the failures of individual steps, which
+// do not stop the run, while Error holds the reason the run ended early.
+type Execution struct {
+	ID       string    `json:"id"`
+	Macro    string    `json:"macro"`
+	Name     string    `json:"name"`
+	Reverse  bool      `json:"reverse"`
+	State    string    `json:"state"`
+	Current  int       `json:"current"`
+	Step     string    `json:"step"`
+	Total    int       `json:"total"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Errors   []string  `json:"errors"`
+	Error    string    `json:"error"`
+	Reverted bool      `json:"reverted"`
+	cancel   chan struct{}
+	resume   chan struct{}
+}
+
+func (e *Execution) active() bool {
+	return e.State == RunRunning || e.State == RunPaused
+}
+
+func (s *Subsystem) startExecution(m Macro, reverse bool) (*Execution, error) {
+	e := &Execution{
+		Macro:   m.ID,
+		Name:    m.Name,
+		Reverse: reverse,
+		State:   RunRunning,
+		Total:   len(m.Steps),
+		Start:   time.Now(),
+		Errors:  []string{},
+		cancel:  make(chan struct{}),
+	}
+	fn := func(id string) interface{} {
+		e.ID = id
+		return e
+	}
+	if err := s.controller.Store().Create(RunBucket, fn); err != nil {
+		return nil, err
+	}
+	s.Lock()
+	s.runs[e.ID] = e
+	s.Unlock()
+	s.trimHistory()
+	return e, nil
+}
+
+func (s *Subsystem) finishExecution(e *Execution, state string, err error) {
+	s.Lock()
+	e.State = state
+	e.End = time.Now()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	delete(s.runs, e.ID)
+	snapshot := *e
+	s.Unlock()
+	if err := s.controller.Store().Update(RunBucket, e.ID, snapshot); err != nil {
+		log.Println("ERROR: macro subsystem. Failed to save run:", e.ID, "of macro", e.Name, ". Error:", err)
+	}
+}
+
+// beginStep records the step as current, blocking while the run is paused.
+// It returns ErrCancelled if the run is cancelled before the step starts.
+func (s *Subsystem) beginStep(e *Execution, i int, step Step) error {
+	s.Lock()
+	resume := e.resume
+	s.Unlock()
+	if resume != nil {
+		select {
+		case <-resume:
+		case <-e.cancel:
+			return ErrCancelled
+		}
+	}
+	select {
+	case <-e.cancel:
+		return ErrCancelled
+	default:
+	}
+	s.Lock()
+	e.Current = i
+	e.Step = step.Type
+	s.Unlock()
+	return nil
+}
+
+func (s *Subsystem) stepFailed(e *Execution, i int, err error) {
+	s.Lock()
+	e.Errors = append(e.Errors, fmt.Sprintf("step %d: %s", i+1, err))
+	s.Unlock()
+}
+
+// Cancel stops an active macro run. A wait in progress is interrupted and a
+// reversible macro reverts the steps it has already executed.
+func (s *Subsystem) Cancel(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.runs[id]
+	if !ok {
+		return fmt.Errorf("Macro run '%s' is not active", id)
+	}
+	select {
+	case <-e.cancel:
+		return fmt.Errorf("Macro run '%s' is already cancelled", id)
+	default:
+	}
+	close(e.cancel)
+	return nil
+}
+
+// Pause holds an active macro run before its next step. A step that is
+// already executing runs to completion.
+func (s *Subsystem) Pause(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.runs[id]
+	if !ok || e.State != RunRunning {
+		return fmt.Errorf("Macro run '%s' is not running", id)
+	}
+	e.State = RunPaused
+	e.resume = make(chan struct{})
+	return nil
+}
+
+func (s *Subsystem) Resume(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.runs[id]
+	if !ok || e.State != RunPaused {
+		return fmt.Errorf("Macro run '%s' is not paused", id)
+	}
+	e.State = RunRunning
+	close(e.resume)
+	e.resume = nil
+	return nil
+}
+
+// GetRun returns an active run from the registry or a finished run from history
+func (s *Subsystem) GetRun(id string) (Execution, error) {
+	s.Lock()
+	if e, ok := s.runs[id]; ok {
+		r := *e
+		s.Unlock()
+		return r, nil
+	}
+	s.Unlock()
+	var e Execution
+	return e, s.controller.Store().Get(RunBucket, id, &e)
+}
+
+// Runs returns active and finished macro runs, most recent first
+func (s *Subsystem) Runs() ([]Execution, error) {
+	runs := []Execution{}
+	fn := func(_ string, v []byte) error {
+		var e Execution
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		runs = append(runs, e)
+		return nil
+	}
+	if err := s.controller.Store().List(RunBucket, fn); err != nil {
+		return runs, err
+	}
+	s.Lock()
+	for i, r := range runs {
+		if e, ok := s.runs[r.ID]; ok {
+			runs[i] = *e
+		}
+	}
+	s.Unlock()
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Start.After(runs[j].Start)
+	})
+	return runs, nil
+}
+
+// trimHistory deletes the oldest runs beyond the history limit
+func (s *Subsystem) trimHistory() {
+	var ids []int
+	fn := func(k string, _ []byte) error {
+		id, err := strconv.Atoi(k)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	}
+	if err := s.controller.Store().List(RunBucket, fn); err != nil {
+		log.Println("ERROR: macro subsystem. Failed to list runs. Error:", err)
+		return
+	}
+	if len(ids) <= s.historyLimit {
+		return
+	}
+	sort.Ints(ids)
+	for _, id := range ids[:len(ids)-s.historyLimit] {
+		if err := s.controller.Store().Delete(RunBucket, strconv.Itoa(id)); err != nil {
+			log.Println("ERROR: macro subsystem. Failed to delete run:", id, ". Error:", err)
+		}
+	}
+}
+
+// markInterrupted flags runs that were active when reef-pi stopped
+func (s *Subsystem) markInterrupted() error {
+	var stale []Execution
+	fn := func(_ string, v []byte) error {
+		var e Execution
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		if e.active() {
+			stale = append(stale, e)
+		}
+		return nil
+	}
+	if err := s.controller.Store().List(RunBucket, fn); err != nil {
+		return err
+	}
+	for _, e := range stale {
+		e.State = RunAborted
+		e.Error = "interrupted by restart"
+		if err := s.controller.Store().Update(RunBucket, e.ID, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package macro
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+type stateSubsystem interface {
+	controller.Subsystem
+	Get(string) (bool, error)
+}
+
+type testController struct {
+	controller.Controller
+	sub stateSubsystem
+}
+
+func (t *testController) Subsystem(_ string) (controller.Subsystem, error) {
+	return t.sub, nil
+}
+
+func activeRun(t *testing.T, s *Subsystem, state string) Execution {
+	for i := 0; i < 100; i++ {
+		runs, err := s.Runs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) > 0 && runs[0].State == state {
+			return runs[0]
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for macro run state:", state)
+	return Execution{}
+}
+
+func TestMacroRuns(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	eqs := controller.NoopSubsystem()
+	c := &testController{Controller: con, sub: eqs}
+	s, err := New(true, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	tr := utils.NewTestRouter()
+	s.LoadAPI(tr.Router)
+
+	m := Macro{
+		Name:       "feed",
+		Reversible: true,
+		Steps: []Step{
+			{Type: "equipment", Config: []byte(`{"id":"1","on":true}`)},
+			{Type: "wait", Config: []byte(`{"duration":30}`)},
+			{Type: "equipment", Config: []byte(`{"id":"2","on":true}`)},
+		},
+	}
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(m)
+	if err := tr.Do("PUT", "/api/macros", body, nil); err != nil {
+		t.Fatal("Failed to create macro using api. Error:", err)
+	}
+	if err := tr.Do("POST", "/api/macros/1/run", strings.NewReader(`{}`), nil); err != nil {
+		t.Fatal("Failed to run macro using api. Error:", err)
+	}
+	r := activeRun(t, s, RunRunning)
+	for i := 0; i < 100 && r.Current != 1; i++ {
+		time.Sleep(20 * time.Millisecond)
+		r, _ = s.GetRun(r.ID)
+	}
+	if r.Current != 1 || r.Step != "wait" {
+		t.Error("Expected macro to be waiting at step 2, found:", r.Current+1, r.Step)
+	}
+	if on, _ := eqs.Get("1"); !on {
+		t.Error("Equipment should be switched on by first step")
+	}
+	if err := tr.Do("POST", "/api/macros/runs/"+r.ID+"/cancel", strings.NewReader(`{}`), nil); err != nil {
+		t.Fatal("Failed to cancel macro run using api. Error:", err)
+	}
+	r = activeRun(t, s, RunCancelled)
+	if !r.Reverted {
+		t.Error("Cancelled reversible macro should be reverted")
+	}
+	if on, _ := eqs.Get("1"); on {
+		t.Error("Equipment should be switched off after revert")
+	}
+	if _, err := eqs.Get("2"); err == nil {
+		t.Error("Steps after cancellation should not run")
+	}
+	if err := s.Cancel(r.ID); err == nil {
+		t.Error("Cancelling a finished run should fail")
+	}
+	if err := tr.Do("GET", "/api/macros/runs/"+r.ID, strings.NewReader(`{}`), nil); err != nil {
+		t.Error("Failed to get macro run using api. Error:", err)
+	}
+
+	// pause holds the macro before the next step
+	m.ID = "1"
+	m.Steps[1].Config = []byte(`{"duration":0}`)
+	m.Steps = append([]Step{{Type: "wait", Config: []byte(`{"duration":1}`)}}, m.Steps...)
+	if err := s.Update("1", m); err != nil {
+		t.Fatal(err)
+	}
+	go s.On("1", false)
+	r = activeRun(t, s, RunRunning)
+	if err := tr.Do("POST", "/api/macros/runs/"+r.ID+"/pause", strings.NewReader(`{}`), nil); err != nil {
+		t.Fatal("Failed to pause macro run using api. Error:", err)
+	}
+	if err := s.Pause(r.ID); err == nil {
+		t.Error("Pausing a paused run should fail")
+	}
+	time.Sleep(1200 * time.Millisecond)
+	if r, _ = s.GetRun(r.ID); r.State != RunPaused || r.Current != 0 {
+		t.Error("Paused macro should not proceed. State:", r.State, "step:", r.Current+1)
+	}
+	if err := tr.Do("POST", "/api/macros/runs/"+r.ID+"/resume", strings.NewReader(`{}`), nil); err != nil {
+		t.Fatal("Failed to resume macro run using api. Error:", err)
+	}
+	r = activeRun(t, s, RunCompleted)
+	if on, _ := eqs.Get("2"); !on {
+		t.Error("Resumed macro should execute remaining steps")
+	}
+	if err := s.Resume(r.ID); err == nil {
+		t.Error("Resuming a finished run should fail")
+	}
+
+	// history is bounded
+	s.historyLimit = 2
+	m.Steps = []Step{{Type: "equipment", Config: []byte(`{"id":"3","on":true}`)}}
+	for i := 0; i < 3; i++ {
+		if err := s.Run(m, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := s.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Error("Expected run history to be capped at 2, found:", len(runs))
+	}
+	if err := tr.Do("GET", "/api/macros/runs", strings.NewReader(`{}`), nil); err != nil {
+		t.Error("Failed to list macro runs using api. Error:", err)
+	}
+}
@@ -9,7 +9,7 @@ import (
 
 	"github.com/reef-pi/reef-pi/controller"
 	"github.com/reef-pi/reef-pi/controller/modules/doser"
-	"github.com/reef-pi/reef-pi/controller/modules/temperature"
+	"github.com/reef-pi/reef-pi/controller/modules/lighting"
 	"github.com/reef-pi/reef-pi/controller/storage"
 )
 
@@ -26,7 +26,40 @@ type WaitTemperatureStep struct {
 	Frequency  time.Duration `json:"frequency"`
 	RangeTemp1 float64       `json:"rangetemp1"`
 	RangeTemp2 float64       `json:"rangetemp2"`
+	Timeout    time.Duration `json:"timeout"`
+	OnTimeout  string        `json:"on_timeout"`
 }
+
+// WaitSensorStep waits until a sensor reading satisfies the operator and value.
+// Timeout is mandatory, OnTimeout is either "continue" or "abort" (default).
+type WaitSensorStep struct {
+	ID        string        `json:"id"`
+	Operator  string        `json:"operator"`
+	Value     float64       `json:"value"`
+	Frequency time.Duration `json:"frequency"`
+	Timeout   time.Duration `json:"timeout"`
+	OnTimeout string        `json:"on_timeout"`
+}
+
+func (w WaitSensorStep) condition(t string) Condition {
+	return Condition{Type: t, ID: w.ID, Operator: w.Operator, Value: w.Value}
+}
+
+// ConditionalStep runs the Then steps if the condition holds, Else steps otherwise
+type ConditionalStep struct {
+	Condition Condition `json:"condition"`
+	Then      []Step    `json:"then"`
+	Else      []Step    `json:"else"`
+}
+
+// sensor wait step types and the bucket of the sensor they wait on
+var waitSensorSteps = map[string]string{
+	"inletwait":  storage.InletBucket,
+	"analogwait": storage.AnalogInputBucket,
+	"phwait":     storage.PhBucket,
+	"flowwait":   storage.FlowBucket,
+}
+
 type DoserStep struct {
 	ID       string  `json:"id"`
 	Duration float64 `json:"duration"`
@@ -58,7 +91,106 @@ type TemperatureRead struct {
 	Temperature float64 `json:"temperature"`
 }
 
+func (s *Step) Validate() error {
+	if sensor, ok := waitSensorSteps[s.Type]; ok {
+		var w WaitSensorStep
+		if err := json.Unmarshal(s.Config, &w); err != nil {
+			return err
+		}
+		if w.Timeout <= 0 {
+			return fmt.Errorf("Timeout should be positive. Supplied: %d", w.Timeout)
+		}
+		if err := validateOnTimeout(w.OnTimeout); err != nil {
+			return err
+		}
+		return w.condition(sensor).Validate()
+	}
+	switch s.Type {
+	case "waittemp":
+		var wt WaitTemperatureStep
+		if err := json.Unmarshal(s.Config, &wt); err != nil {
+			return err
+		}
+		if wt.Timeout <= 0 {
+			return fmt.Errorf("Timeout should be positive. Supplied: %d", wt.Timeout)
+		}
+		return validateOnTimeout(wt.OnTimeout)
+	case "lightoverride":
+		var lo lighting.LightOverride
+		if err := json.Unmarshal(s.Config, &lo); err != nil {
+			return err
+		}
+		if lo.Light == "" {
+			return fmt.Errorf("Missing light")
+		}
+	case "if":
+		var cs ConditionalStep
+		if err := json.Unmarshal(s.Config, &cs); err != nil {
+			return err
+		}
+		if err := cs.Condition.Validate(); err != nil {
+			return err
+		}
+		for _, branch := range [][]Step{cs.Then, cs.Else} {
+			for i := range branch {
+				if err := branch[i].Validate(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Step) isWait() bool {
+	_, ok := waitSensorSteps[s.Type]
+	return ok || s.Type == "wait" || s.Type == "waittemp"
+}
+
+func validateOnTimeout(p string) error {
+	switch p {
+	case "", ContinueOnTimeout, AbortOnTimeout:
+		return nil
+	default:
+		return fmt.Errorf("Unknown timeout policy:%s", p)
+	}
+}
+
+// runSteps executes nested steps in order (reverse order when reverting). Step
+// failures are logged and skipped, same as top level macro steps, while an
+// abort or cancellation stops the remaining steps.
+func runSteps(c controller.Controller, steps []Step, reverse bool, cancel <-chan struct{}) error {
+	for i := range steps {
+		step := steps[i]
+		if reverse {
+			step = steps[len(steps)-1-i]
+		}
+		if err := step.run(c, reverse, cancel); err != nil {
+			if err == ErrAborted || err == ErrCancelled {
+				return err
+			}
+			log.Println("ERROR: macro subsystem. Failed to execute nested step:", step.Type, ". Error:", err)
+		}
+	}
+	return nil
+}
+
 func (s *Step) Run(c controller.Controller, reverse bool) error {
+	return s.run(c, reverse, nil)
+}
+
+// run executes the step, waits are interrupted with ErrCancelled when the
+// cancel channel is closed
+func (s *Step) run(c controller.Controller, reverse bool, cancel <-chan struct{}) error {
+	if sensor, ok := waitSensorSteps[s.Type]; ok {
+		var w WaitSensorStep
+		if err := json.Unmarshal(s.Config, &w); err != nil {
+			return err
+		}
+		cond := w.condition(sensor)
+		log.Println("macro-subsystem: executing step:", s.Type, "until", sensor, w.ID, w.Operator, w.Value, "timeout:", int(w.Timeout), "seconds")
+		return waitFor(func() (bool, error) { return cond.Evaluate(c) }, w.Frequency, w.Timeout, w.OnTimeout, cancel)
+	}
 	switch s.Type {
 	case "directdoser":
 		var dt DoserStep
@@ -108,53 +240,64 @@ func (s *Step) Run(c controller.Controller, reverse bool) error {
 			return err
 		}
 		log.Println("macro-subsystem: executing step: sleep for", int(w.Duration), "seconds")
-		time.Sleep(w.Duration * time.Second)
-		return nil
-	// case "inletwait":
-	// 	devInlets := c.DM().Inlets()
-	// 	var inletStep GenericStep
-	// 	if err := json.Unmarshal(s.Config, &inletStep); err != nil {
-	// 		return err
-	// 	}
-	// 	for value, err := devInlets.Read(inletStep.ID); err != nil && value != 1; {
-	// 		return nil
-	// 	}
-	// 	return nil
+		select {
+		case <-time.After(w.Duration * time.Second):
+			return nil
+		case <-cancel:
+			return ErrCancelled
+		}
 	case "waittemp":
 		var wt WaitTemperatureStep
 		if err := json.Unmarshal(s.Config, &wt); err != nil {
 			return err
 		}
 		log.Println("macro-subsystem: executing step: sleep until temperature is reached-- Frequency of checks:", int(wt.Frequency), "seconds", "rangetemp1", wt.RangeTemp1, "rangetemp2", wt.RangeTemp2)
-		isInRange := false
-		for !isInRange {
-			log.Println("macro-subsystem: executing step: assigned temperature sensor ID:", wt.ID)
-
-			tempsubsystem, _ := c.Subsystem(temperature.Bucket)
-			tc, ok := tempsubsystem.(*temperature.Controller)
-			if !ok {
-				log.Println("macro-subsystem: executing step: not able to read the temperature")
-				return errors.New("Failed to cast temperature subsystem to temperature controller")
-			}
-			sensor, err := tc.Get(wt.ID)
+		fn := func() (bool, error) {
+			currentRead, err := readSensor(c, storage.TemperatureBucket, wt.ID)
 			if err != nil {
-				log.Println("not able to read the sensor value", err.Error())
-				return err
+				log.Println("macro-subsystem: executing step: not able to read the temperature", err.Error())
+				return false, err
 			}
-			currentRead, _ := tc.Read(*sensor)
-
 			log.Println("macro-subsystem: executing step: awaiting temperature, current read:", currentRead)
-			//if the read is in range
-			if currentRead >= wt.RangeTemp1 && currentRead <= wt.RangeTemp2 {
-				log.Println("macro-subsystem: executing step: temperature has reached:", currentRead)
-				isInRange = true
-			} else {
-				log.Println("macro-subsystem: executing step: sleeping for ", wt.Frequency*time.Second)
-				time.Sleep(wt.Frequency * time.Second)
-			}
+			return currentRead >= wt.RangeTemp1 && currentRead <= wt.RangeTemp2, nil
 		}
-
-		return nil
+		return waitFor(fn, wt.Frequency, wt.Timeout, wt.OnTimeout, cancel)
+	case "lightoverride":
+		var lo lighting.LightOverride
+		if err := json.Unmarshal(s.Config, &lo); err != nil {
+			return err
+		}
+		sub, err := c.Subsystem(storage.LightingBucket)
+		if err != nil {
+			return err
+		}
+		lc, ok := sub.(*lighting.Controller)
+		if !ok {
+			return errors.New("Failed to cast lighting subsystem to lighting controller")
+		}
+		if reverse {
+			log.Println("macro-subsystem: executing step: clearing macro overrides of light:", lo.Light)
+			lc.ClearOverrides(lo.Light, "macro")
+			return nil
+		}
+		log.Println("macro-subsystem: executing step: overriding light:", lo.Light)
+		lo.Source = "macro"
+		_, err = lc.AddOverride(lo.Light, lo.Override)
+		return err
+	case "if":
+		var cs ConditionalStep
+		if err := json.Unmarshal(s.Config, &cs); err != nil {
+			return err
+		}
+		ok, err := cs.Condition.Evaluate(c)
+		if err != nil {
+			return err
+		}
+		log.Println("macro-subsystem: executing step: condition evaluated to", ok)
+		if ok {
+			return runSteps(c, cs.Then, reverse, cancel)
+		}
+		return runSteps(c, cs.Else, reverse, cancel)
 	default:
 		return fmt.Errorf("Unknown step type:%s", s.Type)
 	}
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/storage"
 )
 
 func TestStep(t *testing.T) {
@@ -53,3 +55,111 @@ func TestStep(t *testing.T) {
 		t.Error("Invalid subsystem system config should raise error")
 	}
 }
+
+func TestSensorSteps(t *testing.T) {
+	c, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Store().Close()
+	if err := c.DM().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DM().Inlets().Create(connectors.Inlet{Name: "float", Pin: 16, Driver: "rpi"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Step{Type: "inletwait", Config: []byte(`{"id":"1","operator":"==","value":1}`)}
+	if err := s.Validate(); err == nil {
+		t.Error("Sensor wait step without timeout should fail validation")
+	}
+	s.Config = []byte(`{"id":"1","operator":"~","value":1,"timeout":1}`)
+	if err := s.Validate(); err == nil {
+		t.Error("Sensor wait step with unknown operator should fail validation")
+	}
+	s.Config = []byte(`{"id":"1","operator":"==","value":1,"timeout":1,"on_timeout":"foo"}`)
+	if err := s.Validate(); err == nil {
+		t.Error("Sensor wait step with unknown timeout policy should fail validation")
+	}
+	s.Config = []byte(`{"id":"1","operator":"==","value":0,"timeout":1}`)
+	if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := s.Run(c, false); err != nil {
+		t.Error(err)
+	}
+
+	// inlet never reads 1, step times out
+	s.Config = []byte(`{"id":"1","operator":"==","value":1,"timeout":1,"on_timeout":"continue"}`)
+	if err := s.Run(c, false); err != nil {
+		t.Error("Timed out step with continue policy should not fail. Error:", err)
+	}
+	s.Config = []byte(`{"id":"1","operator":"==","value":1,"timeout":1}`)
+	if err := s.Run(c, false); err != ErrAborted {
+		t.Error("Timed out step should abort macro by default. Error:", err)
+	}
+	// read errors do not end the wait, timeout policy applies
+	s.Config = []byte(`{"id":"9","operator":"==","value":1,"timeout":1,"on_timeout":"continue"}`)
+	if err := s.Run(c, false); err != nil {
+		t.Error("Read errors should not fail the wait before timeout. Error:", err)
+	}
+	wt := Step{Type: "waittemp", Config: []byte(`{"id":"1","rangetemp1":24,"rangetemp2":26}`)}
+	if err := wt.Validate(); err == nil {
+		t.Error("Temperature wait step without timeout should fail validation")
+	}
+
+	s = Step{
+		Type: "if",
+		Config: []byte(`{
+			"condition":{"type":"inlets","id":"1","operator":"==","value":0},
+			"then":[{"type":"wait","config":{"duration":0}}],
+			"else":[{"type":"inletwait","config":{"id":"1","operator":"==","value":1}}]
+		}`),
+	}
+	if err := s.Validate(); err == nil {
+		t.Error("Conditional step with invalid branch should fail validation")
+	}
+	if err := s.Run(c, false); err != nil {
+		t.Error("Conditional step should run then branch. Error:", err)
+	}
+	s.Config = []byte(`{
+		"condition":{"type":"inlets","id":"1","operator":"!=","value":0},
+		"then":[{"type":"wait","config":{"duration":0}}],
+		"else":[{"type":"inletwait","config":{"id":"1","operator":">","value":0,"timeout":1}}]
+	}`)
+	if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := s.Run(c, false); err != ErrAborted {
+		t.Error("Aborted else branch should abort conditional step. Error:", err)
+	}
+	used, err := s.uses(storage.InletBucket, "1")
+	if err != nil {
+		t.Error(err)
+	}
+	if !used {
+		t.Error("Conditional step should use inlet")
+	}
+	s.Config = []byte(`{"condition":{"type":"bar","id":"1","operator":"==","value":0}}`)
+	if err := s.Validate(); err == nil {
+		t.Error("Conditional step with unknown sensor type should fail validation")
+	}
+	lo := Step{Type: "lightoverride", Config: []byte(`{"value":20,"duration":3600}`)}
+	if err := lo.Validate(); err == nil {
+		t.Error("Light override step without light should fail validation")
+	}
+	lo.Config = []byte(`{"light":"1","value":20,"duration":3600}`)
+	if err := lo.Validate(); err != nil {
+		t.Error(err)
+	}
+	if used, _ := lo.uses(storage.LightingBucket, "1"); !used {
+		t.Error("Light override step should use light")
+	}
+	if err := lo.Run(c, false); err == nil {
+		t.Error("Light override step should fail without lighting subsystem")
+	}
+	m := Macro{Name: "invalid", Steps: []Step{s}}
+	if err := m.Validate(); err == nil {
+		t.Error("Macro with invalid step should fail validation")
+	}
+}
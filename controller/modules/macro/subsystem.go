@@ -6,11 +6,13 @@ import (
 	"sync"
 
 	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/modules/lighting"
 	"github.com/reef-pi/reef-pi/controller/storage"
 )
 
 const Bucket = storage.MacroBucket
 const UsageBucket = storage.MacroUsageBucket
+const RunBucket = storage.MacroRunBucket
 
 type Subsystem struct {
 	sync.Mutex
@@ -18,6 +20,8 @@ type Subsystem struct {
 	quitters        map[string]chan struct{}
 	scheduledmacros []Macro
 	controller      controller.Controller
+	runs            map[string]*Execution
+	historyLimit    int
 }
 
 func New(devMode bool, c controller.Controller) (*Subsystem, error) {
@@ -25,11 +29,19 @@ func New(devMode bool, c controller.Controller) (*Subsystem, error) {
 		devMode:         devMode,
 		controller:      c,
 		scheduledmacros: []Macro{},
+		runs:            make(map[string]*Execution),
+		historyLimit:    DefaultHistoryLimit,
 	}, nil
 }
 
 func (s *Subsystem) Setup() error {
-	return s.controller.Store().CreateBucket(Bucket)
+	if err := s.controller.Store().CreateBucket(Bucket); err != nil {
+		return err
+	}
+	if err := s.controller.Store().CreateBucket(RunBucket); err != nil {
+		return err
+	}
+	return s.markInterrupted()
 }
 
 func (s *Subsystem) Start() {
@@ -48,33 +60,21 @@ func (s *Subsystem) On(id string, b bool) error {
 func (s *Subsystem) InUse(depType, id string) ([]string, error) {
 	var deps []string
 	switch depType {
-	case storage.ATOBucket:
-		fallthrough
-	case storage.EquipmentBucket:
-		fallthrough
-	case storage.TemperatureBucket:
-		fallthrough
-	case storage.DoserBucket:
-		fallthrough
-	case storage.PhBucket:
-		fallthrough
-	case storage.TimerBucket:
-		fallthrough
-	case storage.MacroBucket:
+	case storage.ATOBucket, storage.EquipmentBucket, storage.TemperatureBucket, storage.DoserBucket,
+		storage.PhBucket, storage.TimerBucket, storage.MacroBucket, storage.InletBucket,
+		storage.AnalogInputBucket, storage.FlowBucket, storage.LightingBucket:
 		ms, err := s.List()
 		if err != nil {
 			return deps, nil
 		}
 		for _, m := range ms {
 			for i, step := range m.Steps {
-				if step.Type == depType {
-					var g GenericStep
-					if err := json.Unmarshal(step.Config, &g); err != nil {
-						return deps, err
-					}
-					if g.ID == id {
-						deps = append(deps, fmt.Sprintf("%s(step: %d)", m.Name, i+1))
-					}
+				used, err := step.uses(depType, id)
+				if err != nil {
+					return deps, err
+				}
+				if used {
+					deps = append(deps, fmt.Sprintf("%s(step: %d)", m.Name, i+1))
 				}
 			}
 		}
@@ -83,3 +83,63 @@ func (s *Subsystem) InUse(depType, id string) ([]string, error) {
 		return deps, fmt.Errorf("unknown dep type:%s", depType)
 	}
 }
+
+// uses reports whether a step (or any of its nested steps) refers to the
+// given equipment, sensor or other reef-pi entity
+func (s Step) uses(depType, id string) (bool, error) {
+	if sensor, ok := waitSensorSteps[s.Type]; ok {
+		if sensor != depType {
+			return false, nil
+		}
+		var w WaitSensorStep
+		if err := json.Unmarshal(s.Config, &w); err != nil {
+			return false, err
+		}
+		return w.ID == id, nil
+	}
+	switch s.Type {
+	case "if":
+		var cs ConditionalStep
+		if err := json.Unmarshal(s.Config, &cs); err != nil {
+			return false, err
+		}
+		if cs.Condition.Type == depType && cs.Condition.ID == id {
+			return true, nil
+		}
+		for _, branch := range [][]Step{cs.Then, cs.Else} {
+			for _, nested := range branch {
+				used, err := nested.uses(depType, id)
+				if err != nil || used {
+					return used, err
+				}
+			}
+		}
+		return false, nil
+	case "lightoverride":
+		if depType != storage.LightingBucket {
+			return false, nil
+		}
+		var lo lighting.LightOverride
+		if err := json.Unmarshal(s.Config, &lo); err != nil {
+			return false, err
+		}
+		return lo.Light == id, nil
+	case "waittemp":
+		if depType != storage.TemperatureBucket {
+			return false, nil
+		}
+		var wt WaitTemperatureStep
+		if err := json.Unmarshal(s.Config, &wt); err != nil {
+			return false, err
+		}
+		return wt.ID == id, nil
+	case depType:
+		var g GenericStep
+		if err := json.Unmarshal(s.Config, &g); err != nil {
+			return false, err
+		}
+		return g.ID == id, nil
+	default:
+		return false, nil
+	}
+}
@@ -165,25 +165,30 @@ func (c *Controller) Run(p Probe, quit chan struct{}) {
 	}
 }
 
-func (c *Controller) checkAndControl(p Probe) {
+// CalibratedRead reads the probe and applies its stored calibration, if any
+func (c *Controller) CalibratedRead(p Probe) (float64, error) {
 	reading, err := c.Read(p)
 	if err != nil {
-		log.Println("ph sub-system: ERROR: Failed to read probe:", p.Name, ". Error:", err)
-		c.c.LogError("ph-"+p.ID, "ph subsystem: Failed read probe:"+p.Name+"Error:"+err.Error())
-		return
+		return reading, err
 	}
-	var calibrator hal.Calibrator
 	var ms []hal.Measurement
 	if err := c.c.Store().Get(CalibrationBucket, p.ID, &ms); err == nil {
 		cal, err := hal.CalibratorFactory(ms)
 		if err != nil {
 			log.Println("ERROR: ph-subsystem: Failed to create calibration function for probe:", p.Name, "Error:", err)
 		} else {
-			calibrator = cal
+			reading = cal.Calibrate(reading)
 		}
 	}
-	if calibrator != nil {
-		reading = calibrator.Calibrate(reading)
+	return reading, nil
+}
+
+func (c *Controller) checkAndControl(p Probe) {
+	reading, err := c.CalibratedRead(p)
+	if err != nil {
+		log.Println("ph sub-system: ERROR: Failed to read probe:", p.Name, ". Error:", err)
+		c.c.LogError("ph-"+p.ID, "ph subsystem: Failed read probe:"+p.Name+"Error:"+err.Error())
+		return
 	}
 	log.Println("ph sub-system: Probe:", p.Name, "Reading:", reading)
 	notifyIfNeeded(c.c.Telemetry(), p, reading)
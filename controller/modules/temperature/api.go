@@ -26,6 +26,8 @@ func (t *Controller) currentReading(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return nil, err
 		}
+		tc.Lock()
+		defer tc.Unlock()
 		v := make(map[string]float64)
 		v["temperature"] = tc.currentValue
 		return v, nil
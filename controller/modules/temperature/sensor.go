@@ -43,6 +43,22 @@ func (c *Controller) Read(tc TC) (float64, error) {
 	return tc.readTemperature(fi)
 }
 
+// CalibratedRead reads the sensor and applies its calibration, like the
+// readings recorded by Check
+func (c *Controller) CalibratedRead(tc *TC) (float64, error) {
+	tc.Lock()
+	sensor, fahrenheit, cal := tc.Sensor, tc.Fahrenheit, tc.calibrator
+	tc.Unlock()
+	reading, err := c.Read(TC{Sensor: sensor, Fahrenheit: fahrenheit})
+	if err != nil {
+		return reading, err
+	}
+	if cal != nil {
+		reading = cal.Calibrate(reading)
+	}
+	return reading, nil
+}
+
 func (t *TC) readTemperature(fi io.Reader) (float64, error) {
 	reader := bufio.NewReader(fi)
 	l1, _, err := reader.ReadLine()
@@ -5,6 +5,8 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/reef-pi/hal"
 )
 
 func Test_ReadTemperature(t *testing.T) {
@@ -22,6 +24,23 @@ func Test_ReadTemperature(t *testing.T) {
 	}
 }
 
+func TestCalibratedRead(t *testing.T) {
+	c := &Controller{devMode: true}
+	tc := &TC{CalibrationPoints: []hal.Measurement{
+		{Observed: 20, Expected: 30},
+		{Observed: 30, Expected: 40},
+	}}
+	tc.loadCalibrator()
+	// dev mode readings are between 24.4 and 25.9
+	v, err := c.CalibratedRead(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v < 34.4 || v > 35.9 {
+		t.Error("Expected calibrated reading between 34.4 and 35.9, found:", v)
+	}
+}
+
 func readFromFile(path string) (float32, error) {
 	fi, err := os.Open(path)
 	if err != nil {
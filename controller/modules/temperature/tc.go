@@ -38,6 +38,7 @@ type TC struct {
 	CalibrationPoints []hal.Measurement `json:"calibration_points"`
 	h                 *controller.Homeostasis
 	currentValue      float64
+	readAt            time.Time
 	calibrator        hal.Calibrator
 }
 
@@ -62,11 +63,26 @@ func (c *Controller) Get(id string) (*TC, error) {
 	tc, ok := c.tcs[id]
 	defer c.Unlock()
 	if !ok {
-		return nil, fmt.Errorf("temperature controller with id '%s' is not present", tc.ID)
+		return nil, fmt.Errorf("temperature controller with id '%s' is not present", id)
 	}
 	return tc, nil
 }
 
+// CurrentReading returns the last calibrated reading of a sensor and when it
+// was taken, without reading the sensor again
+func (c *Controller) CurrentReading(id string) (float64, time.Time, error) {
+	tc, err := c.Get(id)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	tc.Lock()
+	defer tc.Unlock()
+	if tc.readAt.IsZero() {
+		return 0, time.Time{}, fmt.Errorf("temperature controller '%s' has no reading yet", tc.Name)
+	}
+	return tc.currentValue, tc.readAt, nil
+}
+
 func (c Controller) List() ([]TC, error) {
 	tcs := []TC{}
 	fn := func(_ string, v []byte) error {
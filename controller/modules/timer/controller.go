@@ -8,6 +8,7 @@ import (
 	cron "github.com/robfig/cron/v3"
 
 	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/modules/lighting"
 	"github.com/reef-pi/reef-pi/controller/storage"
 )
 
@@ -79,6 +80,23 @@ func (c *Controller) InUse(depType, id string) ([]string, error) {
 			}
 		}
 		return deps, nil
+	case storage.LightingBucket:
+		ts, err := c.List()
+		if err != nil {
+			return deps, err
+		}
+		for _, timer := range ts {
+			if timer.Type == LightOverrideType {
+				var lo lighting.LightOverride
+				if err := json.Unmarshal(timer.Target, &lo); err != nil {
+					return deps, err
+				}
+				if lo.Light == id {
+					deps = append(deps, timer.Name)
+				}
+			}
+		}
+		return deps, nil
 	case storage.MacroBucket:
 		ts, err := c.List()
 		if err != nil {
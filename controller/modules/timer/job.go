@@ -8,6 +8,7 @@ import (
 
 	cron "github.com/robfig/cron/v3"
 
+	"github.com/reef-pi/reef-pi/controller/modules/lighting"
 	"github.com/reef-pi/reef-pi/controller/storage"
 )
 
@@ -61,6 +62,14 @@ func (j *Job) Validate() error {
 		if macro.ID == "" {
 			return fmt.Errorf("Missing equipment")
 		}
+	case LightOverrideType:
+		var lo lighting.LightOverride
+		if err := json.Unmarshal(j.Target, &lo); err != nil {
+			return err
+		}
+		if lo.Light == "" {
+			return fmt.Errorf("Missing light")
+		}
 	default:
 		return fmt.Errorf("Invalid timer type: %s", j.Type)
 	}
@@ -0,0 +1,22 @@
+package timer
+
+import (
+	"log"
+
+	"github.com/reef-pi/reef-pi/controller/modules/lighting"
+)
+
+const LightOverrideType = "lightoverride"
+
+type LightOverrideRunner struct {
+	lighting *lighting.Controller
+	target   lighting.LightOverride
+}
+
+func (l *LightOverrideRunner) Run() {
+	o := l.target.Override
+	o.Source = "timer"
+	if _, err := l.lighting.AddOverride(l.target.Light, o); err != nil {
+		log.Println("ERROR: timer sub-system, Failed to override light. Error:", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/modules/lighting"
 	"github.com/reef-pi/reef-pi/controller/storage"
 	cron "github.com/robfig/cron/v3"
 )
@@ -67,6 +68,23 @@ func (c *Controller) Runner(j Job) (cron.Job, error) {
 			c:      c.macro,
 			target: macro.ID,
 		}, nil
+	case LightOverrideType:
+		var lo lighting.LightOverride
+		if err := json.Unmarshal(j.Target, &lo); err != nil {
+			return nil, err
+		}
+		sub, err := c.c.Subsystem(storage.LightingBucket)
+		if err != nil {
+			return nil, err
+		}
+		lc, ok := sub.(*lighting.Controller)
+		if !ok {
+			return nil, fmt.Errorf("Failed to cast lighting subsystem to lighting controller")
+		}
+		return &LightOverrideRunner{
+			lighting: lc,
+			target:   lo,
+		}, nil
 	default:
 		return nil, fmt.Errorf("Failed to find suitable job runner")
 	}
@@ -0,0 +1,120 @@
+package water
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func (c *Controller) LoadAPI(r *mux.Router) {
+	r.HandleFunc("/api/water/parameters", c.list).Methods("GET")
+	r.HandleFunc("/api/water/parameters", c.create).Methods("PUT")
+	r.HandleFunc("/api/water/parameters/{id}", c.get).Methods("GET")
+	r.HandleFunc("/api/water/parameters/{id}", c.update).Methods("POST")
+	r.HandleFunc("/api/water/parameters/{id}", c.delete).Methods("DELETE")
+	r.HandleFunc("/api/water/parameters/{id}/results", c.parameterResults).Methods("GET")
+	r.HandleFunc("/api/water/parameters/{id}/readings", c.readings).Methods("GET")
+	r.HandleFunc("/api/water/results", c.listResults).Methods("GET")
+	r.HandleFunc("/api/water/results", c.createResult).Methods("PUT")
+	r.HandleFunc("/api/water/results/{id}", c.getResult).Methods("GET")
+	r.HandleFunc("/api/water/results/{id}", c.updateResult).Methods("POST")
+	r.HandleFunc("/api/water/results/{id}", c.deleteResult).Methods("DELETE")
+	r.HandleFunc("/api/water/due", c.due).Methods("GET")
+}
+
+func (c *Controller) get(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.Get(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) list(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.List()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Controller) create(w http.ResponseWriter, r *http.Request) {
+	var p Parameter
+	fn := func() error {
+		return c.Create(p)
+	}
+	utils.JSONCreateResponse(&p, fn, w, r)
+}
+
+func (c *Controller) update(w http.ResponseWriter, r *http.Request) {
+	var p Parameter
+	fn := func(id string) error {
+		return c.Update(id, p)
+	}
+	utils.JSONUpdateResponse(&p, fn, w, r)
+}
+
+func (c *Controller) delete(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Delete(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) parameterResults(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.Results(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) readings(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.Readings(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) listResults(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.ListResults()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Controller) createResult(w http.ResponseWriter, r *http.Request) {
+	var res Result
+	fn := func() error {
+		return c.CreateResult(res)
+	}
+	utils.JSONCreateResponse(&res, fn, w, r)
+}
+
+func (c *Controller) getResult(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.GetResult(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) updateResult(w http.ResponseWriter, r *http.Request) {
+	var res Result
+	fn := func(id string) error {
+		return c.UpdateResult(id, res)
+	}
+	utils.JSONUpdateResponse(&res, fn, w, r)
+}
+
+func (c *Controller) deleteResult(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.DeleteResult(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) due(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.DueForRetest()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
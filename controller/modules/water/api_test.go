@@ -0,0 +1,155 @@
+package water
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func TestWaterAPI(t *testing.T) {
+	r, err := controller.TestController()
+	if err != nil {
+		t.Fatal("Failed to create test controller. Error:", err)
+	}
+	defer r.Store().Close()
+	c := New(r)
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+
+	body := new(bytes.Buffer)
+	enc := json.NewEncoder(body)
+	p := Parameter{Name: "Alkalinity", Unit: "dKH", Min: 7, Max: 9, Notify: true, Retest: 24}
+	enc.Encode(p)
+	if err := tr.Do("PUT", "/api/water/parameters", body, nil); err != nil {
+		t.Fatal("Failed to create parameter using api. Error:", err)
+	}
+	body.Reset()
+	enc.Encode(Parameter{Name: "Calcium", Min: 500, Max: 400})
+	if err := tr.Do("PUT", "/api/water/parameters", body, nil); err == nil {
+		t.Error("Parameter with invalid target range should fail")
+	}
+	var dues []Due
+	if err := tr.Do("GET", "/api/water/due", strings.NewReader("{}"), &dues); err != nil {
+		t.Error("Failed to list due parameters using api. Error:", err)
+	}
+	if len(dues) != 1 {
+		t.Error("Untested parameter with retest interval should be due. Found:", len(dues))
+	}
+	c.checkReminders()
+
+	y := time.Now().AddDate(0, 0, -1)
+	yesterday := time.Date(y.Year(), y.Month(), y.Day(), 12, 0, 0, 0, time.Local)
+	results := []Result{
+		{Parameter: "1", Value: 8.1, Kit: "Hanna", Time: telemetry.TeleTime(yesterday)},
+		{Parameter: "1", Value: 8.3, Kit: "Hanna", Time: telemetry.TeleTime(yesterday.Add(time.Minute))},
+		{Parameter: "1", Value: 6.5, Kit: "Salifert"},
+	}
+	for _, res := range results {
+		body.Reset()
+		enc.Encode(res)
+		if err := tr.Do("PUT", "/api/water/results", body, nil); err != nil {
+			t.Fatal("Failed to create result using api. Error:", err)
+		}
+	}
+	body.Reset()
+	enc.Encode(Result{Parameter: "-1", Value: 1})
+	if err := tr.Do("PUT", "/api/water/results", body, nil); err == nil {
+		t.Error("Result with invalid parameter should fail")
+	}
+	var res Result
+	if err := tr.Do("GET", "/api/water/results/3", strings.NewReader("{}"), &res); err != nil {
+		t.Fatal("Failed to get result using api. Error:", err)
+	}
+	if res.Unit != "dKH" {
+		t.Error("Result should inherit unit from parameter. Found:", res.Unit)
+	}
+	if err := tr.Do("GET", "/api/water/results", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to list results using api. Error:", err)
+	}
+	var rs []Result
+	if err := tr.Do("GET", "/api/water/parameters/1/results", strings.NewReader("{}"), &rs); err != nil {
+		t.Error("Failed to list parameter results using api. Error:", err)
+	}
+	if len(rs) != 3 {
+		t.Error("Expected 3 results, found:", len(rs))
+	}
+	stats, err := c.Readings("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Current) != 3 {
+		t.Error("Expected 3 current readings, found:", len(stats.Current))
+	}
+	if len(stats.Historical) != 2 {
+		t.Error("Expected 2 daily readings, found:", len(stats.Historical))
+	}
+	if v := stats.Historical[0].(Reading).Value; v != 8.2 {
+		t.Error("Expected daily average of 8.2, found:", v)
+	}
+	if err := tr.Do("GET", "/api/water/parameters/1/readings", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to get readings using api. Error:", err)
+	}
+	dues, err = c.DueForRetest()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(dues) != 0 {
+		t.Error("Recently tested parameter should not be due")
+	}
+
+	body.Reset()
+	res.Value = 7.5
+	enc.Encode(res)
+	if err := tr.Do("POST", "/api/water/results/3", body, nil); err != nil {
+		t.Error("Failed to update result using api. Error:", err)
+	}
+	if err := tr.Do("DELETE", "/api/water/results/3", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to delete result using api. Error:", err)
+	}
+	if err := tr.Do("GET", "/api/water/parameters/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to get parameter using api. Error:", err)
+	}
+	body.Reset()
+	p.Max = 10
+	enc.Encode(p)
+	if err := tr.Do("POST", "/api/water/parameters/1", body, nil); err != nil {
+		t.Error("Failed to update parameter using api. Error:", err)
+	}
+	if err := c.On("1", false); err != nil {
+		t.Error(err)
+	}
+	if err := tr.Do("GET", "/api/water/parameters", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to list parameters using api. Error:", err)
+	}
+	if _, err := c.InUse("foo", "1"); err == nil {
+		t.Error("Unknown dependency type should fail")
+	}
+	if err := tr.Do("DELETE", "/api/water/parameters/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to delete parameter using api. Error:", err)
+	}
+	if rs, _ := c.Results("1"); len(rs) != 0 {
+		t.Error("Deleting parameter should delete its results")
+	}
+	c.Stop()
+}
+
+func TestReadingRollup(t *testing.T) {
+	mar := time.Date(2021, time.March, 5, 10, 0, 0, 0, time.Local)
+	r1 := NewReading(Result{Value: 8, Time: telemetry.TeleTime(mar)})
+	if _, moved := r1.Rollup(NewReading(Result{Value: 9, Time: telemetry.TeleTime(mar.Add(time.Hour))})); moved {
+		t.Error("Readings of the same day should be rolled up")
+	}
+	if _, moved := r1.Rollup(NewReading(Result{Value: 9, Time: telemetry.TeleTime(mar.AddDate(0, 1, 0))})); !moved {
+		t.Error("Readings of the same day in different months should not be rolled up")
+	}
+}
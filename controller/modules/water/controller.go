@@ -0,0 +1,64 @@
+package water
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const Bucket = storage.WaterParameterBucket
+const ResultBucket = storage.WaterResultBucket
+
+type Controller struct {
+	c        controller.Controller
+	mu       *sync.Mutex
+	reminded map[string]time.Time
+	interval time.Duration
+	quit     chan struct{}
+}
+
+func New(c controller.Controller) *Controller {
+	return &Controller{
+		c:        c,
+		mu:       &sync.Mutex{},
+		reminded: make(map[string]time.Time),
+		interval: time.Hour,
+	}
+}
+
+func (c *Controller) Setup() error {
+	if err := c.c.Store().CreateBucket(Bucket); err != nil {
+		return err
+	}
+	return c.c.Store().CreateBucket(ResultBucket)
+}
+
+func (c *Controller) Start() {
+	c.quit = make(chan struct{})
+	go c.remind(c.quit)
+}
+
+func (c *Controller) Stop() {
+	if c.quit != nil {
+		close(c.quit)
+		c.quit = nil
+	}
+	log.Println("Stopped water sub-system")
+}
+
+func (c *Controller) On(id string, b bool) error {
+	p, err := c.Get(id)
+	if err != nil {
+		return err
+	}
+	p.Notify = b
+	return c.Update(id, p)
+}
+
+func (c *Controller) InUse(depType, id string) ([]string, error) {
+	return []string{}, fmt.Errorf("unknown dependency type:%s", depType)
+}
@@ -0,0 +1,93 @@
+package water
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Parameter is a manually tested water parameter (e.g. alkalinity) along with
+// its target range. Retest is the number of hours after which a reminder is sent
+// if no new result has been logged, zero disables reminders.
+type Parameter struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Unit   string  `json:"unit"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Notify bool    `json:"notify"`
+	Retest int     `json:"retest"`
+}
+
+func (p Parameter) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("Missing parameter name")
+	}
+	if p.Min > p.Max {
+		return fmt.Errorf("Invalid target range. Min(%f) is above Max(%f)", p.Min, p.Max)
+	}
+	if p.Retest < 0 {
+		return fmt.Errorf("Retest interval can not be negative. Supplied: %d", p.Retest)
+	}
+	return nil
+}
+
+func (p Parameter) InRange(v float64) bool {
+	return v >= p.Min && v <= p.Max
+}
+
+func (c *Controller) Get(id string) (Parameter, error) {
+	var p Parameter
+	return p, c.c.Store().Get(Bucket, id, &p)
+}
+
+func (c *Controller) List() ([]Parameter, error) {
+	ps := []Parameter{}
+	fn := func(_ string, v []byte) error {
+		var p Parameter
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		ps = append(ps, p)
+		return nil
+	}
+	return ps, c.c.Store().List(Bucket, fn)
+}
+
+func (c *Controller) Create(p Parameter) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	fn := func(id string) interface{} {
+		p.ID = id
+		return &p
+	}
+	return c.c.Store().Create(Bucket, fn)
+}
+
+func (c *Controller) Update(id string, p Parameter) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.ID = id
+	return c.c.Store().Update(Bucket, id, p)
+}
+
+func (c *Controller) Delete(id string) error {
+	if err := c.c.Store().Delete(Bucket, id); err != nil {
+		return err
+	}
+	rs, err := c.Results(id)
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		if err := c.c.Store().Delete(ResultBucket, r.ID); err != nil {
+			log.Println("ERROR: water sub-system: Failed to delete result:", r.ID, "of parameter:", id)
+		}
+	}
+	c.mu.Lock()
+	delete(c.reminded, id)
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,85 @@
+package water
+
+import (
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+)
+
+type Reading struct {
+	Value float64            `json:"value"`
+	Time  telemetry.TeleTime `json:"time"`
+	total float64
+	len   int
+}
+
+func NewReading(r Result) Reading {
+	return Reading{
+		Value: r.Value,
+		Time:  r.Time,
+		total: r.Value,
+		len:   1,
+	}
+}
+
+func (r1 Reading) Rollup(rx telemetry.Metric) (telemetry.Metric, bool) {
+	r2 := rx.(Reading)
+	if !sameDay(r1.Time, r2.Time) {
+		return r2, true
+	}
+	return Reading{
+		Time:  r1.Time,
+		Value: telemetry.TwoDecimal((r1.total + r2.Value) / float64(r1.len+1)),
+		total: r1.total + r2.Value,
+		len:   r1.len + 1,
+	}, false
+}
+
+func sameDay(t1, t2 telemetry.TeleTime) bool {
+	y1, m1, d1 := time.Time(t1).Date()
+	y2, m2, d2 := time.Time(t2).Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
+
+func (r1 Reading) Before(rx telemetry.Metric) bool {
+	r2 := rx.(Reading)
+	return r1.Time.Before(r2.Time)
+}
+
+// Readings builds stats from the logged results of a parameter. Current holds
+// individual results while historical holds daily averages.
+func (c *Controller) Readings(id string) (telemetry.StatsResponse, error) {
+	resp := telemetry.StatsResponse{
+		Current:    []telemetry.Metric{},
+		Historical: []telemetry.Metric{},
+	}
+	if _, err := c.Get(id); err != nil {
+		return resp, err
+	}
+	rs, err := c.Results(id)
+	if err != nil {
+		return resp, err
+	}
+	for _, r := range rs {
+		reading := NewReading(r)
+		resp.Current = append(resp.Current, reading)
+		l := len(resp.Historical)
+		if l == 0 {
+			resp.Historical = append(resp.Historical, reading)
+			continue
+		}
+		m, moved := resp.Historical[l-1].Rollup(reading)
+		if moved {
+			resp.Historical = append(resp.Historical, m)
+			continue
+		}
+		resp.Historical[l-1] = m
+	}
+	if l := len(resp.Current); l > telemetry.CurrentLimit {
+		resp.Current = resp.Current[l-telemetry.CurrentLimit:]
+	}
+	if l := len(resp.Historical); l > telemetry.HistoricalLimit {
+		resp.Historical = resp.Historical[l-telemetry.HistoricalLimit:]
+	}
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package water
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+type Due struct {
+	Parameter string    `json:"parameter"`
+	Name      string    `json:"name"`
+	LastTest  time.Time `json:"last_test"`
+}
+
+func (c *Controller) remind(quit chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	for {
+		select {
+		case <-ticker.C:
+			c.checkReminders()
+		case <-quit:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// DueForRetest returns parameters whose last result is older than their retest interval
+func (c *Controller) DueForRetest() ([]Due, error) {
+	dues := []Due{}
+	ps, err := c.List()
+	if err != nil {
+		return dues, err
+	}
+	now := time.Now()
+	for _, p := range ps {
+		if p.Retest <= 0 {
+			continue
+		}
+		rs, err := c.Results(p.ID)
+		if err != nil {
+			return dues, err
+		}
+		var last time.Time
+		if len(rs) > 0 {
+			last = time.Time(rs[len(rs)-1].Time)
+		}
+		if now.Sub(last) < time.Duration(p.Retest)*time.Hour {
+			continue
+		}
+		dues = append(dues, Due{Parameter: p.ID, Name: p.Name, LastTest: last})
+	}
+	return dues, nil
+}
+
+func (c *Controller) checkReminders() {
+	dues, err := c.DueForRetest()
+	if err != nil {
+		log.Println("ERROR: water sub-system: Failed to check retest reminders. Error:", err)
+		return
+	}
+	for _, d := range dues {
+		p, err := c.Get(d.Parameter)
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		last, ok := c.reminded[p.ID]
+		if ok && time.Since(last) < time.Duration(p.Retest)*time.Hour {
+			c.mu.Unlock()
+			continue
+		}
+		c.reminded[p.ID] = time.Now()
+		c.mu.Unlock()
+		subject := "[reef-pi Reminder] Retest " + p.Name
+		body := fmt.Sprintf("'%s' has not been tested in the last %d hour(s)", p.Name, p.Retest)
+		if _, err := c.c.Telemetry().Alert(subject, body); err != nil {
+			log.Println("ERROR: water sub-system: Failed to send retest reminder for:", p.Name, "Error:", err)
+		}
+	}
+}
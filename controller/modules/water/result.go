@@ -0,0 +1,104 @@
+package water
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/telemetry"
+)
+
+// Result is a single test result for a water parameter, as read from a test kit
+type Result struct {
+	ID        string             `json:"id"`
+	Parameter string             `json:"parameter"`
+	Value     float64            `json:"value"`
+	Unit      string             `json:"unit"`
+	Kit       string             `json:"kit"`
+	Time      telemetry.TeleTime `json:"time"`
+}
+
+func (c *Controller) GetResult(id string) (Result, error) {
+	var r Result
+	return r, c.c.Store().Get(ResultBucket, id, &r)
+}
+
+// ListResults returns all results across parameters, oldest first
+func (c *Controller) ListResults() ([]Result, error) {
+	return c.results(func(_ Result) bool { return true })
+}
+
+// Results returns the results of a single parameter, oldest first
+func (c *Controller) Results(pID string) ([]Result, error) {
+	return c.results(func(r Result) bool { return r.Parameter == pID })
+}
+
+func (c *Controller) results(filter func(Result) bool) ([]Result, error) {
+	rs := []Result{}
+	fn := func(_ string, v []byte) error {
+		var r Result
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if filter(r) {
+			rs = append(rs, r)
+		}
+		return nil
+	}
+	if err := c.c.Store().List(ResultBucket, fn); err != nil {
+		return rs, err
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		return rs[i].Time.Before(rs[j].Time)
+	})
+	return rs, nil
+}
+
+func (c *Controller) CreateResult(r Result) error {
+	p, err := c.Get(r.Parameter)
+	if err != nil {
+		return fmt.Errorf("Invalid parameter '%s'. Error: %s", r.Parameter, err)
+	}
+	if r.Unit == "" {
+		r.Unit = p.Unit
+	}
+	if time.Time(r.Time).IsZero() {
+		r.Time = telemetry.TeleTime(time.Now())
+	}
+	fn := func(id string) interface{} {
+		r.ID = id
+		return &r
+	}
+	if err := c.c.Store().Create(ResultBucket, fn); err != nil {
+		return err
+	}
+	c.c.Telemetry().EmitMetric("water", p.Name, r.Value)
+	c.notifyIfNeeded(p, r)
+	return nil
+}
+
+func (c *Controller) UpdateResult(id string, r Result) error {
+	if _, err := c.Get(r.Parameter); err != nil {
+		return fmt.Errorf("Invalid parameter '%s'. Error: %s", r.Parameter, err)
+	}
+	r.ID = id
+	return c.c.Store().Update(ResultBucket, id, r)
+}
+
+func (c *Controller) DeleteResult(id string) error {
+	return c.c.Store().Delete(ResultBucket, id)
+}
+
+func (c *Controller) notifyIfNeeded(p Parameter, r Result) {
+	if !p.Notify || p.InRange(r.Value) {
+		return
+	}
+	subject := fmt.Sprintf("[Reef-Pi ALERT] %s out of range", p.Name)
+	format := "Test result of '%s' (%f %s, kit: %s) is out of target range ( %f - %f )"
+	body := fmt.Sprintf(format, p.Name, r.Value, r.Unit, r.Kit, p.Min, p.Max)
+	if _, err := c.c.Telemetry().Alert(subject, body); err != nil {
+		log.Println("ERROR: water sub-system: Failed to send alert for parameter:", p.Name, "Error:", err)
+	}
+}
@@ -0,0 +1,86 @@
+package workflow
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+func (c *Controller) LoadAPI(r *mux.Router) {
+	r.HandleFunc("/api/workflows", c.list).Methods("GET")
+	r.HandleFunc("/api/workflows", c.create).Methods("PUT")
+	r.HandleFunc("/api/workflows/{id}", c.get).Methods("GET")
+	r.HandleFunc("/api/workflows/{id}", c.update).Methods("POST")
+	r.HandleFunc("/api/workflows/{id}", c.delete).Methods("DELETE")
+	r.HandleFunc("/api/workflows/{id}/run", c.run).Methods("POST")
+	r.HandleFunc("/api/workflows/{id}/run", c.progress).Methods("GET")
+	r.HandleFunc("/api/workflows/{id}/confirm", c.confirm).Methods("POST")
+	r.HandleFunc("/api/workflows/{id}/abort", c.abort).Methods("POST")
+}
+
+func (c *Controller) get(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.Get(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) list(w http.ResponseWriter, r *http.Request) {
+	fn := func() (interface{}, error) {
+		return c.List()
+	}
+	utils.JSONListResponse(fn, w, r)
+}
+
+func (c *Controller) create(w http.ResponseWriter, r *http.Request) {
+	var wf Workflow
+	fn := func() error {
+		return c.Create(wf)
+	}
+	utils.JSONCreateResponse(&wf, fn, w, r)
+}
+
+func (c *Controller) update(w http.ResponseWriter, r *http.Request) {
+	var wf Workflow
+	fn := func(id string) error {
+		return c.Update(id, wf)
+	}
+	utils.JSONUpdateResponse(&wf, fn, w, r)
+}
+
+func (c *Controller) delete(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Delete(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) run(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Run(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) progress(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) (interface{}, error) {
+		return c.Progress(id)
+	}
+	utils.JSONGetResponse(fn, w, r)
+}
+
+func (c *Controller) confirm(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Confirm(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
+
+func (c *Controller) abort(w http.ResponseWriter, r *http.Request) {
+	fn := func(id string) error {
+		return c.Abort(id)
+	}
+	utils.JSONDeleteResponse(fn, w, r)
+}
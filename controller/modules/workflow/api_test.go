@@ -0,0 +1,229 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/connectors"
+	"github.com/reef-pi/reef-pi/controller/modules/equipment"
+	"github.com/reef-pi/reef-pi/controller/storage"
+	"github.com/reef-pi/reef-pi/controller/utils"
+)
+
+type testController struct {
+	controller.Controller
+	eqs *equipment.Controller
+}
+
+func (t *testController) Subsystem(_ string) (controller.Subsystem, error) {
+	return t.eqs, nil
+}
+
+func waitFor(t *testing.T, c *Controller, id, state string) Run {
+	for i := 0; i < 100; i++ {
+		r, err := c.Progress(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.State == state {
+			return r
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for workflow state:", state)
+	return Run{}
+}
+
+func TestWorkflowAPI(t *testing.T) {
+	con, err := controller.TestController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer con.Store().Close()
+	if err := con.DM().Setup(); err != nil {
+		t.Fatal(err)
+	}
+	con.DM().Outlets().DevMode = true
+	if err := con.DM().Outlets().Create(connectors.Outlet{Name: "return", Pin: 21, Driver: "rpi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Outlets().Create(connectors.Outlet{Name: "drain", Pin: 20, Driver: "rpi"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := con.DM().Inlets().Create(connectors.Inlet{Name: "low-level", Pin: 16, Driver: "rpi"}); err != nil {
+		t.Fatal(err)
+	}
+	eqs := equipment.New(equipment.Config{DevMode: true}, con)
+	if err := eqs.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eqs.Create(equipment.Equipment{Name: "return", Outlet: "1", On: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := eqs.Create(equipment.Equipment{Name: "drain", Outlet: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	c := New(&testController{Controller: con, eqs: eqs})
+	c.pollInterval = 10 * time.Millisecond
+	if err := c.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	tr := utils.NewTestRouter()
+	c.LoadAPI(tr.Router)
+
+	wf := Workflow{
+		Name: "Water change",
+		Steps: []Step{
+			{Name: "turn off return pump", Type: EquipmentStepType, Config: []byte(`{"id":"1","on":false}`)},
+			{Name: "drain", Type: InletStepType, Timeout: 5, Config: []byte(`{"equipment":"2","inlet":"1","value":0}`)},
+			{Name: "confirm", Type: ConfirmStepType, Timeout: 5, Config: []byte(`{"message":"Add new salt water"}`)},
+			{Name: "restore", Type: RestoreStepType},
+		},
+	}
+	body := new(bytes.Buffer)
+	enc := json.NewEncoder(body)
+	enc.Encode(wf)
+	if err := tr.Do("PUT", "/api/workflows", body, nil); err != nil {
+		t.Fatal("Failed to create workflow using api. Error:", err)
+	}
+	invalid := Workflow{Name: "invalid", Steps: []Step{{Type: ConfirmStepType, Config: []byte(`{}`)}}}
+	body.Reset()
+	enc.Encode(invalid)
+	if err := tr.Do("PUT", "/api/workflows", body, nil); err == nil {
+		t.Error("Confirmation step without timeout should fail")
+	}
+	if err := tr.Do("GET", "/api/workflows/1/run", strings.NewReader("{}"), nil); err == nil {
+		t.Error("Progress of workflow that has not run should fail")
+	}
+	if err := tr.Do("POST", "/api/workflows/1/run", strings.NewReader("{}"), nil); err != nil {
+		t.Fatal("Failed to run workflow using api. Error:", err)
+	}
+	if err := c.Run("1"); err == nil {
+		t.Error("Running an active workflow should fail")
+	}
+	r := waitFor(t, c, "1", Waiting)
+	if r.Current != 2 {
+		t.Error("Expected workflow to wait at step 3, found:", r.Current+1)
+	}
+	if e, _ := eqs.Get("1"); e.On {
+		t.Error("Return pump should be off while waiting for confirmation")
+	}
+	if err := tr.Do("DELETE", "/api/workflows/1", strings.NewReader("{}"), nil); err == nil {
+		t.Error("Deleting a running workflow should fail")
+	}
+	if err := tr.Do("POST", "/api/workflows/1/confirm", strings.NewReader("{}"), nil); err != nil {
+		t.Fatal("Failed to confirm workflow using api. Error:", err)
+	}
+	r = waitFor(t, c, "1", Completed)
+	for i, s := range r.Steps {
+		if s.Status != Completed {
+			t.Error("Expected step", i+1, "to be completed, found:", s.Status)
+		}
+	}
+	if e, _ := eqs.Get("1"); !e.On {
+		t.Error("Return pump should be restored after workflow completion")
+	}
+	if err := tr.Do("POST", "/api/workflows/1/confirm", strings.NewReader("{}"), nil); err == nil {
+		t.Error("Confirming a completed workflow should fail")
+	}
+
+	// abort rolls back equipment changes
+	if err := c.On("1", true); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, c, "1", Waiting)
+	if err := tr.Do("POST", "/api/workflows/1/abort", strings.NewReader("{}"), nil); err != nil {
+		t.Fatal("Failed to abort workflow using api. Error:", err)
+	}
+	r = waitFor(t, c, "1", Aborted)
+	if r.Steps[2].Status != Aborted || r.Steps[3].Status != Pending {
+		t.Error("Unexpected step states after abort:", r.Steps)
+	}
+	if e, _ := eqs.Get("1"); !e.On {
+		t.Error("Return pump should be restored after abort")
+	}
+	if err := c.On("1", false); err == nil {
+		t.Error("Aborting a finished workflow should fail")
+	}
+
+	// inlet never reaches expected value, step times out and rolls back
+	wf.Steps = []Step{
+		{Name: "turn off return pump", Type: EquipmentStepType, Config: []byte(`{"id":"1","on":false}`)},
+		{Name: "refill", Type: InletStepType, Timeout: 1, Config: []byte(`{"equipment":"2","inlet":"1","value":1}`)},
+	}
+	body.Reset()
+	enc.Encode(wf)
+	if err := tr.Do("POST", "/api/workflows/1", body, nil); err != nil {
+		t.Fatal("Failed to update workflow using api. Error:", err)
+	}
+	if err := c.Run("1"); err != nil {
+		t.Fatal(err)
+	}
+	r = waitFor(t, c, "1", Failed)
+	if r.Error == "" {
+		t.Error("Timed out workflow should report error")
+	}
+	if e, _ := eqs.Get("1"); !e.On {
+		t.Error("Return pump should be restored after timeout")
+	}
+	if e, _ := eqs.Get("2"); e.On {
+		t.Error("Refill pump should be switched off after timeout")
+	}
+
+	deps, err := c.InUse(storage.EquipmentBucket, "2")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(deps) != 1 {
+		t.Error("Expected equipment to be used by one step, found:", len(deps))
+	}
+	deps, err = c.InUse(storage.InletBucket, "1")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(deps) != 1 {
+		t.Error("Expected inlet to be used by one step, found:", len(deps))
+	}
+	// inlet can not be read, step keeps polling until it times out
+	wf.Steps = []Step{
+		{Name: "refill", Type: InletStepType, Timeout: 1, Config: []byte(`{"equipment":"2","inlet":"9","value":1}`)},
+	}
+	body.Reset()
+	enc.Encode(wf)
+	if err := tr.Do("POST", "/api/workflows/1", body, nil); err != nil {
+		t.Fatal("Failed to update workflow using api. Error:", err)
+	}
+	start := time.Now()
+	if err := c.Run("1"); err != nil {
+		t.Fatal(err)
+	}
+	r = waitFor(t, c, "1", Failed)
+	if time.Since(start) < time.Second {
+		t.Error("Inlet read errors should not fail the step before it times out")
+	}
+	if !strings.Contains(r.Error, "timed out") {
+		t.Error("Step with failing inlet reads should time out, found:", r.Error)
+	}
+	if e, _ := eqs.Get("2"); e.On {
+		t.Error("Refill pump should be switched off after timeout")
+	}
+
+	if _, err := c.InUse("foo", "1"); err == nil {
+		t.Error("Unknown dependency type should fail")
+	}
+	if err := tr.Do("GET", "/api/workflows/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to get workflow using api. Error:", err)
+	}
+	if err := tr.Do("GET", "/api/workflows", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to list workflows using api. Error:", err)
+	}
+	if err := tr.Do("DELETE", "/api/workflows/1", strings.NewReader("{}"), nil); err != nil {
+		t.Error("Failed to delete workflow using api. Error:", err)
+	}
+	c.Stop()
+}
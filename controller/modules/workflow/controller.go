@@ -0,0 +1,93 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const Bucket = storage.WorkflowBucket
+
+type Controller struct {
+	c            controller.Controller
+	mu           *sync.Mutex
+	runs         map[string]*Run
+	pollInterval time.Duration
+}
+
+func New(c controller.Controller) *Controller {
+	return &Controller{
+		c:            c,
+		mu:           &sync.Mutex{},
+		runs:         make(map[string]*Run),
+		pollInterval: time.Second,
+	}
+}
+
+func (c *Controller) Setup() error {
+	return c.c.Store().CreateBucket(Bucket)
+}
+
+func (c *Controller) Start() {
+}
+
+func (c *Controller) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, r := range c.runs {
+		if r.active() {
+			log.Println("workflow sub-system: aborting running workflow:", id)
+			r.stop()
+		}
+	}
+}
+
+// On starts the workflow when b is true, and aborts a running one otherwise
+func (c *Controller) On(id string, b bool) error {
+	if b {
+		return c.Run(id)
+	}
+	return c.Abort(id)
+}
+
+func (c *Controller) InUse(depType, id string) ([]string, error) {
+	var deps []string
+	switch depType {
+	case storage.EquipmentBucket, storage.InletBucket:
+		ws, err := c.List()
+		if err != nil {
+			return deps, err
+		}
+		for _, w := range ws {
+			for i, s := range w.Steps {
+				var used bool
+				switch s.Type {
+				case EquipmentStepType:
+					var es EquipmentStep
+					if err := json.Unmarshal(s.Config, &es); err != nil {
+						return deps, err
+					}
+					used = depType == storage.EquipmentBucket && es.ID == id
+				case InletStepType:
+					var is InletStep
+					if err := json.Unmarshal(s.Config, &is); err != nil {
+						return deps, err
+					}
+					used = (depType == storage.EquipmentBucket && is.Equipment == id) ||
+						(depType == storage.InletBucket && is.Inlet == id)
+				}
+				if used {
+					deps = append(deps, fmt.Sprintf("%s(step: %d)", w.Name, i+1))
+				}
+			}
+		}
+		return deps, nil
+	default:
+		return deps, fmt.Errorf("unknown dependency type:%s", depType)
+	}
+}
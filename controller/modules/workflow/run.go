@@ -0,0 +1,301 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/reef-pi/reef-pi/controller/modules/equipment"
+	"github.com/reef-pi/reef-pi/controller/storage"
+)
+
+const (
+	Pending   = "pending"
+	Running   = "running"
+	Waiting   = "waiting"
+	Completed = "completed"
+	Aborted   = "aborted"
+	Failed    = "failed"
+)
+
+var errAborted = errors.New("workflow aborted")
+
+type StepProgress struct {
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Error  string    `json:"error"`
+}
+
+// Run tracks the progress of a single workflow execution
+type Run struct {
+	Workflow string         `json:"workflow"`
+	State    string         `json:"state"`
+	Current  int            `json:"current"`
+	Steps    []StepProgress `json:"steps"`
+	Start    time.Time      `json:"start"`
+	End      time.Time      `json:"end"`
+	Error    string         `json:"error"`
+	abort    chan struct{}
+	confirm  chan struct{}
+	original map[string]bool
+	touched  []string
+}
+
+func (r *Run) active() bool {
+	return r.State == Running || r.State == Waiting
+}
+
+func (r *Run) stop() {
+	select {
+	case <-r.abort:
+	default:
+		close(r.abort)
+	}
+}
+
+func (c *Controller) isRunning(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.runs[id]
+	return ok && r.active()
+}
+
+func (c *Controller) Run(id string) error {
+	w, err := c.Get(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.runs[id]; ok && r.active() {
+		return fmt.Errorf("Workflow '%s' is already running", w.Name)
+	}
+	r := &Run{
+		Workflow: id,
+		State:    Running,
+		Start:    time.Now(),
+		abort:    make(chan struct{}),
+		confirm:  make(chan struct{}, 1),
+		original: make(map[string]bool),
+	}
+	for _, s := range w.Steps {
+		r.Steps = append(r.Steps, StepProgress{Name: s.Name, Status: Pending})
+	}
+	c.runs[id] = r
+	go c.execute(w, r)
+	return nil
+}
+
+// Progress returns a snapshot of the latest run of a workflow
+func (c *Controller) Progress(id string) (Run, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.runs[id]
+	if !ok {
+		return Run{}, fmt.Errorf("Workflow '%s' has not been run", id)
+	}
+	p := *r
+	p.Steps = make([]StepProgress, len(r.Steps))
+	copy(p.Steps, r.Steps)
+	return p, nil
+}
+
+func (c *Controller) Confirm(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.runs[id]
+	if !ok || r.State != Waiting {
+		return fmt.Errorf("Workflow '%s' is not waiting for confirmation", id)
+	}
+	select {
+	case r.confirm <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *Controller) Abort(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.runs[id]
+	if !ok || !r.active() {
+		return fmt.Errorf("Workflow '%s' is not running", id)
+	}
+	r.stop()
+	return nil
+}
+
+func (c *Controller) execute(w Workflow, r *Run) {
+	log.Println("workflow sub-system. Running:", w.Name)
+	for i, s := range w.Steps {
+		c.mu.Lock()
+		r.Current = i
+		r.Steps[i].Status = Running
+		r.Steps[i].Start = time.Now()
+		c.mu.Unlock()
+		err := c.runStep(s, r)
+		c.mu.Lock()
+		r.Steps[i].End = time.Now()
+		c.mu.Unlock()
+		if err != nil {
+			state := Failed
+			if err == errAborted {
+				state = Aborted
+			}
+			log.Println("ERROR: workflow sub-system. Step:", i+1, "of workflow", w.Name, state, ". Error:", err)
+			c.c.LogError("workflow-"+w.ID, fmt.Sprintf("Workflow '%s' %s at step %d. Error: %s", w.Name, state, i+1, err))
+			c.restore(r)
+			c.mu.Lock()
+			r.Steps[i].Status = state
+			r.Steps[i].Error = err.Error()
+			r.State = state
+			r.Error = err.Error()
+			r.End = time.Now()
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Lock()
+		r.Steps[i].Status = Completed
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	r.State = Completed
+	r.End = time.Now()
+	c.mu.Unlock()
+	log.Println("workflow sub-system. Finished:", w.Name)
+}
+
+func (c *Controller) runStep(s Step, r *Run) error {
+	var timeout <-chan time.Time
+	if s.Timeout > 0 {
+		t := time.NewTimer(s.Timeout * time.Second)
+		defer t.Stop()
+		timeout = t.C
+	}
+	timedOut := fmt.Errorf("step timed out after %d second(s)", s.Timeout)
+	switch s.Type {
+	case EquipmentStepType:
+		var es EquipmentStep
+		if err := json.Unmarshal(s.Config, &es); err != nil {
+			return err
+		}
+		return c.switchEquipment(r, es.ID, es.On)
+	case InletStepType:
+		var is InletStep
+		if err := json.Unmarshal(s.Config, &is); err != nil {
+			return err
+		}
+		if err := c.switchEquipment(r, is.Equipment, true); err != nil {
+			return err
+		}
+		ticker := time.NewTicker(c.pollInterval)
+		defer ticker.Stop()
+		// read errors do not end the step, it keeps polling until it times out
+		var readErr error
+		for {
+			v, err := c.c.DM().Inlets().Read(is.Inlet)
+			switch {
+			case err != nil:
+				readErr = err
+				log.Println("ERROR: workflow sub-system. Failed to read inlet:", is.Inlet, ", retrying. Error:", err)
+			case v == is.Value:
+				return c.switchEquipment(r, is.Equipment, false)
+			}
+			select {
+			case <-ticker.C:
+			case <-timeout:
+				if readErr != nil {
+					return fmt.Errorf("%s. Last read error: %w", timedOut, readErr)
+				}
+				return timedOut
+			case <-r.abort:
+				return errAborted
+			}
+		}
+	case ConfirmStepType:
+		c.mu.Lock()
+		r.State = Waiting
+		r.Steps[r.Current].Status = Waiting
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			if r.State == Waiting {
+				r.State = Running
+			}
+			c.mu.Unlock()
+		}()
+		select {
+		case <-r.confirm:
+			return nil
+		case <-timeout:
+			return timedOut
+		case <-r.abort:
+			return errAborted
+		}
+	case WaitStepType:
+		var ws WaitStep
+		if err := json.Unmarshal(s.Config, &ws); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(ws.Duration * time.Second):
+			return nil
+		case <-timeout:
+			return timedOut
+		case <-r.abort:
+			return errAborted
+		}
+	case RestoreStepType:
+		c.restore(r)
+		return nil
+	default:
+		return fmt.Errorf("Unknown step type:%s", s.Type)
+	}
+}
+
+// switchEquipment records the original state of an equipment the first time a
+// run touches it, so that it can be restored on completion or rollback
+func (c *Controller) switchEquipment(r *Run, id string, on bool) error {
+	sub, err := c.c.Subsystem(storage.EquipmentBucket)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if _, ok := r.original[id]; !ok {
+		prev := !on
+		if eqs, ok := sub.(*equipment.Controller); ok {
+			if e, err := eqs.Get(id); err == nil {
+				prev = e.On
+			}
+		}
+		r.original[id] = prev
+		r.touched = append(r.touched, id)
+	}
+	c.mu.Unlock()
+	log.Println("workflow sub-system: switching equipment:", id, "on:", on)
+	return sub.On(id, on)
+}
+
+func (c *Controller) restore(r *Run) {
+	sub, err := c.c.Subsystem(storage.EquipmentBucket)
+	if err != nil {
+		log.Println("ERROR: workflow sub-system: equipment sub-system is not available. Error:", err)
+		return
+	}
+	c.mu.Lock()
+	touched := r.touched
+	original := r.original
+	r.touched = []string{}
+	r.original = make(map[string]bool)
+	c.mu.Unlock()
+	for i := len(touched) - 1; i >= 0; i-- {
+		id := touched[i]
+		if err := sub.On(id, original[id]); err != nil {
+			log.Println("ERROR: workflow sub-system: Failed to restore equipment:", id, "Error:", err)
+		}
+	}
+}
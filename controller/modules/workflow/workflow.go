@@ -0,0 +1,174 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	EquipmentStepType = "equipment"
+	InletStepType     = "until_inlet"
+	ConfirmStepType   = "confirm"
+	WaitStepType      = "wait"
+	RestoreStepType   = "restore"
+)
+
+// EquipmentStep switches an equipment on or off
+type EquipmentStep struct {
+	ID string `json:"id"`
+	On bool   `json:"on"`
+}
+
+// InletStep switches an equipment on until an inlet reads the expected value,
+// e.g. drain until the low level float reads 0 or refill until it reads 1
+type InletStep struct {
+	Equipment string `json:"equipment"`
+	Inlet     string `json:"inlet"`
+	Value     int    `json:"value"`
+}
+
+// ConfirmStep pauses the workflow until the user confirms via API
+type ConfirmStep struct {
+	Message string `json:"message"`
+}
+
+type WaitStep struct {
+	Duration time.Duration `json:"duration"`
+}
+
+// Step is a single workflow step. Timeout (in seconds) bounds how long the
+// step can run before the workflow is aborted and rolled back, zero disables it.
+type Step struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Timeout time.Duration   `json:"timeout"`
+	Config  json.RawMessage `json:"config"`
+}
+
+type Workflow struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+func (s Step) Validate() error {
+	if s.Timeout < 0 {
+		return fmt.Errorf("Timeout can not be negative. Supplied: %d", s.Timeout)
+	}
+	switch s.Type {
+	case EquipmentStepType:
+		var es EquipmentStep
+		if err := json.Unmarshal(s.Config, &es); err != nil {
+			return err
+		}
+		if es.ID == "" {
+			return fmt.Errorf("Missing equipment")
+		}
+	case InletStepType:
+		var is InletStep
+		if err := json.Unmarshal(s.Config, &is); err != nil {
+			return err
+		}
+		if is.Equipment == "" {
+			return fmt.Errorf("Missing equipment")
+		}
+		if is.Inlet == "" {
+			return fmt.Errorf("Missing inlet")
+		}
+		if is.Value != 0 && is.Value != 1 {
+			return fmt.Errorf("Inlet value should be 0 or 1. Supplied: %d", is.Value)
+		}
+		if s.Timeout == 0 {
+			return fmt.Errorf("Inlet step requires a timeout")
+		}
+	case ConfirmStepType:
+		var cs ConfirmStep
+		if err := json.Unmarshal(s.Config, &cs); err != nil {
+			return err
+		}
+		if s.Timeout == 0 {
+			return fmt.Errorf("Confirmation step requires a timeout")
+		}
+	case WaitStepType:
+		var ws WaitStep
+		if err := json.Unmarshal(s.Config, &ws); err != nil {
+			return err
+		}
+		if ws.Duration <= 0 {
+			return fmt.Errorf("Wait duration should be positive. Supplied: %d", ws.Duration)
+		}
+	case RestoreStepType:
+	default:
+		return fmt.Errorf("Unknown step type:%s", s.Type)
+	}
+	return nil
+}
+
+func (w Workflow) Validate() error {
+	if w.Name == "" {
+		return fmt.Errorf("Missing workflow name")
+	}
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("Workflow should have at least one step")
+	}
+	for i, s := range w.Steps {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("Invalid step %d. Error: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) Get(id string) (Workflow, error) {
+	var w Workflow
+	return w, c.c.Store().Get(Bucket, id, &w)
+}
+
+func (c *Controller) List() ([]Workflow, error) {
+	ws := []Workflow{}
+	fn := func(_ string, v []byte) error {
+		var w Workflow
+		if err := json.Unmarshal(v, &w); err != nil {
+			return err
+		}
+		ws = append(ws, w)
+		return nil
+	}
+	return ws, c.c.Store().List(Bucket, fn)
+}
+
+func (c *Controller) Create(w Workflow) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	fn := func(id string) interface{} {
+		w.ID = id
+		return &w
+	}
+	return c.c.Store().Create(Bucket, fn)
+}
+
+func (c *Controller) Update(id string, w Workflow) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if c.isRunning(id) {
+		return fmt.Errorf("Workflow is running")
+	}
+	w.ID = id
+	return c.c.Store().Update(Bucket, id, w)
+}
+
+func (c *Controller) Delete(id string) error {
+	if c.isRunning(id) {
+		return fmt.Errorf("Workflow is running")
+	}
+	if err := c.c.Store().Delete(Bucket, id); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.runs, id)
+	c.mu.Unlock()
+	return nil
+}
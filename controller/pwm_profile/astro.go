@@ -0,0 +1,148 @@
+package pwm_profile
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Low precision solar and lunar ephemeris, good to about a minute for sunrise
+// and sunset and a percent for lunar illumination, which is plenty for lighting.
+// Angles are in degrees unless stated otherwise.
+
+const (
+	_j2000           = 2451545.0
+	_sunriseAltitude = -0.833 // accounts for refraction and the solar disc radius
+)
+
+func julianDay(t time.Time) float64 {
+	return float64(t.UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+func sinDeg(d float64) float64 { return math.Sin(d * math.Pi / 180) }
+func cosDeg(d float64) float64 { return math.Cos(d * math.Pi / 180) }
+
+func normalizeDegrees(d float64) float64 {
+	d = math.Mod(d, 360)
+	if d < 0 {
+		d += 360
+	}
+	return d
+}
+
+// sunPosition returns the right ascension and declination of the sun, and
+// the equation of time in minutes
+func sunPosition(t time.Time) (ra, dec, eot float64) {
+	n := julianDay(t) - _j2000
+	l := normalizeDegrees(280.460 + 0.9856474*n)
+	g := 357.528 + 0.9856003*n
+	lambda := l + 1.915*sinDeg(g) + 0.020*sinDeg(2*g)
+	e := 23.439 - 0.0000004*n
+	ra = normalizeDegrees(math.Atan2(cosDeg(e)*sinDeg(lambda), cosDeg(lambda)) * 180 / math.Pi)
+	dec = math.Asin(sinDeg(e)*sinDeg(lambda)) * 180 / math.Pi
+	diff := l - ra
+	if diff > 180 {
+		diff -= 360
+	}
+	if diff < -180 {
+		diff += 360
+	}
+	return ra, dec, 4 * diff
+}
+
+// SolarElevation returns the altitude of the sun above the horizon in degrees
+func SolarElevation(t time.Time, lat, lon float64) float64 {
+	ra, dec, _ := sunPosition(t)
+	n := julianDay(t) - _j2000
+	gmst := normalizeDegrees(280.46061837 + 360.98564736629*n)
+	ha := gmst + lon - ra
+	return math.Asin(sinDeg(lat)*sinDeg(dec)+cosDeg(lat)*cosDeg(dec)*cosDeg(ha)) * 180 / math.Pi
+}
+
+// SolarNoon returns the solar noon at the given longitude closest to t
+func SolarNoon(t time.Time, lon float64) time.Time {
+	u := t.UTC()
+	day := time.Date(u.Year(), u.Month(), u.Day(), 0, 0, 0, 0, time.UTC)
+	noon := day.Add(time.Duration((12 - lon/15) * float64(time.Hour)))
+	_, _, eot := sunPosition(noon)
+	noon = noon.Add(time.Duration(-eot * float64(time.Minute)))
+	switch {
+	case t.Sub(noon) > 12*time.Hour:
+		return SolarNoon(noon.Add(24*time.Hour), lon)
+	case noon.Sub(t) > 12*time.Hour:
+		return SolarNoon(noon.Add(-24*time.Hour), lon)
+	}
+	return noon.In(t.Location())
+}
+
+// Daylight returns the sunrise and sunset around the solar noon closest to t.
+// ok is false during polar day or night, when polarDay tells which one it is.
+func Daylight(t time.Time, lat, lon float64) (sunrise, sunset time.Time, ok, polarDay bool) {
+	noon := SolarNoon(t, lon)
+	_, dec, _ := sunPosition(noon)
+	c := (sinDeg(_sunriseAltitude) - sinDeg(lat)*sinDeg(dec)) / (cosDeg(lat) * cosDeg(dec))
+	if c < -1 {
+		return noon, noon, false, true
+	}
+	if c > 1 {
+		return noon, noon, false, false
+	}
+	h := math.Acos(c) * 180 / math.Pi / 15
+	half := time.Duration(h * float64(time.Hour))
+	return noon.Add(-half), noon.Add(half), true, false
+}
+
+// MoonPhase returns the lunar phase as a fraction of the synodic month
+// (0 new moon, 0.5 full moon) and the illuminated fraction of the disc
+func MoonPhase(t time.Time) (phase, illumination float64) {
+	c := (julianDay(t) - _j2000) / 36525
+	d := 297.8501921 + 445267.1114034*c
+	m := 357.5291092 + 35999.0502909*c
+	mp := 134.9633964 + 477198.8675055*c
+	elongation := d + 6.289*sinDeg(mp) - 2.100*sinDeg(m) + 1.274*sinDeg(2*d-mp) + 0.658*sinDeg(2*d) + 0.214*sinDeg(2*mp) + 0.110*sinDeg(d)
+	elongation = normalizeDegrees(elongation)
+	return elongation / 360, (1 - cosDeg(elongation)) / 2
+}
+
+// astro holds the location and time shift shared by astronomical profiles.
+// Shift delays the sky, i.e. the value at time t is computed for t - shift,
+// which lets a remote reef's photoperiod line up with local hours.
+type astro struct {
+	min, max  float64
+	shift     time.Duration
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Shift     string  `json:"shift"`
+}
+
+func (a *astro) Build(min, max float64) error {
+	if a.Latitude < -90 || a.Latitude > 90 {
+		return fmt.Errorf("latitude should be between -90 and 90, supplied:%f", a.Latitude)
+	}
+	if a.Longitude < -180 || a.Longitude > 180 {
+		return fmt.Errorf("longitude should be between -180 and 180, supplied:%f", a.Longitude)
+	}
+	if a.Shift != "" {
+		shift, err := time.ParseDuration(a.Shift)
+		if err != nil {
+			return fmt.Errorf("Failed to parse shift. Error:%s", err)
+		}
+		a.shift = shift
+	}
+	if max == 0 {
+		max = 100
+	}
+	if min < 0 {
+		return fmt.Errorf("minimum should be 0 or above, supplied:%f", min)
+	}
+	if max > 100 || max <= min {
+		return fmt.Errorf("maximum should be equal or less than 100 and above minimum, supplied:%f", max)
+	}
+	a.min = min
+	a.max = max
+	return nil
+}
+
+func (a *astro) skyTime(t time.Time) time.Time {
+	return t.Add(-a.shift)
+}
@@ -0,0 +1,127 @@
+package pwm_profile
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(t1, t2 time.Time, d time.Duration) bool {
+	diff := t1.Sub(t2)
+	return diff < d && diff > -d
+}
+
+func TestAstro(t *testing.T) {
+	// London, summer solstice 2024: sunrise 03:43 UTC, sunset 20:21 UTC
+	day := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+	sunrise, sunset, ok, _ := Daylight(day, 51.5074, -0.1278)
+	if !ok {
+		t.Fatal("Expected sunrise and sunset in London")
+	}
+	if !near(sunrise, time.Date(2024, 6, 21, 3, 43, 0, 0, time.UTC), 3*time.Minute) {
+		t.Error("Unexpected sunrise:", sunrise)
+	}
+	if !near(sunset, time.Date(2024, 6, 21, 20, 21, 0, 0, time.UTC), 3*time.Minute) {
+		t.Error("Unexpected sunset:", sunset)
+	}
+	if e := SolarElevation(SolarNoon(day, -0.1278), 51.5074, -0.1278); math.Abs(e-61.9) > 0.5 {
+		t.Error("Expected noon elevation of 61.9, found:", e)
+	}
+	// Tromsø has midnight sun in June and polar night in December
+	if _, _, ok, polarDay := Daylight(day, 69.65, 18.96); ok || !polarDay {
+		t.Error("Expected polar day in Tromsø")
+	}
+	if _, _, ok, polarDay := Daylight(time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC), 69.65, 18.96); ok || polarDay {
+		t.Error("Expected polar night in Tromsø")
+	}
+
+	// new moon on Jan 11 2024 11:57 UTC and full moon on Jan 25 2024 17:54 UTC
+	phase, i := MoonPhase(time.Date(2024, 1, 11, 11, 57, 0, 0, time.UTC))
+	if i > 0.01 || (phase > 0.01 && phase < 0.99) {
+		t.Error("Expected new moon, found phase:", phase, "illumination:", i)
+	}
+	phase, i = MoonPhase(time.Date(2024, 1, 25, 17, 54, 0, 0, time.UTC))
+	if i < 0.99 || math.Abs(phase-0.5) > 0.01 {
+		t.Error("Expected full moon, found phase:", phase, "illumination:", i)
+	}
+	if phase, i = MoonPhase(time.Date(2024, 1, 18, 3, 52, 0, 0, time.UTC)); math.Abs(i-0.5) > 0.03 || phase > 0.5 {
+		t.Error("Expected waxing first quarter, found phase:", phase, "illumination:", i)
+	}
+}
+
+func TestSolar(t *testing.T) {
+	s, err := Solar([]byte(`{"latitude":51.5074,"longitude":-0.1278}`), 10, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != _solarProfileName {
+		t.Error("Unexpected profile name:", s.Name())
+	}
+	noon := SolarNoon(time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC), -0.1278)
+	if v := s.Get(noon); math.Abs(v-90) > 0.01 {
+		t.Error("Expected max at solar noon, found:", v)
+	}
+	if v := s.Get(noon.Add(-4 * time.Hour)); v <= 10 || v >= 90 {
+		t.Error("Expected intermediate value in the morning, found:", v)
+	}
+	if v := s.Get(time.Date(2024, 6, 21, 23, 0, 0, 0, time.UTC)); v != 0 {
+		t.Error("Expected 0 at night, found:", v)
+	}
+
+	// Fiji sky shifted by 12 hours peaks around UTC midnight + 12h
+	f, err := Solar([]byte(`{"latitude":-17.7,"longitude":178.0,"shift":"12h"}`), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fijiNoon := SolarNoon(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), 178.0)
+	if v := f.Get(fijiNoon.Add(12 * time.Hour)); math.Abs(v-100) > 0.01 {
+		t.Error("Expected shifted max, found:", v)
+	}
+	if v := f.Get(fijiNoon); v != 0 {
+		t.Error("Expected shifted profile to be dark at Fiji noon, found:", v)
+	}
+	for _, conf := range []string{
+		`{"latitude":91,"longitude":0}`,
+		`{"latitude":0,"longitude":-181}`,
+		`{"latitude":0,"longitude":0,"shift":"foo"}`,
+		`[]`,
+	} {
+		if _, err := Solar([]byte(conf), 0, 100); err == nil {
+			t.Error("Expected error for config:", conf)
+		}
+	}
+	if _, err := Solar([]byte(`{}`), 50, 40); err == nil {
+		t.Error("Expected error when max is below min")
+	}
+}
+
+func TestMoon(t *testing.T) {
+	m, err := Moon([]byte(`{"latitude":51.5074,"longitude":-0.1278}`), 0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name() != _moonProfileName {
+		t.Error("Unexpected profile name:", m.Name())
+	}
+	if v := m.Get(time.Date(2024, 1, 25, 12, 0, 0, 0, time.UTC)); v != 0 {
+		t.Error("Expected 0 during the day, found:", v)
+	}
+	full := m.Get(time.Date(2024, 1, 26, 0, 15, 0, 0, time.UTC))
+	if full < 19 {
+		t.Error("Expected near max around midnight of full moon, found:", full)
+	}
+	if v := m.Get(time.Date(2024, 1, 26, 5, 0, 0, 0, time.UTC)); v <= 0 || v >= full {
+		t.Error("Expected moonlight to fade towards sunrise, found:", v)
+	}
+	if v := m.Get(time.Date(2024, 1, 11, 0, 15, 0, 0, time.UTC)); v > 0.5 {
+		t.Error("Expected near darkness around new moon, found:", v)
+	}
+	p := ProfileSpec{Type: _moonProfileName, Config: []byte(`{"latitude":0,"longitude":0}`), Max: 10}
+	if _, err := p.CreateProfile(); err != nil {
+		t.Error(err)
+	}
+	p.Type = _solarProfileName
+	if _, err := p.CreateProfile(); err != nil {
+		t.Error(err)
+	}
+}
@@ -16,6 +16,10 @@ const (
 	_intervalProfileName  = "interval"
 	_sineProfileName      = "sine"
 	_randomProfileName    = "random"
+	_solarProfileName     = "solar"
+	_moonProfileName      = "moon"
+	_weatherProfileName   = "weather"
+	_keyframeProfileName  = "keyframe"
 )
 
 type Profile interface {
@@ -57,6 +61,14 @@ func (p *ProfileSpec) CreateProfile() (Profile, error) {
 		return Sine(p.Config, p.Min, p.Max)
 	case _randomProfileName:
 		return Random(p.Config, p.Min, p.Max)
+	case _solarProfileName:
+		return Solar(p.Config, p.Min, p.Max)
+	case _moonProfileName:
+		return Moon(p.Config, p.Min, p.Max)
+	case _weatherProfileName:
+		return NewWeather(p.Config, p.Min, p.Max)
+	case _keyframeProfileName:
+		return NewKeyframe(p.Config, p.Min, p.Max)
 	default:
 		return nil, fmt.Errorf("unknown profile type: %s", p.Type)
 	}
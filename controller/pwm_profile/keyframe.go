@@ -0,0 +1,135 @@
+package pwm_profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	LinearInterpolation = "linear"
+	CosineInterpolation = "cosine"
+	SplineInterpolation = "spline"
+)
+
+type Keyframe struct {
+	Time  string  `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// keyframe interpolates between arbitrary (time of day, value) points. The
+// value is 0 before the first and after the last point.
+type keyframe struct {
+	Interpolation string     `json:"interpolation"`
+	Points        []Keyframe `json:"points"`
+	min, max      float64
+	xs, ys        []float64
+	m             []float64 // second derivatives for spline interpolation
+}
+
+func (k *keyframe) Name() string {
+	return _keyframeProfileName
+}
+
+func NewKeyframe(conf json.RawMessage, min, max float64) (*keyframe, error) {
+	var k keyframe
+	if err := json.Unmarshal(conf, &k); err != nil {
+		return nil, err
+	}
+	if err := k.Build(min, max); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (k *keyframe) Build(min, max float64) error {
+	switch k.Interpolation {
+	case "":
+		k.Interpolation = LinearInterpolation
+	case LinearInterpolation, CosineInterpolation, SplineInterpolation:
+	default:
+		return fmt.Errorf("unknown interpolation:%s", k.Interpolation)
+	}
+	if len(k.Points) < 2 {
+		return fmt.Errorf("at least two points are required, supplied:%d", len(k.Points))
+	}
+	if max == 0 {
+		max = 100
+	}
+	k.xs = make([]float64, len(k.Points))
+	k.ys = make([]float64, len(k.Points))
+	for i, p := range k.Points {
+		t, err := time.Parse(tFormat, p.Time)
+		if err != nil {
+			return fmt.Errorf("Failed to parse time of point %d. Error:%s", i+1, err)
+		}
+		if p.Value < 0 || p.Value > 100 {
+			return fmt.Errorf("value of point %d should be between 0 and 100, supplied:%f", i+1, p.Value)
+		}
+		k.xs[i] = float64(t.Hour()*3600 + t.Minute()*60 + t.Second())
+		k.ys[i] = p.Value
+		if i > 0 && k.xs[i] <= k.xs[i-1] {
+			return fmt.Errorf("point %d should be after point %d", i+1, i)
+		}
+	}
+	k.min = min
+	k.max = max
+	if k.Interpolation == SplineInterpolation {
+		k.m = naturalSpline(k.xs, k.ys)
+	}
+	return nil
+}
+
+// naturalSpline returns the second derivatives of a natural cubic spline
+// through the given points, solved with the tridiagonal (Thomas) algorithm
+func naturalSpline(xs, ys []float64) []float64 {
+	n := len(xs)
+	m := make([]float64, n)
+	if n < 3 {
+		return m
+	}
+	c := make([]float64, n)
+	d := make([]float64, n)
+	for i := 1; i < n-1; i++ {
+		h0 := xs[i] - xs[i-1]
+		h1 := xs[i+1] - xs[i]
+		a := h0 / 6
+		b := (h0 + h1) / 3
+		cc := h1 / 6
+		r := (ys[i+1]-ys[i])/h1 - (ys[i]-ys[i-1])/h0
+		denom := b - a*c[i-1]
+		c[i] = cc / denom
+		d[i] = (r - a*d[i-1]) / denom
+	}
+	for i := n - 2; i > 0; i-- {
+		m[i] = d[i] - c[i]*m[i+1]
+	}
+	return m
+}
+
+func (k *keyframe) Get(t time.Time) float64 {
+	s := float64(t.Hour()*3600+t.Minute()*60+t.Second()) + float64(t.Nanosecond())/1e9
+	last := len(k.xs) - 1
+	if s < k.xs[0] || s > k.xs[last] {
+		return 0
+	}
+	i := 0
+	for i < last-1 && s > k.xs[i+1] {
+		i++
+	}
+	h := k.xs[i+1] - k.xs[i]
+	mu := (s - k.xs[i]) / h
+	var v float64
+	switch k.Interpolation {
+	case CosineInterpolation:
+		mu = (1 - math.Cos(mu*math.Pi)) / 2
+		v = k.ys[i]*(1-mu) + k.ys[i+1]*mu
+	case SplineInterpolation:
+		a := 1 - mu
+		v = a*k.ys[i] + mu*k.ys[i+1] + ((a*a*a-a)*k.m[i]+(mu*mu*mu-mu)*k.m[i+1])*h*h/6
+	default:
+		v = k.ys[i]*(1-mu) + k.ys[i+1]*mu
+	}
+	return math.Max(0, math.Min(v, k.max))
+}
@@ -0,0 +1,92 @@
+package pwm_profile
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestKeyframe(t *testing.T) {
+	conf := `
+{
+	"points": [
+		{"time":"08:00:00", "value":0},
+		{"time":"10:00:00", "value":60},
+		{"time":"14:00:00", "value":80},
+		{"time":"20:00:00", "value":0}
+	]
+}`
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+
+	k, err := NewKeyframe([]byte(conf), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Name() != _keyframeProfileName || k.Interpolation != LinearInterpolation {
+		t.Error("Unexpected profile name or default interpolation:", k.Name(), k.Interpolation)
+	}
+	for _, c := range []struct {
+		t time.Time
+		v float64
+	}{
+		{at(7, 0), 0},
+		{at(9, 0), 30},
+		{at(10, 0), 60},
+		{at(12, 0), 70},
+		{at(17, 0), 40},
+		{at(21, 0), 0},
+	} {
+		if v := k.Get(c.t); math.Abs(v-c.v) > 0.001 {
+			t.Error("Linear: expected", c.v, "at", c.t.Format(tFormat), "found:", v)
+		}
+	}
+
+	p := ProfileSpec{Type: _keyframeProfileName, Config: []byte(`{"interpolation":"cosine","points":[{"time":"08:00:00","value":0},{"time":"10:00:00","value":60}]}`)}
+	cp, err := p.CreateProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := cp.Get(at(8, 30)); math.Abs(v-60*(1-math.Cos(math.Pi/4))/2) > 0.001 {
+		t.Error("Cosine: unexpected value at 08:30:", v)
+	}
+	if v := cp.Get(at(9, 0)); math.Abs(v-30) > 0.001 {
+		t.Error("Cosine: expected 30 at midpoint, found:", v)
+	}
+
+	s, err := NewKeyframe([]byte(`{"interpolation":"spline","points":[{"time":"08:00:00","value":0},{"time":"10:00:00","value":60},{"time":"14:00:00","value":80},{"time":"20:00:00","value":0}]}`), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []int{8, 10, 14, 20} {
+		if v, e := s.Get(at(h, 0)), k.Get(at(h, 0)); math.Abs(v-e) > 0.001 {
+			t.Error("Spline should pass through points. Expected", e, "at", h, "found:", v)
+		}
+	}
+	// smooth curve bends above the straight line between 10:00 and 14:00
+	if v := s.Get(at(12, 0)); v <= 70 || v > 100 {
+		t.Error("Spline: unexpected value at 12:00:", v)
+	}
+	prev := 0.0
+	for m := 0; m <= 120; m += 5 {
+		v := s.Get(at(8, m))
+		if v < prev {
+			t.Error("Spline should rise between first two points, found", v, "after", prev)
+		}
+		prev = v
+	}
+
+	for _, c := range []string{
+		`{"points":[{"time":"08:00:00","value":0}]}`,
+		`{"interpolation":"foo","points":[{"time":"08:00:00","value":0},{"time":"09:00:00","value":10}]}`,
+		`{"points":[{"time":"09:00:00","value":0},{"time":"08:00:00","value":10}]}`,
+		`{"points":[{"time":"08:00:00","value":0},{"time":"08:00:00","value":10}]}`,
+		`{"points":[{"time":"08:00:00","value":0},{"time":"09:00:00","value":110}]}`,
+		`{"points":[{"time":"8am","value":0},{"time":"09:00:00","value":10}]}`,
+		`[]`,
+	} {
+		if _, err := NewKeyframe([]byte(c), 0, 100); err == nil {
+			t.Error("Expected error for config:", c)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package pwm_profile
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// moon lights up between sunset and sunrise at a given location, following a
+// sine curve whose peak is scaled by the actual illuminated fraction of the moon
+type moon struct {
+	astro
+}
+
+func (m *moon) Name() string {
+	return _moonProfileName
+}
+
+func Moon(conf json.RawMessage, min, max float64) (*moon, error) {
+	var m moon
+	if err := json.Unmarshal(conf, &m); err != nil {
+		return nil, err
+	}
+	if err := m.Build(min, max); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *moon) Get(t time.Time) float64 {
+	sky := m.skyTime(t)
+	_, illumination := MoonPhase(sky)
+	peak := illumination * (m.max - m.min)
+	sunrise, sunset, ok, polarDay := Daylight(sky, m.Latitude, m.Longitude)
+	if !ok {
+		if polarDay {
+			return 0
+		}
+		return m.min + peak
+	}
+	var start, end time.Time
+	switch {
+	case sky.After(sunset):
+		next, _, _, _ := Daylight(sky.Add(12*time.Hour), m.Latitude, m.Longitude)
+		start, end = sunset, next
+	case sky.Before(sunrise):
+		_, prev, _, _ := Daylight(sky.Add(-12*time.Hour), m.Latitude, m.Longitude)
+		start, end = prev, sunrise
+	default:
+		return 0
+	}
+	v := math.Sin(math.Pi * sky.Sub(start).Seconds() / end.Sub(start).Seconds())
+	return m.min + v*peak
+}
@@ -0,0 +1,42 @@
+package pwm_profile
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// solar follows the elevation of the sun at a given location, scaled so that
+// the value peaks at max on each day's solar noon and drops to 0 at night
+type solar struct {
+	astro
+}
+
+func (s *solar) Name() string {
+	return _solarProfileName
+}
+
+func Solar(conf json.RawMessage, min, max float64) (*solar, error) {
+	var s solar
+	if err := json.Unmarshal(conf, &s); err != nil {
+		return nil, err
+	}
+	if err := s.Build(min, max); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *solar) Get(t time.Time) float64 {
+	sky := s.skyTime(t)
+	e := SolarElevation(sky, s.Latitude, s.Longitude)
+	if e <= 0 {
+		return 0
+	}
+	peak := SolarElevation(SolarNoon(sky, s.Longitude), s.Latitude, s.Longitude)
+	if peak <= 0 {
+		return 0
+	}
+	v := math.Min(sinDeg(e)/sinDeg(peak), 1)
+	return s.min + v*(s.max-s.min)
+}
@@ -0,0 +1,118 @@
+package pwm_profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const _diagnosticStep = time.Minute
+
+// Diagnostics lists the problems found in a profile specification. Errors
+// prevent the profile from working as intended, warnings point at settings
+// that are valid but likely unintended.
+type Diagnostics struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+func (d *Diagnostics) errorf(format string, a ...interface{}) {
+	d.Errors = append(d.Errors, fmt.Sprintf(format, a...))
+}
+
+func (d *Diagnostics) warnf(format string, a ...interface{}) {
+	d.Warnings = append(d.Warnings, fmt.Sprintf(format, a...))
+}
+
+// Validate checks the settings profile constructors accept to keep stored
+// profiles loading, like composite profiles without sub-profiles. New and
+// updated profiles should pass it.
+func (p *ProfileSpec) Validate() error {
+	if p.Type != _compositeProfileName {
+		return nil
+	}
+	d := Diagnostics{}
+	diagnoseComposite(*p, &d)
+	if len(d.Errors) > 0 {
+		return errors.New(d.Errors[0])
+	}
+	return nil
+}
+
+// Diagnose builds the profile and evaluates it over a day, catching
+// misconfigurations the constructors accept, like composite spans longer than
+// a day
+func Diagnose(spec ProfileSpec) Diagnostics {
+	d := Diagnostics{Errors: []string{}, Warnings: []string{}}
+	if spec.Type == _compositeProfileName {
+		diagnoseComposite(spec, &d)
+	}
+	if len(d.Errors) == 0 {
+		p, err := spec.CreateProfile()
+		if err != nil {
+			d.errorf("%s", err)
+		} else {
+			diagnoseValues(p, spec, &d)
+		}
+	}
+	d.Valid = len(d.Errors) == 0
+	return d
+}
+
+func diagnoseComposite(spec ProfileSpec, d *Diagnostics) {
+	var comp composite
+	if err := json.Unmarshal(spec.Config, &comp); err != nil {
+		d.errorf("%s", err)
+		return
+	}
+	if len(comp.Profiles) == 0 {
+		d.errorf("composite profile requires at least one sub-profile")
+		return
+	}
+	total := 0
+	for i, p := range comp.Profiles {
+		if p.Span <= 0 {
+			d.errorf("span of sub-profile %d should be positive, supplied:%d", i+1, p.Span)
+			continue
+		}
+		total += p.Span
+		max := spec.Max
+		if max == 0 {
+			max = 100
+		}
+		if p.Min < spec.Min || (p.Max != 0 && p.Max > max) {
+			d.warnf("bounds of sub-profile %d exceed the channel bounds and will be clipped", i+1)
+		}
+	}
+	if total > 86400 {
+		d.errorf("composite spans add up to more than 24h")
+	}
+	if total > 0 && total < 86400 {
+		d.warnf("spans add up to %s, the profile repeats within a day", time.Duration(total)*time.Second)
+	}
+}
+
+func diagnoseValues(p Profile, spec ProfileSpec, d *Diagnostics) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	lit := false
+	for t := midnight; t.Before(midnight.Add(24 * time.Hour)); t = t.Add(_diagnosticStep) {
+		v := p.Get(t)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			d.errorf("profile value is not a number at %s", t.Format(tFormat))
+			return
+		}
+		if v < 0 || v > 100 {
+			d.errorf("profile value %f at %s is out of range", v, t.Format(tFormat))
+			return
+		}
+		lit = lit || v > 0
+	}
+	// moon and weather profiles may legitimately stay dark on some days
+	if !lit && spec.Type != _moonProfileName && spec.Type != _lunarProfileName {
+		d.warnf("profile stays at 0 for the whole day")
+	}
+}
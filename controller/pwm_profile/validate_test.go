@@ -0,0 +1,49 @@
+package pwm_profile
+
+import (
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	spec := ProfileSpec{
+		Type:   "composite",
+		Config: []byte(`{"profiles":[{"type":"diurnal","span":43200},{"type":"fixed","span":50000,"config":{"value":10}}]}`),
+	}
+	d := Diagnose(spec)
+	if d.Valid || len(d.Errors) != 1 {
+		t.Error("Spans adding up to more than a day should be reported. Found:", d.Errors)
+	}
+	if err := spec.Validate(); err == nil {
+		t.Error("Spans adding up to more than a day should fail validation")
+	}
+	spec.Config = []byte(`{"profiles":[{"type":"diurnal","span":43200},{"type":"fixed","span":0,"config":{"value":10}}]}`)
+	if d := Diagnose(spec); d.Valid {
+		t.Error("Zero span should be invalid")
+	}
+	spec.Config = []byte(`{"profiles":[{"type":"diurnal","span":3600,"max":90},{"type":"fixed","span":3600,"config":{"value":10}}]}`)
+	spec.Max = 50
+	d = Diagnose(spec)
+	if !d.Valid {
+		t.Error("Composite repeating within a day should be valid. Found:", d.Errors)
+	}
+	if len(d.Warnings) != 2 {
+		t.Error("Expected warnings for repeating spans and clipped bounds. Found:", d.Warnings)
+	}
+
+	d = Diagnose(ProfileSpec{Type: "fixed", Config: []byte(`{"start":"08:00:00","end":"20:00:00","value":0}`)})
+	if !d.Valid || len(d.Warnings) != 1 {
+		t.Error("Dark profile should be valid with a warning. Found:", d)
+	}
+	if d := Diagnose(ProfileSpec{Type: "foo"}); d.Valid {
+		t.Error("Unknown profile type should be invalid")
+	}
+
+	// stored composites without sub-profiles keep loading
+	empty := ProfileSpec{Type: "composite", Config: []byte(`{"profiles":[]}`)}
+	if _, err := empty.CreateProfile(); err != nil {
+		t.Error("Composite without sub-profiles should load. Error:", err)
+	}
+	if err := empty.Validate(); err == nil {
+		t.Error("Composite without sub-profiles should fail validation")
+	}
+}
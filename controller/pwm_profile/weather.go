@@ -0,0 +1,264 @@
+package pwm_profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	_weatherDailyFormat = "2006-01-02"
+	_maxCloudFrequency  = 60 // cloud passes per hour
+	_maxFlashFrequency  = 60 // lightning flashes per minute
+	// lights are synced every 15 seconds by default, shorter flashes would
+	// mostly fall between two syncs
+	_flashDuration = 15 * time.Second
+)
+
+// Clouds are generated as a random sequence of passes. Frequency is the average
+// number of passes per hour, Duration the average length of a pass in seconds
+// and Depth the fraction of light (0-1) blocked by the thickest cloud.
+type Clouds struct {
+	Frequency float64 `json:"frequency"`
+	Duration  float64 `json:"duration"`
+	Depth     float64 `json:"depth"`
+}
+
+// Overcast days happen with the given probability (0-1) and block Depth
+// fraction of the light for the whole day
+type Overcast struct {
+	Probability float64 `json:"probability"`
+	Depth       float64 `json:"depth"`
+}
+
+// Lightning storms happen with the given probability (0-1) between Start and
+// End, flashing all channels to their maximum Frequency times per minute on average.
+// Each flash is held for Duration seconds, 15 when not set. Flashes shorter than
+// the lighting sync interval may not be seen.
+type Lightning struct {
+	Probability float64 `json:"probability"`
+	Start       string  `json:"start"`
+	End         string  `json:"end"`
+	Frequency   float64 `json:"frequency"`
+	Duration    float64 `json:"duration"`
+}
+
+func (l Lightning) hold() time.Duration {
+	if l.Duration <= 0 {
+		return _flashDuration
+	}
+	return time.Duration(l.Duration * float64(time.Second))
+}
+
+// Weather describes the simulated sky. Events are derived from the seed and
+// the calendar day alone, so all channels sharing the same Weather dim together.
+type Weather struct {
+	Seed      int64     `json:"seed"`
+	Clouds    Clouds    `json:"clouds"`
+	Overcast  Overcast  `json:"overcast"`
+	Lightning Lightning `json:"lightning"`
+}
+
+// WeatherProfile is implemented by profiles driven by the simulated sky
+type WeatherProfile interface {
+	Profile
+	Sky() Weather
+	Flashing(time.Time) bool
+}
+
+type cloud struct {
+	start    time.Time
+	duration time.Duration
+	strength float64
+}
+
+type sky struct {
+	overcast bool
+	clouds   []cloud
+	flashes  []time.Time
+}
+
+type weather struct {
+	Weather
+	Base     ProfileSpec `json:"base"`
+	min, max float64
+	base     Profile
+	day      string
+	sky      sky
+	previous sky
+}
+
+func (w *weather) Name() string {
+	return _weatherProfileName
+}
+
+func (w *weather) Sky() Weather {
+	return w.Weather
+}
+
+func NewWeather(conf json.RawMessage, min, max float64) (*weather, error) {
+	var w weather
+	if err := json.Unmarshal(conf, &w); err != nil {
+		return nil, err
+	}
+	if err := w.Validate(); err != nil {
+		return nil, err
+	}
+	if w.Base.Type == _weatherProfileName {
+		return nil, fmt.Errorf("weather profile can not be used as its own base")
+	}
+	spec := w.Base
+	spec.Min = min
+	spec.Max = max
+	base, err := spec.CreateProfile()
+	if err != nil {
+		return nil, fmt.Errorf("invalid base profile. Error:%s", err)
+	}
+	if max == 0 {
+		max = 100
+	}
+	w.base = base
+	w.min = min
+	w.max = max
+	return &w, nil
+}
+
+func (w Weather) Validate() error {
+	if w.Clouds.Frequency < 0 || w.Clouds.Frequency > _maxCloudFrequency {
+		return fmt.Errorf("cloud frequency should be between 0 and %d per hour, supplied:%f", _maxCloudFrequency, w.Clouds.Frequency)
+	}
+	if w.Clouds.Frequency > 0 && w.Clouds.Duration <= 0 {
+		return fmt.Errorf("cloud duration should be positive, supplied:%f", w.Clouds.Duration)
+	}
+	if w.Clouds.Depth < 0 || w.Clouds.Depth > 1 {
+		return fmt.Errorf("cloud depth should be between 0 and 1, supplied:%f", w.Clouds.Depth)
+	}
+	if w.Overcast.Probability < 0 || w.Overcast.Probability > 1 {
+		return fmt.Errorf("overcast probability should be between 0 and 1, supplied:%f", w.Overcast.Probability)
+	}
+	if w.Overcast.Depth < 0 || w.Overcast.Depth > 1 {
+		return fmt.Errorf("overcast depth should be between 0 and 1, supplied:%f", w.Overcast.Depth)
+	}
+	if w.Lightning.Probability < 0 || w.Lightning.Probability > 1 {
+		return fmt.Errorf("lightning probability should be between 0 and 1, supplied:%f", w.Lightning.Probability)
+	}
+	if w.Lightning.Probability > 0 {
+		if _, err := time.Parse(tFormat, w.Lightning.Start); err != nil {
+			return fmt.Errorf("Failed to parse lightning start time. Error:%s", err)
+		}
+		if _, err := time.Parse(tFormat, w.Lightning.End); err != nil {
+			return fmt.Errorf("Failed to parse lightning end time. Error:%s", err)
+		}
+		if w.Lightning.Frequency <= 0 || w.Lightning.Frequency > _maxFlashFrequency {
+			return fmt.Errorf("lightning frequency should be between 0 and %d per minute, supplied:%f", _maxFlashFrequency, w.Lightning.Frequency)
+		}
+		if w.Lightning.Duration < 0 {
+			return fmt.Errorf("lightning flash duration can not be negative, supplied:%f", w.Lightning.Duration)
+		}
+	}
+	return nil
+}
+
+// forecast generates the events of the calendar day t falls in. Every random
+// number is drawn regardless of the outcome, so the sequence only depends on
+// the seed, the day and the event frequencies.
+func (w Weather) forecast(t time.Time) sky {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+	rng := rand.New(rand.NewSource(w.Seed*100003 + days))
+	var s sky
+	s.overcast = rng.Float64() < w.Overcast.Probability
+	storm := rng.Float64() < w.Lightning.Probability
+	if w.Clouds.Frequency > 0 {
+		mean := 3600 / w.Clouds.Frequency
+		at := 0.0
+		for {
+			at += rng.ExpFloat64() * mean
+			duration := w.Clouds.Duration * (0.5 + rng.Float64())
+			strength := 0.5 + 0.5*rng.Float64()
+			if at >= 86400 {
+				break
+			}
+			s.clouds = append(s.clouds, cloud{
+				start:    midnight.Add(time.Duration(at * float64(time.Second))),
+				duration: time.Duration(duration * float64(time.Second)),
+				strength: strength,
+			})
+		}
+	}
+	if storm {
+		start, _ := time.Parse(tFormat, w.Lightning.Start)
+		end, _ := time.Parse(tFormat, w.Lightning.End)
+		from := time.Date(t.Year(), t.Month(), t.Day(), start.Hour(), start.Minute(), start.Second(), 0, t.Location())
+		to := time.Date(t.Year(), t.Month(), t.Day(), end.Hour(), end.Minute(), end.Second(), 0, t.Location())
+		if to.Before(from) {
+			to = to.Add(24 * time.Hour)
+		}
+		mean := 60 / w.Lightning.Frequency
+		for at := from; ; {
+			at = at.Add(time.Duration(rng.ExpFloat64() * mean * float64(time.Second)))
+			if at.After(to) {
+				break
+			}
+			s.flashes = append(s.flashes, at)
+		}
+	}
+	return s
+}
+
+// cover returns the fraction (0-1) of the sky covered by clouds at t. Each pass
+// builds up and clears smoothly, overlapping passes do not add up.
+func (s sky) cover(t time.Time) float64 {
+	c := 0.0
+	for _, cl := range s.clouds {
+		if t.Before(cl.start) || !t.Before(cl.start.Add(cl.duration)) {
+			continue
+		}
+		v := math.Sin(math.Pi * t.Sub(cl.start).Seconds() / cl.duration.Seconds())
+		c = math.Max(c, cl.strength*v*v)
+	}
+	return c
+}
+
+func (s sky) flash(t time.Time, hold time.Duration) bool {
+	for _, f := range s.flashes {
+		if !t.Before(f) && t.Before(f.Add(hold)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *weather) update(t time.Time) {
+	d := t.Format(_weatherDailyFormat)
+	if w.day != d {
+		w.sky = w.forecast(t)
+		w.previous = w.forecast(t.AddDate(0, 0, -1))
+		w.day = d
+	}
+}
+
+// Flashing reports whether a lightning flash drives the channel at t
+func (w *weather) Flashing(t time.Time) bool {
+	w.update(t)
+	// storms that started the previous evening may still be going on
+	hold := w.Lightning.hold()
+	return w.sky.flash(t, hold) || w.previous.flash(t, hold)
+}
+
+func (w *weather) Get(t time.Time) float64 {
+	if w.Flashing(t) {
+		return w.max
+	}
+	v := w.base.Get(t)
+	if v <= 0 {
+		return v
+	}
+	if w.sky.overcast {
+		v *= 1 - w.Overcast.Depth
+	}
+	v *= 1 - w.Clouds.Depth*w.sky.cover(t)
+	return math.Max(v, w.min)
+}
@@ -0,0 +1,89 @@
+package pwm_profile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeather(t *testing.T) {
+	conf := `
+{
+	"seed": 7,
+	"base": {"type":"fixed", "config":{"start":"08:00:00","end":"20:00:00","value":80}},
+	"clouds": {"frequency":6, "duration":600, "depth":0.5},
+	"overcast": {"probability":0, "depth":0.4},
+	"lightning": {"probability":1, "start":"21:00:00", "end":"22:00:00", "frequency":2}
+}`
+	w1, err := NewWeather([]byte(conf), 10, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := NewWeather([]byte(conf), 10, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w1.Name() != _weatherProfileName {
+		t.Error("Unexpected profile name:", w1.Name())
+	}
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	dimmed := 0
+	for i := 0; i < 24*60; i++ {
+		t1 := day.Add(time.Duration(i) * time.Minute)
+		v1, v2 := w1.Get(t1), w2.Get(t1)
+		if v1 != v2 {
+			t.Fatal("Weather should be deterministic. Found:", v1, v2, "at", t1)
+		}
+		if v1 > 80 && v1 != 90 {
+			t.Error("Clouds should never brighten the base profile, found:", v1, "at", t1)
+		}
+		if v1 < 80 && v1 > 0 {
+			dimmed++
+		}
+	}
+	if dimmed == 0 {
+		t.Error("Expected clouds to dim the light during the day")
+	}
+	if len(w1.sky.flashes) == 0 {
+		t.Fatal("Expected lightning flashes during a storm")
+	}
+	f := w1.sky.flashes[0]
+	if f.Hour() != 21 {
+		t.Error("Expected flash within storm window, found:", f)
+	}
+	if v := w1.Get(f); v != 90 {
+		t.Error("Expected flash to drive channel to max, found:", v)
+	}
+	if !w1.Flashing(f.Add(_flashDuration - time.Second)) {
+		t.Error("Expected flash to last a lighting sync interval")
+	}
+	if w1.forecast(day).clouds[0] == w1.forecast(day.AddDate(0, 0, 1)).clouds[0] {
+		t.Error("Expected different clouds on different days")
+	}
+
+	overcast := `{"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00","value":80}},"overcast":{"probability":1,"depth":0.5}}`
+	w3, err := NewWeather([]byte(overcast), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := w3.Get(day.Add(12 * time.Hour)); v != 40 {
+		t.Error("Expected overcast day to halve the light, found:", v)
+	}
+	if v := w3.Get(day.Add(2 * time.Hour)); v != 0 {
+		t.Error("Expected darkness outside base profile, found:", v)
+	}
+
+	for _, c := range []string{
+		`{"base":{"type":"weather"}}`,
+		`{"base":{"type":"foo"}}`,
+		`{"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00"}},"clouds":{"frequency":6}}`,
+		`{"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00"}},"clouds":{"depth":2}}`,
+		`{"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00"}},"overcast":{"probability":-1}}`,
+		`{"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00"}},"lightning":{"probability":0.5,"start":"foo"}}`,
+		`{"base":{"type":"fixed","config":{"start":"08:00:00","end":"20:00:00"}},"lightning":{"probability":0.5,"start":"21:00:00","end":"22:00:00"}}`,
+		`[]`,
+	} {
+		if _, err := NewWeather([]byte(c), 0, 100); err == nil {
+			t.Error("Expected error for config:", c)
+		}
+	}
+}
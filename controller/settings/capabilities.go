@@ -15,6 +15,9 @@ type Capabilities struct {
 	Doser         bool `json:"doser"`
 	Ph            bool `json:"ph"`
 	Macro         bool `json:"macro"`
+	Water         bool `json:"water"`
+	Journal       bool `json:"journal"`
+	Workflow      bool `json:"workflow"`
 	Configuration bool `json:"configuration"`
 }
 
@@ -4,8 +4,10 @@ const (
 	ReefPiBucket           = "reef-pi"
 	ATOBucket              = "ato"
 	ATOUsageBucket         = "ato_usage"
+	ATOReservoirBucket     = "ato_reservoir"
 	CameraBucket           = "camera"
 	CameraItemBucket       = "photos"
+	CameraUploadBucket     = "camera_uploads"
 	InletBucket            = "inlets"
 	JackBucket             = "jacks"
 	AnalogInputBucket      = "analog_inputs"
@@ -14,8 +16,10 @@ const (
 	DoserUsageBucket       = "doser_usage"
 	EquipmentBucket        = "equipment"
 	LightingBucket         = "lightings"
+	LightingProfileBucket  = "lighting_profiles"
 	MacroBucket            = "macro"
 	MacroUsageBucket       = "macro_usage"
+	MacroRunBucket         = "macro_runs"
 	PhBucket               = "phprobes"
 	PhCalibrationBucket    = "ph_calibration"
 	PhReadingsBucket       = "ph_readings"
@@ -23,10 +27,16 @@ const (
 	TemperatureUsageBucket = "temperature_usage"
 	FlowBucket             = "flow"
 	FlowUsageBucket        = "flow_usage"
+	FlowPumpBucket         = "flow_pump"
 	TimerBucket            = "timers"
 	ErrorBucket            = "errors"
 	DriverBucket           = "drivers"
 	LeakBucket             = "leak"
+	WaterParameterBucket   = "water_parameters"
+	WaterResultBucket      = "water_results"
+	JournalBucket          = "journal"
+	JournalEntryBucket     = "journal_entries"
+	WorkflowBucket         = "workflows"
 )
 
 type Store interface {